@@ -1,5 +1,16 @@
 package args
 
+import "time"
+
 type collectCmd struct {
-	Root string `arg:"positional,required" help:"Directory whence recursive searching begins"`
+	Root       string        `arg:"positional" help:"Directory whence recursive searching begins"`
+	Offline    string        `help:"Collect from an offline Windows system volume mounted here instead of the live host" placeholder:"<mountpoint>"`
+	Drive      string        `default:"c:" help:"Drive letter the offline volume had on its host" placeholder:"<drive>"`
+	Roots      string        `help:"PEM file of the root certificates to verify signatures against (defaults to the collected host's root store)" placeholder:"<pem>"`
+	Catalogs   bool          `help:"Index the host's catalog files to recognize catalog-signed PEs" default:"false"`
+	Sniff      bool          `help:"Find PEs by their MZ/PE headers, whatever their extension" default:"false"`
+	Extensions []string      `help:"Extensions of the files collected as PEs when not sniffing (defaults to exe dll sys cpl ocx scr drv ax efi mui node)" placeholder:"<ext>"`
+	MaxSize    int64         `help:"Size, in MiB, of the largest file parsed as a PE (0 for no limit)" default:"256" placeholder:"<MiB>"`
+	Timeout    time.Duration `help:"How long parsing a PE may take (0 for no limit)" default:"30s" placeholder:"<duration>"`
+	Rules      string        `help:"YAML file of rules tagging the PEs they match" placeholder:"<yaml>"`
 }
@@ -0,0 +1,141 @@
+package collectors
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf16"
+
+	"www.velocidex.com/golang/go-pe"
+
+	"github.com/audibleblink/lpegopher/util"
+)
+
+// apiSetSection is the section of apisetschema.dll that holds the API set
+// namespace the loader maps contracts with
+const apiSetSection = ".apiset"
+
+// loadAPISetSchema reads the API set namespace from the apisetschema.dll at
+// the Windows path winPath on the collected host
+func loadAPISetSchema(winPath string) (map[string]string, error) {
+	local := winPath
+	if Offline() {
+		var err error
+		local, err = volume.LocalPath(winPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	peFile, err := pe.NewPEFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, section := range peFile.Sections {
+		if section.Name != apiSetSection {
+			continue
+		}
+		data := make([]byte, section.Size)
+		_, err := f.ReadAt(data, section.FileOffset)
+		if err != nil {
+			return nil, err
+		}
+		return parseAPISetSchema(data)
+	}
+	return nil, fmt.Errorf("%s has no %s section", winPath, apiSetSection)
+}
+
+// parseAPISetSchema maps the contracts of a version 6 API set namespace,
+// used since Windows 10, to the DLLs that host them by default. Contracts
+// are keyed by their lowercased name up to the last hyphen, which is how
+// the loader matches them regardless of their minor version.
+func parseAPISetSchema(data []byte) (map[string]string, error) {
+	const (
+		headerSize = 28
+		entrySize  = 24
+		valueSize  = 20
+	)
+
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("api set namespace truncated")
+	}
+	le := binary.LittleEndian
+	if version := le.Uint32(data); version != 6 {
+		return nil, fmt.Errorf("unsupported api set namespace version %d", version)
+	}
+	count := le.Uint32(data[12:])
+	entryOffset := le.Uint32(data[16:])
+
+	str := func(offset, length uint32) (string, error) {
+		end := uint64(offset) + uint64(length)
+		if end > uint64(len(data)) || length%2 != 0 {
+			return "", fmt.Errorf("api set string out of bounds")
+		}
+		u16 := make([]uint16, length/2)
+		for i := range u16 {
+			u16[i] = le.Uint16(data[offset+uint32(i)*2:])
+		}
+		return string(utf16.Decode(u16)), nil
+	}
+
+	contracts := make(map[string]string, count)
+	for i := uint32(0); i < count; i++ {
+		entry := uint64(entryOffset) + uint64(i)*entrySize
+		if entry+entrySize > uint64(len(data)) {
+			return nil, fmt.Errorf("api set entry %d out of bounds", i)
+		}
+		e := data[entry:]
+
+		name, err := str(le.Uint32(e[4:]), le.Uint32(e[12:]))
+		if err != nil {
+			return nil, err
+		}
+
+		// the default host is the value that doesn't name an importer
+		valueOffset, valueCount := le.Uint32(e[16:]), le.Uint32(e[20:])
+		host := ""
+		for j := uint32(0); j < valueCount; j++ {
+			value := uint64(valueOffset) + uint64(j)*valueSize
+			if value+valueSize > uint64(len(data)) {
+				return nil, fmt.Errorf("api set value out of bounds")
+			}
+			v := data[value:]
+			if le.Uint32(v[8:]) != 0 {
+				continue
+			}
+			host, err = str(le.Uint32(v[12:]), le.Uint32(v[16:]))
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		if host != "" {
+			contracts[util.Lower(name)] = util.Lower(host)
+		}
+	}
+	return contracts, nil
+}
+
+// isAPISet reports whether dll names an API set contract rather than a file
+func isAPISet(dll string) bool {
+	dll = util.Lower(dll)
+	return strings.HasPrefix(dll, "api-") || strings.HasPrefix(dll, "ext-")
+}
+
+// apiSetKey returns the name by which the contract dll is found in the
+// namespace: without its extension and last version number
+func apiSetKey(dll string) string {
+	dll = strings.TrimSuffix(util.Lower(dll), ".dll")
+	if i := strings.LastIndex(dll, "-"); i != -1 {
+		dll = dll[:i]
+	}
+	return dll
+}
@@ -0,0 +1,198 @@
+package collectors
+
+import (
+	"encoding/binary"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// testAPISetSchema builds a version 6 API set namespace. Each contract maps
+// to its hosts, the first being the default and the rest, as importer=host,
+// the exceptions for a given importer.
+func testAPISetSchema(contracts [][]string) []byte {
+	le := binary.LittleEndian
+	const headerSize, entrySize, valueSize = 28, 24, 20
+
+	valueCount := 0
+	for _, c := range contracts {
+		valueCount += len(c) - 1
+	}
+	entryOffset := headerSize
+	valueOffset := entryOffset + len(contracts)*entrySize
+	data := make([]byte, valueOffset+valueCount*valueSize)
+
+	str := func(s string) (offset, length uint32) {
+		offset = uint32(len(data))
+		for _, u := range utf16.Encode([]rune(s)) {
+			data = le.AppendUint16(data, u)
+		}
+		return offset, uint32(len(data)) - offset
+	}
+
+	le.PutUint32(data[0:], 6)
+	le.PutUint32(data[12:], uint32(len(contracts)))
+	le.PutUint32(data[16:], uint32(entryOffset))
+
+	value := valueOffset
+	for i, c := range contracts {
+		nameOffset, nameLength := str(c[0])
+		hashed := uint32(len(c[0]))
+		for hashed > 0 && c[0][hashed-1] != '-' {
+			hashed--
+		}
+
+		e := entryOffset + i*entrySize
+		le.PutUint32(data[e+4:], nameOffset)
+		le.PutUint32(data[e+8:], nameLength)
+		le.PutUint32(data[e+12:], (hashed-1)*2)
+		le.PutUint32(data[e+16:], uint32(value))
+		le.PutUint32(data[e+20:], uint32(len(c)-1))
+
+		for _, host := range c[1:] {
+			importer, target, redirected := strings.Cut(host, "=")
+			if redirected {
+				off, length := str(importer)
+				le.PutUint32(data[value+4:], off)
+				le.PutUint32(data[value+8:], length)
+			} else {
+				target = host
+			}
+			off, length := str(target)
+			le.PutUint32(data[value+12:], off)
+			le.PutUint32(data[value+16:], length)
+			value += valueSize
+		}
+	}
+	return data
+}
+
+// testPE builds a minimal 64-bit PE holding one section with data
+func testPE(section string, data []byte) []byte {
+	le := binary.LittleEndian
+	const (
+		peOffset      = 0x40
+		optionalSize  = 240
+		fileAlignment = 0x200
+	)
+
+	rawSize := (len(data) + fileAlignment - 1) / fileAlignment * fileAlignment
+	image := make([]byte, fileAlignment+rawSize)
+	copy(image, "MZ")
+	le.PutUint32(image[0x3c:], peOffset)
+	copy(image[peOffset:], "PE\x00\x00")
+
+	fileHeader := image[peOffset+4:]
+	le.PutUint16(fileHeader[0:], 0x8664)
+	le.PutUint16(fileHeader[2:], 1)
+	le.PutUint16(fileHeader[16:], optionalSize)
+	le.PutUint16(fileHeader[18:], 0x2022)
+
+	optional := fileHeader[20:]
+	le.PutUint16(optional[0:], 0x20b)
+	le.PutUint64(optional[24:], 0x180000000)
+	le.PutUint32(optional[32:], 0x1000)
+	le.PutUint32(optional[36:], fileAlignment)
+	le.PutUint32(optional[56:], 0x2000)
+	le.PutUint32(optional[60:], fileAlignment)
+	le.PutUint16(optional[68:], 3)
+	le.PutUint32(optional[108:], 16)
+
+	header := optional[optionalSize:]
+	copy(header[0:8], section)
+	le.PutUint32(header[8:], uint32(len(data)))
+	le.PutUint32(header[12:], 0x1000)
+	le.PutUint32(header[16:], uint32(rawSize))
+	le.PutUint32(header[20:], fileAlignment)
+	le.PutUint32(header[36:], 0x40000040)
+
+	copy(image[fileAlignment:], data)
+	return image
+}
+
+func TestParseAPISetSchema(t *testing.T) {
+	schema := testAPISetSchema([][]string{
+		{"api-ms-win-core-file-l1-2-4", "KernelBase.dll"},
+		{"api-ms-win-core-sysinfo-l1-2-3", "kernel32.dll=kernelbase.dll", "kernelbase.dll"},
+		{"ext-ms-win-ntuser-window-l1-1-5", "user32.dll"},
+		{"ext-ms-win-unhosted-l1-1-0"},
+	})
+
+	contracts, err := parseAPISetSchema(schema)
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+	expected := map[string]string{
+		"api-ms-win-core-file-l1-2":     "kernelbase.dll",
+		"api-ms-win-core-sysinfo-l1-2":  "kernelbase.dll",
+		"ext-ms-win-ntuser-window-l1-1": "user32.dll",
+	}
+	if !maps.Equal(contracts, expected) {
+		t.Errorf("Expected contracts %v, got %v", expected, contracts)
+	}
+
+	t.Run("Truncated namespaces are rejected", func(t *testing.T) {
+		if _, err := parseAPISetSchema(schema[:40]); err == nil {
+			t.Error("Expected an error for a truncated namespace")
+		}
+	})
+
+	t.Run("Older namespaces are rejected", func(t *testing.T) {
+		old := append([]byte{}, schema...)
+		binary.LittleEndian.PutUint32(old, 4)
+		if _, err := parseAPISetSchema(old); err == nil {
+			t.Error("Expected an error for a version 4 namespace")
+		}
+	})
+}
+
+func TestAPISetKey(t *testing.T) {
+	tests := []struct {
+		dll    string
+		apiSet bool
+		key    string
+	}{
+		{"api-ms-win-core-file-l1-2-4.dll", true, "api-ms-win-core-file-l1-2"},
+		{"API-MS-Win-Core-File-L1-2-0.dll", true, "api-ms-win-core-file-l1-2"},
+		{"ext-ms-win-ntuser-window-l1-1-5.dll", true, "ext-ms-win-ntuser-window-l1-1"},
+		{"kernel32.dll", false, "kernel32"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dll, func(t *testing.T) {
+			if isAPISet(test.dll) != test.apiSet {
+				t.Errorf("isAPISet = %v, expected %v", !test.apiSet, test.apiSet)
+			}
+			if key := apiSetKey(test.dll); key != test.key {
+				t.Errorf("apiSetKey = %q, expected %q", key, test.key)
+			}
+		})
+	}
+}
+
+func TestLoadAPISetSchema(t *testing.T) {
+	mount := useTestVolume(t)
+
+	schema := testAPISetSchema([][]string{{"api-ms-win-core-file-l1-2-4", "kernelbase.dll"}})
+	path := filepath.Join(mount, "Windows", "System32", "apisetschema.dll")
+	os.MkdirAll(filepath.Dir(path), 0o755)
+	if err := os.WriteFile(path, testPE(apiSetSection, schema), 0o644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+
+	contracts, err := loadAPISetSchema(`C:\Windows\System32\apisetschema.dll`)
+	if err != nil {
+		t.Fatalf("Failed to load schema: %v", err)
+	}
+	if host := contracts["api-ms-win-core-file-l1-2"]; host != "kernelbase.dll" {
+		t.Errorf("Expected kernelbase.dll, got %q", host)
+	}
+
+	os.WriteFile(path, testPE(".text", schema), 0o644)
+	if _, err := loadAPISetSchema(`C:\Windows\System32\apisetschema.dll`); err == nil {
+		t.Error("Expected an error for a DLL without an .apiset section")
+	}
+}
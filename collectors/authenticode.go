@@ -0,0 +1,443 @@
+package collectors
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"debug/pe"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Velocidex/pkcs7"
+	gope "www.velocidex.com/golang/go-pe"
+
+	"github.com/audibleblink/logerr"
+)
+
+const (
+	// pkcsSignedData is the type of a certificate holding an Authenticode
+	// signature
+	pkcsSignedData = 2
+
+	// maxCertificateTable bounds the signature read from a damaged or
+	// hostile image
+	maxCertificateTable = 16 << 20
+
+	// catRoot holds the catalog files of the collected host, one directory
+	// per catalog database
+	catRoot = `\System32\CatRoot`
+
+	// certProperty is the property of a serialized certificate store entry
+	// that holds the certificate itself
+	certProperty = 32
+)
+
+// rootStores are the keys of the SOFTWARE hive holding the certificates the
+// collected host trusts as roots
+var rootStores = []string{
+	`Microsoft\SystemCertificates\ROOT\Certificates`,
+	`Microsoft\SystemCertificates\AuthRoot\Certificates`,
+}
+
+var (
+	// trustedRoots are the certificates signature chains are verified
+	// against, populated by LoadRootStore. No signature is verified
+	// without them.
+	trustedRoots *x509.CertPool
+
+	// catalogs maps the hex Authenticode hashes of catalog-signed files to
+	// the signature of the catalog listing them, populated by LoadCatalogs
+	catalogs map[string]*Signature
+)
+
+// Signature is the Authenticode signature of a PE, either embedded in the
+// file or, for catalog-signed files, that of the catalog listing its hash
+type Signature struct {
+	Signed      bool   `json:"Signed"`
+	Subject     string `json:"Subject"`
+	Issuer      string `json:"Issuer"`
+	Thumbprint  string `json:"Thumbprint"`  // SHA-1 of the signing certificate, as Windows shows it
+	HashMatches bool   `json:"HashMatches"` // the signed hash is that of the file on disk
+	Verified    bool   `json:"Verified"`    // the signature chains to a trusted root
+	Catalog     string `json:"Catalog"`     // the catalog the file is signed through, if any
+}
+
+// LoadRootStore loads the root certificates signatures are verified against
+// from pemFile or, without one, from the collected host: the ROOT and
+// AuthRoot stores of an offline volume's SOFTWARE hive, or the system store
+// of the live host. It must run before PE collection for signatures to be
+// verified.
+func LoadRootStore(pemFile string) {
+	log := logerr.Add("root store")
+
+	var (
+		pool *x509.CertPool
+		err  error
+	)
+	switch {
+	case pemFile != "":
+		pool, err = rootsFromPEM(pemFile)
+	case Offline():
+		pool, err = offlineRoots()
+	default:
+		pool, err = x509.SystemCertPool()
+	}
+	if err != nil {
+		log.Warnf("signatures won't be verified: %s", err)
+		return
+	}
+	trustedRoots = pool
+}
+
+// rootsFromPEM reads the PEM encoded certificates in path
+func rootsFromPEM(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in %s", path)
+	}
+	return pool, nil
+}
+
+// offlineRoots reads the root stores of the offline volume's SOFTWARE hive
+func offlineRoots() (*x509.CertPool, error) {
+	log := logerr.Add("offline root store")
+
+	software, err := openOfflineHive(softwareHive)
+	if err != nil {
+		return nil, err
+	}
+	defer software.Close()
+
+	pool := x509.NewCertPool()
+	count := 0
+	for _, store := range rootStores {
+		key, err := software.OpenKey(store)
+		if err != nil {
+			log.Debugf("unable to read store: %s", err)
+			continue
+		}
+		certs, err := key.Subkeys()
+		if err != nil {
+			continue
+		}
+		for _, certKey := range certs {
+			blob, _, err := certKey.GetBinaryValue("Blob")
+			if err != nil {
+				continue
+			}
+			der, err := certFromBlob(blob)
+			if err != nil {
+				log.Debugf("%s: %s", certKey.Name, err)
+				continue
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				log.Debugf("%s: %s", certKey.Name, err)
+				continue
+			}
+			pool.AddCert(cert)
+			count++
+		}
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("no root certificates in %s", softwareHive)
+	}
+	return pool, nil
+}
+
+// certFromBlob returns the DER certificate from the serialized store entry
+// the registry keeps a certificate as, a list of properties each headed by
+// its id, flags and size
+func certFromBlob(blob []byte) ([]byte, error) {
+	le := binary.LittleEndian
+	for len(blob) >= 12 {
+		id, size := le.Uint32(blob), le.Uint32(blob[8:])
+		if uint64(size) > uint64(len(blob)-12) {
+			break
+		}
+		if id == certProperty {
+			return blob[12 : 12+size], nil
+		}
+		blob = blob[12+size:]
+	}
+	return nil, fmt.Errorf("no certificate in blob")
+}
+
+// LoadCatalogs indexes the hashes listed by the catalog files of the
+// collected host, so catalog-signed files, which carry no signature of
+// their own, are reported with the signature of their catalog
+func LoadCatalogs() {
+	log := logerr.Add("catalogs")
+
+	dir := systemRoot() + catRoot
+	if Offline() {
+		var err error
+		dir, err = volume.LocalPath(dir)
+		if err != nil {
+			log.Warnf("catalog-signed files won't be recognized: %s", err)
+			return
+		}
+	}
+
+	index := map[string]*Signature{}
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".cat") {
+			return nil
+		}
+		err = indexCatalog(index, path)
+		if err != nil {
+			log.Debugf("%s: %s", path, err)
+		}
+		return nil
+	})
+	log.Debugf("%d catalog-signed hashes", len(index))
+	catalogs = index
+}
+
+// indexCatalog adds the hashes listed by the catalog file at path to index
+func indexCatalog(index map[string]*Signature, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	p7, err := pkcs7.Parse(data)
+	if err != nil {
+		return err
+	}
+
+	var ctl gope.CertificateTrustList
+	_, err = asn1.Unmarshal(p7.SignedData.ContentInfo.Content.Bytes, &ctl)
+	if err != nil {
+		return err
+	}
+
+	sig := signatureFor(p7)
+	sig.HashMatches = true
+	sig.Verified = sig.Verified && p7.Verify() == nil
+	sig.Catalog = hostPath(path)
+
+	for _, member := range ctl.CatalogList {
+		for _, digest := range catalogMemberHashes(member) {
+			index[hex.EncodeToString(digest)] = sig
+		}
+	}
+	return nil
+}
+
+// catalogMemberHashes returns the hashes a catalog lists a file by: its
+// tag, which spells the hash out in UTF-16 hex, and the digest of the
+// indirect data attribute of newer catalogs
+func catalogMemberHashes(member gope.CatalogList) [][]byte {
+	var hashes [][]byte
+	tag := strings.TrimRight(string(decodeUTF16Bytes(member.Digest, binary.LittleEndian)), "\x00")
+	if hash, err := hex.DecodeString(tag); err == nil && len(hash) > 0 {
+		hashes = append(hashes, hash)
+	}
+	for _, raw := range member.Members {
+		var attr gope.CatalogMemberSet
+		_, err := asn1.Unmarshal(raw.FullBytes, &attr)
+		if err != nil || !attr.Type.Equal(gope.OIDIndirectData) {
+			continue
+		}
+		var indirect gope.SpcIndirectDataContent
+		_, err = asn1.Unmarshal(attr.Value.Bytes, &indirect)
+		if err == nil {
+			hashes = append(hashes, indirect.MessageDigest.Digest)
+		}
+	}
+	return hashes
+}
+
+// signatureOf returns the Authenticode signature of img, or the signature
+// of the catalog listing it
+func signatureOf(img *peImage) *Signature {
+	data, err := img.signedData()
+	if err != nil {
+		// a signature is there, but Windows won't make sense of it either
+		return &Signature{Signed: true}
+	}
+	if data == nil {
+		return catalogSignature(img)
+	}
+
+	p7, err := pkcs7.Parse(data)
+	if err != nil {
+		return &Signature{Signed: true}
+	}
+	sig := signatureFor(p7)
+	sig.HashMatches = authenticodeHashMatches(p7, img)
+	sig.Verified = sig.Verified && sig.HashMatches && p7.Verify() == nil
+	return sig
+}
+
+// signatureFor describes the signer of p7. A signature only counts as
+// Verified when its signer chains to one of the trustedRoots; the caller
+// still has to check that it covers what it claims to.
+func signatureFor(p7 *pkcs7.PKCS7) *Signature {
+	sig := &Signature{Signed: true}
+	signer := p7.GetOnlySigner()
+	if signer == nil {
+		return sig
+	}
+
+	thumbprint := sha1.Sum(signer.Raw)
+	sig.Subject = signer.Subject.String()
+	sig.Issuer = signer.Issuer.String()
+	sig.Thumbprint = hex.EncodeToString(thumbprint[:])
+
+	if trustedRoots != nil {
+		intermediates := x509.NewCertPool()
+		for _, cert := range p7.Certificates {
+			intermediates.AddCert(cert)
+		}
+		// signing certificates outlive their validity through the
+		// timestamp of the signature, so like Windows, expiry is ignored
+		_, err := signer.Verify(x509.VerifyOptions{
+			Roots:         trustedRoots,
+			Intermediates: intermediates,
+			CurrentTime:   signer.NotBefore,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		sig.Verified = err == nil
+	}
+	return sig
+}
+
+// authenticodeHashMatches reports whether the hash signed by p7 is the
+// Authenticode hash of img
+func authenticodeHashMatches(p7 *pkcs7.PKCS7, img *peImage) bool {
+	var indirect gope.SpcIndirectDataContent
+	_, err := asn1.Unmarshal(p7.SignedData.ContentInfo.Content.Bytes, &indirect)
+	if err != nil {
+		return false
+	}
+
+	var h hash.Hash
+	switch algorithm := indirect.MessageDigest.DigestAlgorithm.Algorithm; {
+	case algorithm.Equal(pkcs7.OIDDigestAlgorithmSHA256):
+		h = sha256.New()
+	case algorithm.Equal(pkcs7.OIDDigestAlgorithmSHA1):
+		h = sha1.New()
+	default:
+		return false
+	}
+	if err := img.hashAuthenticode(h); err != nil {
+		return false
+	}
+	return bytes.Equal(h.Sum(nil), indirect.MessageDigest.Digest)
+}
+
+// catalogSignature returns the signature of the catalog listing the hash
+// of img, or an unsigned Signature
+func catalogSignature(img *peImage) *Signature {
+	if len(catalogs) == 0 {
+		return &Signature{}
+	}
+
+	sha256Hash, sha1Hash := sha256.New(), sha1.New()
+	if err := img.hashAuthenticode(io.MultiWriter(sha256Hash, sha1Hash)); err != nil {
+		return &Signature{}
+	}
+	for _, h := range []hash.Hash{sha256Hash, sha1Hash} {
+		if sig, ok := catalogs[hex.EncodeToString(h.Sum(nil))]; ok {
+			return sig
+		}
+	}
+	return &Signature{}
+}
+
+// signedData returns the PKCS#7 SignedData of the image's certificate
+// table, or nil when the image isn't signed
+func (img *peImage) signedData() ([]byte, error) {
+	dir := img.directory(securityDirectory)
+	if dir.VirtualAddress == 0 || dir.Size == 0 {
+		return nil, nil
+	}
+
+	// unlike the other directories, it holds a file offset, and each
+	// certificate is headed by its length, revision and type
+	header := make([]byte, 8)
+	_, err := img.r.ReadAt(header, int64(dir.VirtualAddress))
+	if err != nil {
+		return nil, fmt.Errorf("certificate table: %w", err)
+	}
+	length := binary.LittleEndian.Uint32(header)
+	if length <= 8 || length > dir.Size || length > maxCertificateTable {
+		return nil, fmt.Errorf("certificate table: invalid length %d", length)
+	}
+	if certType := binary.LittleEndian.Uint16(header[6:]); certType != pkcsSignedData {
+		return nil, fmt.Errorf("certificate table: unsupported type %#x", certType)
+	}
+
+	data := make([]byte, length-8)
+	_, err = img.r.ReadAt(data, int64(dir.VirtualAddress)+8)
+	if err != nil {
+		return nil, fmt.Errorf("certificate table: %w", err)
+	}
+	return data, nil
+}
+
+// hashAuthenticode writes the image to w the way Authenticode hashes it:
+// without its checksum, the certificate table or the directory locating it
+func (img *peImage) hashAuthenticode(w io.Writer) error {
+	var lfanew [4]byte
+	_, err := img.r.ReadAt(lfanew[:], 0x3c)
+	if err != nil {
+		return err
+	}
+	optionalHeader := int64(binary.LittleEndian.Uint32(lfanew[:])) + 4 + 20
+	checksum := optionalHeader + 64
+	directories := optionalHeader + 96
+	if img.is64() {
+		directories = optionalHeader + 112
+	}
+	securityEntry := directories + securityDirectory*8
+	headers := int64(img.headerSize())
+
+	ranges := [][2]int64{{0, checksum}, {checksum + 4, securityEntry}, {securityEntry + 8, headers}}
+	sections := slices.Clone(img.Sections)
+	slices.SortFunc(sections, func(a, b *pe.Section) int { return cmp.Compare(a.Offset, b.Offset) })
+	end := headers
+	for _, s := range sections {
+		if s.Size == 0 {
+			continue
+		}
+		ranges = append(ranges, [2]int64{int64(s.Offset), int64(s.Offset) + int64(s.Size)})
+		end = max(end, int64(s.Offset)+int64(s.Size))
+	}
+
+	// data appended after the sections is hashed too, up to the
+	// certificate table
+	if table := img.directory(securityDirectory); table.VirtualAddress != 0 {
+		ranges = append(ranges, [2]int64{end, int64(table.VirtualAddress)})
+	} else {
+		ranges = append(ranges, [2]int64{end, math.MaxInt64})
+	}
+
+	for _, r := range ranges {
+		if r[1] <= r[0] {
+			continue
+		}
+		_, err := io.Copy(w, io.NewSectionReader(img.r, r[0], r[1]-r[0]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,414 @@
+package collectors
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Velocidex/pkcs7"
+	"www.velocidex.com/golang/go-pe"
+
+	"github.com/audibleblink/lpegopher/hive"
+	"github.com/audibleblink/lpegopher/hive/hivetest"
+)
+
+// testSigner is a code signing certificate issued by its own root
+type testSigner struct {
+	root *x509.Certificate
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestSigner(t *testing.T, name string) *testSigner {
+	t.Helper()
+
+	issue := func(template, parent *x509.Certificate, key, signer *ecdsa.PrivateKey) *x509.Certificate {
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+		if err != nil {
+			t.Fatalf("Failed to create certificate: %v", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("Failed to parse certificate: %v", err)
+		}
+		return cert
+	}
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		return key
+	}
+
+	rootKey, key := newKey(), newKey()
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name + " Root"},
+		NotBefore:             time.Now().Add(-48 * time.Hour),
+		NotAfter:              time.Now().Add(48 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	root := issue(rootTemplate, rootTemplate, rootKey, rootKey)
+
+	cert := issue(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"Vendor, Inc."}},
+		NotBefore:    time.Now().Add(-24 * time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}, root, key, rootKey)
+
+	return &testSigner{root: root, cert: cert, key: key}
+}
+
+// sign returns the PKCS#7 SignedData over the DER encoded content of the
+// given type, the way Authenticode signs its SEQUENCE
+func (s *testSigner) sign(t *testing.T, contentType asn1.ObjectIdentifier, content []byte) []byte {
+	t.Helper()
+
+	var seq asn1.RawValue
+	if _, err := asn1.Unmarshal(content, &seq); err != nil {
+		t.Fatalf("Failed to unmarshal content: %v", err)
+	}
+	sd, err := pkcs7.NewSignedData(seq.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to create signed data: %v", err)
+	}
+	sd.GetSignedData().ContentInfo.ContentType = contentType
+	sd.GetSignedData().ContentInfo.Content = asn1.RawValue{Class: 2, Tag: 0, IsCompound: true, Bytes: content}
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	err = sd.AddSignerChain(s.cert, s.key, []*x509.Certificate{s.root}, pkcs7.SignerInfoConfig{})
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	signed, err := sd.Finish()
+	if err != nil {
+		t.Fatalf("Failed to finish signed data: %v", err)
+	}
+	return signed
+}
+
+// indirectData is the SpcIndirectDataContent signing a PE with hash digest
+func indirectData(t *testing.T, digest []byte) []byte {
+	t.Helper()
+
+	content, err := asn1.Marshal(pe.SpcIndirectDataContent{
+		Data: pe.SpcAttributeTypeAndOptionalValue{
+			Type:  pe.OIDSPC_PE_IMAGE_DATA_OBJID,
+			Value: pe.SpcPeImageData{File: asn1.RawValue{Class: 2, Tag: 0, IsCompound: true}},
+		},
+		MessageDigest: pe.DigestInfo{
+			DigestAlgorithm: pkix.AlgorithmIdentifier{Algorithm: pkcs7.OIDDigestAlgorithmSHA256},
+			Digest:          digest,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal indirect data: %v", err)
+	}
+	return content
+}
+
+// authenticodeHash returns the SHA-256 Authenticode hash of image, as go-pe
+// computes it
+func authenticodeHash(t *testing.T, image []byte) []byte {
+	t.Helper()
+
+	peFile, err := pe.NewPEFile(bytes.NewReader(image))
+	if err != nil {
+		t.Fatalf("Failed to parse test PE: %v", err)
+	}
+	return peFile.CalcHash().SHA256.Sum(nil)
+}
+
+// signPE appends the Authenticode signature of image by s to it
+func (s *testSigner) signPE(t *testing.T, image []byte) []byte {
+	t.Helper()
+
+	signed := s.sign(t, pe.OIDIndirectData, indirectData(t, authenticodeHash(t, image)))
+	certificate := make([]byte, 8, 8+len(signed)+7)
+	certificate = append(certificate, signed...)
+	certificate = append(certificate, make([]byte, (8-len(certificate)%8)%8)...)
+	binary.LittleEndian.PutUint32(certificate[0:], uint32(len(certificate)))
+	binary.LittleEndian.PutUint16(certificate[4:], 0x0200)
+	binary.LittleEndian.PutUint16(certificate[6:], 2)
+
+	image = append(append([]byte{}, image...), certificate...)
+	setTestDirectory(image, securityDirectory, uint32(len(image)-len(certificate)), uint32(len(certificate)))
+	return image
+}
+
+// signCatalog returns a catalog by s listing the SHA-256 Authenticode
+// hashes of images
+func (s *testSigner) signCatalog(t *testing.T, images ...[]byte) []byte {
+	t.Helper()
+
+	var members []pe.CatalogList
+	for _, image := range images {
+		digest := authenticodeHash(t, image)
+		members = append(members, pe.CatalogList{
+			Digest: catalogTag(digest),
+			Members: []asn1.RawValue{{FullBytes: mustMarshal(t, pe.CatalogMemberSet{
+				Type:  pe.OIDIndirectData,
+				Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: indirectData(t, digest)},
+			})}},
+		})
+	}
+
+	ctl := mustMarshal(t, pe.CertificateTrustList{
+		Type:        pe.OIDSequence{Type: pe.OIDCatalogList},
+		Digest:      []byte{1},
+		Time:        time.Now().UTC().Truncate(time.Second),
+		MemberOID:   pe.OIDSequence{Type: pe.OID_CATALOG_LIST_MEMBER_V2},
+		CatalogList: members,
+	})
+	return s.sign(t, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 1}, ctl)
+}
+
+// catalogTag returns the tag a catalog lists a file by: its hash as
+// uppercase hex, in UTF-16
+func catalogTag(digest []byte) []byte {
+	tag := utf16String(strings.ToUpper(hex.EncodeToString(digest)))
+	return tag[:len(tag)-2]
+}
+
+func mustMarshal(t *testing.T, val any) []byte {
+	t.Helper()
+
+	der, err := asn1.Marshal(val)
+	if err != nil {
+		t.Fatalf("Failed to marshal %T: %v", val, err)
+	}
+	return der
+}
+
+func parseTestPE(t *testing.T, image []byte) *peImage {
+	t.Helper()
+
+	img, err := newPEImage(bytes.NewReader(image))
+	if err != nil {
+		t.Fatalf("Failed to parse test PE: %v", err)
+	}
+	return img
+}
+
+func TestSignatureOf(t *testing.T) {
+	vendor := newTestSigner(t, "Vendor Code Signing")
+	other := newTestSigner(t, "Other Code Signing")
+	thumbprint := sha1.Sum(vendor.cert.Raw)
+
+	image := testPE(".text", []byte("code"))
+	signed := vendor.signPE(t, image)
+	tampered := append([]byte{}, signed...)
+	tampered[0x200] = 'C'
+
+	trusted := x509.NewCertPool()
+	trusted.AddCert(vendor.root)
+	untrusted := x509.NewCertPool()
+	untrusted.AddCert(other.root)
+
+	tests := []struct {
+		name     string
+		image    []byte
+		roots    *x509.CertPool
+		expected Signature
+	}{
+		{
+			name:     "Unsigned",
+			image:    image,
+			roots:    trusted,
+			expected: Signature{},
+		},
+		{
+			name:  "Signed by a trusted root",
+			image: signed,
+			roots: trusted,
+			expected: Signature{
+				Signed:      true,
+				Subject:     "CN=Vendor Code Signing,O=Vendor\\, Inc.",
+				Issuer:      "CN=Vendor Code Signing Root",
+				Thumbprint:  hex.EncodeToString(thumbprint[:]),
+				HashMatches: true,
+				Verified:    true,
+			},
+		},
+		{
+			name:  "Signed by an untrusted root",
+			image: signed,
+			roots: untrusted,
+			expected: Signature{
+				Signed:      true,
+				Subject:     "CN=Vendor Code Signing,O=Vendor\\, Inc.",
+				Issuer:      "CN=Vendor Code Signing Root",
+				Thumbprint:  hex.EncodeToString(thumbprint[:]),
+				HashMatches: true,
+			},
+		},
+		{
+			name:  "Modified after signing",
+			image: tampered,
+			roots: trusted,
+			expected: Signature{
+				Signed:     true,
+				Subject:    "CN=Vendor Code Signing,O=Vendor\\, Inc.",
+				Issuer:     "CN=Vendor Code Signing Root",
+				Thumbprint: hex.EncodeToString(thumbprint[:]),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trustedRoots = test.roots
+			defer func() { trustedRoots = nil }()
+
+			sig := signatureOf(parseTestPE(t, test.image))
+			if *sig != test.expected {
+				t.Errorf("Expected signature %+v, got %+v", test.expected, *sig)
+			}
+		})
+	}
+}
+
+func TestLoadCatalogs(t *testing.T) {
+	mount := useTestVolume(t)
+	microsoft := newTestSigner(t, "Microsoft Windows")
+	trustedRoots = x509.NewCertPool()
+	trustedRoots.AddCert(microsoft.root)
+
+	listed := testPE(".text", []byte("listed"))
+	unlisted := testPE(".text", []byte("unlisted"))
+
+	dir := filepath.Join(mount, "Windows", "System32", "CatRoot", "{F750E6C3-38EE-11D1-85E5-00C04FC295EE}")
+	os.MkdirAll(dir, 0o755)
+	err := os.WriteFile(filepath.Join(dir, "Microsoft-Windows-Client.cat"), microsoft.signCatalog(t, listed), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write catalog: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "broken.cat"), []byte("not a catalog"), 0o644)
+
+	LoadCatalogs()
+
+	sig := signatureOf(parseTestPE(t, listed))
+	if !sig.Signed || !sig.Verified || !sig.HashMatches || sig.Issuer != "CN=Microsoft Windows Root" {
+		t.Errorf("Expected a verified catalog signature, got %+v", *sig)
+	}
+	catalog := "c:/windows/system32/catroot/{f750e6c3-38ee-11d1-85e5-00c04fc295ee}/microsoft-windows-client.cat"
+	if sig.Catalog != catalog {
+		t.Errorf("Expected catalog %s, got %s", catalog, sig.Catalog)
+	}
+
+	if sig := signatureOf(parseTestPE(t, unlisted)); sig.Signed {
+		t.Errorf("Expected files missing from catalogs to be unsigned, got %+v", *sig)
+	}
+}
+
+func TestCatalogMemberHashes(t *testing.T) {
+	digest := bytes.Repeat([]byte{0xab, 0x01}, 16)
+	indirect := asn1.RawValue{FullBytes: mustMarshal(t, pe.CatalogMemberSet{
+		Type:  pe.OIDIndirectData,
+		Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: indirectData(t, digest)},
+	})}
+
+	tests := []struct {
+		name   string
+		member pe.CatalogList
+		want   int
+	}{
+		{"Tags are decoded from UTF-16 hex", pe.CatalogList{Digest: catalogTag(digest)}, 1},
+		{"Terminated tags are decoded", pe.CatalogList{Digest: append(catalogTag(digest), 0, 0)}, 1},
+		{"Tags naming a file are skipped", pe.CatalogList{Digest: utf16String("ntdll.dll")}, 0},
+		{"Indirect data digests are listed", pe.CatalogList{Digest: catalogTag(digest), Members: []asn1.RawValue{indirect}}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hashes := catalogMemberHashes(tt.member)
+			if len(hashes) != tt.want {
+				t.Fatalf("Expected %d hashes, got %x", tt.want, hashes)
+			}
+			for _, hash := range hashes {
+				if !bytes.Equal(hash, digest) {
+					t.Errorf("Expected hash %x, got %x", digest, hash)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadRootStore(t *testing.T) {
+	mount := useTestVolume(t)
+	vendor := newTestSigner(t, "Vendor Code Signing")
+	other := newTestSigner(t, "Other Code Signing")
+
+	// the registry keeps certificates as a list of properties, the
+	// certificate itself among them
+	blob := func(cert *x509.Certificate) []byte {
+		var data []byte
+		for _, prop := range []struct {
+			id    uint32
+			value []byte
+		}{{3, make([]byte, 20)}, {certProperty, cert.Raw}} {
+			data = binary.LittleEndian.AppendUint32(data, prop.id)
+			data = binary.LittleEndian.AppendUint32(data, 1)
+			data = binary.LittleEndian.AppendUint32(data, uint32(len(prop.value)))
+			data = append(data, prop.value...)
+		}
+		return data
+	}
+
+	b := hivetest.New()
+	entry := b.Key("0123456789ABCDEF", nil, []uint32{b.Value("Blob", hive.BINARY, blob(vendor.root))})
+	certs := b.Key("Certificates", []uint32{entry}, nil)
+	root := b.Key("ROOT", []uint32{certs}, nil)
+	stores := b.Key("SystemCertificates", []uint32{root}, nil)
+	software := b.Key("ROOT", []uint32{b.Key("Microsoft", []uint32{stores}, nil)}, nil)
+	path := filepath.Join(mount, "Windows", "System32", "config", "SOFTWARE")
+	os.MkdirAll(filepath.Dir(path), 0o755)
+	if err := b.WriteFile(path, software); err != nil {
+		t.Fatalf("Failed to write hive: %v", err)
+	}
+
+	pemFile := filepath.Join(t.TempDir(), "roots.pem")
+	os.WriteFile(pemFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: other.root.Raw}), 0o644)
+
+	signed := vendor.signPE(t, testPE(".text", []byte("code")))
+
+	LoadRootStore("")
+	if sig := signatureOf(parseTestPE(t, signed)); !sig.Verified {
+		t.Errorf("Expected the offline root store to verify the signature, got %+v", *sig)
+	}
+
+	LoadRootStore(pemFile)
+	if sig := signatureOf(parseTestPE(t, signed)); sig.Verified {
+		t.Errorf("Expected the given root store to replace the host's, got %+v", *sig)
+	}
+}
+
+func TestCertFromBlob(t *testing.T) {
+	if _, err := certFromBlob([]byte{32, 0, 0, 0, 1, 0, 0, 0, 0xff, 0, 0, 0}); err == nil {
+		t.Error("Expected an error for a truncated blob")
+	}
+
+	blob := []byte{32, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 0x30, 0x00}
+	if der, err := certFromBlob(blob); err != nil || !bytes.Equal(der, []byte{0x30, 0x00}) {
+		t.Errorf("Expected the certificate property, got %x, %v", der, err)
+	}
+}
@@ -0,0 +1,94 @@
+package collectors
+
+import "slices"
+
+// the capabilities PEs are classified with, recorded as capabilities
+const (
+	CapRPCServer        = "rpc-server"        // serves RPC interfaces
+	CapRPCClient        = "rpc-client"        // binds to RPC servers
+	CapNamedPipeServer  = "named-pipe-server" // creates named pipes for clients to connect to
+	CapImpersonation    = "impersonation"     // takes on the security context of a client or user
+	CapProcessInjection = "process-injection" // writes and runs code in other processes
+	CapCredentialAccess = "credential-access" // reads stored credentials and secrets
+	CapNetworkListener  = "network-listener"  // accepts network connections
+	CapServiceControl   = "service-control"   // creates, changes or starts services
+	CapMemoryDump       = "memory-dump"       // writes minidumps of processes
+)
+
+// Capability is something a PE can do, recognized by its imports
+type Capability struct {
+	Name string
+
+	// Needs are sets of functions, as fn or dll!fn with a lowercased dll: a
+	// PE has the capability when it imports one function of every set
+	Needs [][]string
+}
+
+// Capabilities are the capabilities PEs are classified with. Classifying
+// with another means adding it here.
+var Capabilities = []Capability{
+	{CapRPCServer, [][]string{{
+		"RpcServerListen",
+		"RpcServerRegisterIf", "RpcServerRegisterIf2", "RpcServerRegisterIf3", "RpcServerRegisterIfEx",
+		"RpcServerUseProtseqA", "RpcServerUseProtseqW", "RpcServerUseProtseqEpA", "RpcServerUseProtseqEpW",
+	}}},
+	{CapRPCClient, [][]string{{
+		"RpcStringBindingComposeA", "RpcStringBindingComposeW",
+		"RpcBindingFromStringBindingA", "RpcBindingFromStringBindingW",
+		"NdrClientCall2", "NdrClientCall3", "Ndr64AsyncClientCall",
+	}}},
+	{CapNamedPipeServer, [][]string{{"CreateNamedPipeA", "CreateNamedPipeW"}}},
+	{CapImpersonation, [][]string{{
+		"ImpersonateNamedPipeClient", "ImpersonateLoggedOnUser", "ImpersonateSelf",
+		"ImpersonateAnonymousToken", "RpcImpersonateClient", "CoImpersonateClient", "SetThreadToken",
+	}}},
+	{CapProcessInjection, [][]string{
+		{"VirtualAllocEx", "VirtualAlloc2", "NtAllocateVirtualMemory", "NtMapViewOfSection"},
+		{"WriteProcessMemory", "NtWriteVirtualMemory", "NtMapViewOfSection"},
+		{
+			"CreateRemoteThread", "CreateRemoteThreadEx", "NtCreateThreadEx", "RtlCreateUserThread",
+			"QueueUserAPC", "NtQueueApcThread", "SetThreadContext", "NtSetContextThread",
+		},
+	}},
+	{CapCredentialAccess, [][]string{{
+		"CredEnumerateA", "CredEnumerateW", "CredReadA", "CredReadW", "CredReadDomainCredentialsW",
+		"CryptUnprotectData", "LsaRetrievePrivateData", "LsaEnumerateLogonSessions",
+		"SamConnect", "SamIConnect", "SamQueryInformationUser",
+	}}},
+	{CapNetworkListener, [][]string{{
+		// Winsock is mostly imported by ordinal: listen is #13 and accept #1
+		"ws2_32.dll!listen", "ws2_32.dll!#13", "ws2_32.dll!accept", "ws2_32.dll!#1", "WSAAccept",
+		"wsock32.dll!listen", "wsock32.dll!#13", "wsock32.dll!accept", "wsock32.dll!#1",
+		"AcceptEx", "HttpAddUrl", "HttpAddUrlToUrlGroup",
+	}}},
+	{CapServiceControl, [][]string{
+		{"OpenSCManagerA", "OpenSCManagerW"},
+		{
+			"CreateServiceA", "CreateServiceW", "ChangeServiceConfigA", "ChangeServiceConfigW",
+			"ChangeServiceConfig2A", "ChangeServiceConfig2W", "StartServiceA", "StartServiceW",
+			"ControlService", "ControlServiceExA", "ControlServiceExW", "DeleteService",
+		},
+	}},
+	{CapMemoryDump, [][]string{{"MiniDumpWriteDump"}}},
+}
+
+// capabilitiesOf returns the Capabilities of a PE from the functions its
+// report says it imports, statically or delay-loaded
+func capabilitiesOf(report *INode) []string {
+	imports := importsByDLL(report)
+	var capabilities []string
+	for _, capability := range Capabilities {
+		if len(capability.Needs) == 0 {
+			continue
+		}
+		has := !slices.ContainsFunc(capability.Needs, func(fns []string) bool {
+			return !slices.ContainsFunc(fns, func(fn string) bool {
+				return importsFunction(imports, fn)
+			})
+		})
+		if has {
+			capabilities = append(capabilities, capability.Name)
+		}
+	}
+	return capabilities
+}
@@ -0,0 +1,76 @@
+package collectors
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCapabilitiesOf(t *testing.T) {
+	deps := func(names ...string) []*Dep {
+		imports := make([]*Dep, len(names))
+		for n, name := range names {
+			imports[n] = &Dep{Name: name}
+		}
+		return imports
+	}
+
+	tests := []struct {
+		name     string
+		imports  []*Dep
+		delayed  []*Dep
+		expected []string
+	}{
+		{
+			name:     "RPC servers that impersonate their clients",
+			imports:  deps("rpcrt4.dll!RpcServerListen", "rpcrt4.dll!RpcImpersonateClient"),
+			expected: []string{CapRPCServer, CapImpersonation},
+		},
+		{
+			name:     "Named pipe servers",
+			imports:  deps("kernel32.dll!CreateNamedPipeW", "advapi32.dll!ImpersonateNamedPipeClient"),
+			expected: []string{CapNamedPipeServer, CapImpersonation},
+		},
+		{
+			name:     "Injection needs allocating, writing and running",
+			imports:  deps("kernel32.dll!VirtualAllocEx", "kernel32.dll!WriteProcessMemory", "kernel32.dll!CreateRemoteThread"),
+			expected: []string{CapProcessInjection},
+		},
+		{
+			name:    "Writing to a process alone isn't injection",
+			imports: deps("kernel32.dll!VirtualAllocEx", "kernel32.dll!WriteProcessMemory"),
+		},
+		{
+			name:     "Winsock imported by ordinal",
+			imports:  deps("ws2_32.dll!0xd", "ws2_32.dll!0x17"),
+			expected: []string{CapNetworkListener},
+		},
+		{
+			name:    "Qualified functions only match their DLL",
+			imports: deps("vendor.dll!listen"),
+		},
+		{
+			name:     "Delay-loaded imports count",
+			imports:  deps("advapi32.dll!OpenSCManagerW"),
+			delayed:  deps("advapi32.dll!CreateServiceW", "dbghelp.dll!MiniDumpWriteDump"),
+			expected: []string{CapServiceControl, CapMemoryDump},
+		},
+		{
+			name:     "Credential access",
+			imports:  deps("crypt32.dll!CryptUnprotectData", "rpcrt4.dll!NdrClientCall3"),
+			expected: []string{CapRPCClient, CapCredentialAccess},
+		},
+		{
+			name: "No imports",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := &INode{Imports: test.imports, DelayImports: test.delayed}
+			capabilities := capabilitiesOf(report)
+			if !slices.Equal(capabilities, test.expected) {
+				t.Errorf("Expected capabilities %v, got %v", test.expected, capabilities)
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package collectors
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"slices"
+	"strings"
+)
+
+// maxMetadata bounds the CLR metadata read from a damaged or hostile image
+const maxMetadata = 16 << 20
+
+// metadata tables, by number, as laid out in ECMA-335 II.22
+const (
+	tModule                 = 0x00
+	tTypeRef                = 0x01
+	tTypeDef                = 0x02
+	tField                  = 0x04
+	tMethodDef              = 0x06
+	tParam                  = 0x08
+	tInterfaceImpl          = 0x09
+	tMemberRef              = 0x0a
+	tDeclSecurity           = 0x0e
+	tStandAloneSig          = 0x11
+	tEvent                  = 0x14
+	tProperty               = 0x17
+	tModuleRef              = 0x1a
+	tTypeSpec               = 0x1b
+	tAssembly               = 0x20
+	tAssemblyRef            = 0x23
+	tFile                   = 0x26
+	tExportedType           = 0x27
+	tManifestResource       = 0x28
+	tGenericParam           = 0x2a
+	tMethodSpec             = 0x2b
+	tGenericParamConstraint = 0x2c
+)
+
+// column kinds of metadata tables: fixed sizes in bytes, heap indexes, and
+// indexes into one table or, coded, into one of several
+const (
+	cString = -1 - iota
+	cGUID
+	cBlob
+	cTypeDefOrRef
+	cHasConstant
+	cHasCustomAttribute
+	cHasFieldMarshal
+	cHasDeclSecurity
+	cMemberRefParent
+	cHasSemantics
+	cMethodDefOrRef
+	cMemberForwarded
+	cImplementation
+	cCustomAttributeType
+	cResolutionScope
+)
+
+// cTable is added to a table number for a column indexing that table
+const cTable = 0x100
+
+// codedIndexes lists the tables each coded index can point into
+var codedIndexes = map[int][]int{
+	cTypeDefOrRef: {tTypeDef, tTypeRef, tTypeSpec},
+	cHasConstant:  {tField, tParam, tProperty},
+	cHasCustomAttribute: {
+		tMethodDef, tField, tTypeRef, tTypeDef, tParam, tInterfaceImpl, tMemberRef,
+		tModule, tDeclSecurity, tProperty, tEvent, tStandAloneSig, tModuleRef, tTypeSpec,
+		tAssembly, tAssemblyRef, tFile, tExportedType, tManifestResource, tGenericParam,
+		tGenericParamConstraint, tMethodSpec,
+	},
+	cHasFieldMarshal:     {tField, tParam},
+	cHasDeclSecurity:     {tTypeDef, tMethodDef, tAssembly},
+	cMemberRefParent:     {tTypeDef, tTypeRef, tModuleRef, tMethodDef, tTypeSpec},
+	cHasSemantics:        {tEvent, tProperty},
+	cMethodDefOrRef:      {tMethodDef, tMemberRef},
+	cMemberForwarded:     {tField, tMethodDef},
+	cImplementation:      {tFile, tAssemblyRef, tExportedType},
+	cCustomAttributeType: {-1, -1, tMethodDef, tMemberRef, -1},
+	cResolutionScope:     {tModule, tModuleRef, tAssemblyRef, tTypeRef},
+}
+
+// tableColumns are the columns of the tables up to AssemblyRef, which are
+// all that need sizing to reach it
+var tableColumns = [tAssemblyRef + 1][]int{
+	0x00: {2, cString, cGUID, cGUID, cGUID},
+	0x01: {cResolutionScope, cString, cString},
+	0x02: {4, cString, cString, cTypeDefOrRef, cTable + tField, cTable + tMethodDef},
+	0x03: {cTable + tField},
+	0x04: {2, cString, cBlob},
+	0x05: {cTable + tMethodDef},
+	0x06: {4, 2, 2, cString, cBlob, cTable + tParam},
+	0x07: {cTable + tParam},
+	0x08: {2, 2, cString},
+	0x09: {cTable + tTypeDef, cTypeDefOrRef},
+	0x0a: {cMemberRefParent, cString, cBlob},
+	0x0b: {2, cHasConstant, cBlob},
+	0x0c: {cHasCustomAttribute, cCustomAttributeType, cBlob},
+	0x0d: {cHasFieldMarshal, cBlob},
+	0x0e: {2, cHasDeclSecurity, cBlob},
+	0x0f: {2, 4, cTable + tTypeDef},
+	0x10: {4, cTable + tField},
+	0x11: {cBlob},
+	0x12: {cTable + tTypeDef, cTable + tEvent},
+	0x13: {cTable + tEvent},
+	0x14: {2, cString, cTypeDefOrRef},
+	0x15: {cTable + tTypeDef, cTable + tProperty},
+	0x16: {cTable + tProperty},
+	0x17: {2, cString, cBlob},
+	0x18: {2, cTable + tMethodDef, cHasSemantics},
+	0x19: {cTable + tTypeDef, cMethodDefOrRef, cMethodDefOrRef},
+	0x1a: {cString},
+	0x1b: {cBlob},
+	0x1c: {2, cMemberForwarded, cString, cTable + tModuleRef},
+	0x1d: {4, cTable + tField},
+	0x1e: {4, 4},
+	0x1f: {4},
+	0x20: {4, 2, 2, 2, 2, 4, cBlob, cString, cString},
+	0x21: {4},
+	0x22: {4, 4, 4},
+	0x23: {2, 2, 2, 2, 4, cBlob, cString, cString, cBlob},
+}
+
+// AssemblyRef is a managed assembly referenced by a .NET image
+type AssemblyRef struct {
+	Name           string `json:"Name"`
+	Version        string `json:"Version"`
+	Culture        string `json:"Culture"`
+	PublicKeyToken string `json:"PublicKeyToken"` // empty for assemblies without a strong name
+}
+
+// metadataTables is the #~ stream of CLR metadata, with the heaps its
+// columns index into
+type metadataTables struct {
+	data     []byte
+	rows     [64]uint32
+	offsets  [64]int // where each table starts in data
+	heapSize byte
+	strings  []byte
+	blobs    []byte
+}
+
+// assemblyRefs returns the managed assemblies referenced by the image, or
+// none when it isn't a .NET image
+func (img *peImage) assemblyRefs() ([]AssemblyRef, error) {
+	clr := img.directory(clrDirectory)
+	if clr.VirtualAddress == 0 || clr.Size < 16 {
+		return nil, nil
+	}
+
+	header, err := img.readRVA(clr.VirtualAddress, 16)
+	if err != nil {
+		return nil, err
+	}
+	rva, size := binary.LittleEndian.Uint32(header[8:]), binary.LittleEndian.Uint32(header[12:])
+	if size > maxMetadata {
+		return nil, fmt.Errorf("metadata of %d bytes is too large", size)
+	}
+	metadata, err := img.readRVA(rva, size)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := parseMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+	return tables.assemblyRefs()
+}
+
+// parseMetadata reads the streams of the CLR metadata root in data
+func parseMetadata(data []byte) (*metadataTables, error) {
+	le := binary.LittleEndian
+	if len(data) < 16 || string(data[:4]) != "BSJB" {
+		return nil, errors.New("no metadata signature")
+	}
+
+	// the version string is padded to 4 bytes
+	offset := 16 + int(le.Uint32(data[12:]))
+	if offset+4 > len(data) {
+		return nil, errors.New("metadata root truncated")
+	}
+	count := int(le.Uint16(data[offset+2:]))
+	offset += 4
+
+	t := &metadataTables{}
+	for range count {
+		if offset+8 > len(data) {
+			return nil, errors.New("stream headers truncated")
+		}
+		start, size := int(le.Uint32(data[offset:])), int(le.Uint32(data[offset+4:]))
+		name, _, _ := bytes.Cut(data[offset+8:min(offset+8+32, len(data))], []byte{0})
+		offset += 8 + (len(name)+4)&^3
+		if start < 0 || size < 0 || start+size > len(data) {
+			return nil, fmt.Errorf("stream %s is outside of the metadata", name)
+		}
+
+		stream := data[start : start+size]
+		switch string(name) {
+		case "#~", "#-":
+			t.data = stream
+		case "#Strings":
+			t.strings = stream
+		case "#Blob":
+			t.blobs = stream
+		}
+	}
+	if t.data == nil {
+		return nil, errors.New("no metadata tables")
+	}
+	return t, t.layout()
+}
+
+// layout reads the row counts of the tables and works out where each starts
+func (t *metadataTables) layout() error {
+	le := binary.LittleEndian
+	if len(t.data) < 24 {
+		return errors.New("metadata tables truncated")
+	}
+	t.heapSize = t.data[6]
+	valid := le.Uint64(t.data[8:])
+
+	offset := 24
+	for table := range 64 {
+		if valid&(1<<table) == 0 {
+			continue
+		}
+		if offset+4 > len(t.data) {
+			return errors.New("row counts truncated")
+		}
+		t.rows[table] = le.Uint32(t.data[offset:])
+		offset += 4
+	}
+
+	// uncompressed streams may carry 4 extra bytes before the tables
+	if t.heapSize&0x40 != 0 {
+		offset += 4
+	}
+
+	for table := range tAssemblyRef + 1 {
+		t.offsets[table] = offset
+		offset += int(t.rows[table]) * t.rowSize(table)
+		if offset > len(t.data) {
+			return fmt.Errorf("table %#x is outside of the stream", table)
+		}
+	}
+	return nil
+}
+
+// rowSize returns the size in bytes of a row of table
+func (t *metadataTables) rowSize(table int) int {
+	size := 0
+	for _, column := range tableColumns[table] {
+		size += t.columnSize(column)
+	}
+	return size
+}
+
+// columnSize returns the size in bytes of a column, which depends on the
+// size of the heaps and tables it indexes
+func (t *metadataTables) columnSize(column int) int {
+	switch {
+	case column >= cTable:
+		if t.rows[column-cTable] > 0xffff {
+			return 4
+		}
+		return 2
+	case column > 0:
+		return column
+	case column == cString:
+		return 2 + 2*int(t.heapSize&0x01)
+	case column == cGUID:
+		return 2 + int(t.heapSize&0x02)
+	case column == cBlob:
+		return 2 + int(t.heapSize&0x04)>>1
+	}
+
+	tables := codedIndexes[column]
+	tagBits := bits.Len(uint(len(tables) - 1))
+	for _, table := range tables {
+		if table >= 0 && t.rows[table] >= 1<<(16-tagBits) {
+			return 4
+		}
+	}
+	return 2
+}
+
+// assemblyRefs reads the AssemblyRef table
+func (t *metadataTables) assemblyRefs() ([]AssemblyRef, error) {
+	var refs []AssemblyRef
+	rowSize := t.rowSize(tAssemblyRef)
+	for row := range int(t.rows[tAssemblyRef]) {
+		data := t.data[t.offsets[tAssemblyRef]+row*rowSize:]
+		le := binary.LittleEndian
+
+		var columns []uint32
+		offset := 0
+		for _, column := range tableColumns[tAssemblyRef] {
+			size := t.columnSize(column)
+			if size == 4 {
+				columns = append(columns, le.Uint32(data[offset:]))
+			} else {
+				columns = append(columns, uint32(le.Uint16(data[offset:])))
+			}
+			offset += size
+		}
+
+		name, err := t.string(columns[6])
+		if err != nil {
+			return nil, err
+		}
+		culture, err := t.string(columns[7])
+		if err != nil {
+			return nil, err
+		}
+		key, err := t.blob(columns[5])
+		if err != nil {
+			return nil, err
+		}
+
+		// a full public key is turned into its token, the last 8
+		// bytes of its SHA-1 in reverse
+		const publicKey = 0x0001
+		if columns[4]&publicKey != 0 && len(key) > 0 {
+			sum := sha1.Sum(key)
+			key = sum[len(sum)-8:]
+			slices.Reverse(key)
+		}
+
+		refs = append(refs, AssemblyRef{
+			Name:           name,
+			Version:        fmt.Sprintf("%d.%d.%d.%d", columns[0], columns[1], columns[2], columns[3]),
+			Culture:        culture,
+			PublicKeyToken: hex.EncodeToString(key),
+		})
+	}
+	return refs, nil
+}
+
+// string reads the NUL-terminated string at index of the #Strings heap
+func (t *metadataTables) string(index uint32) (string, error) {
+	if int(index) >= len(t.strings) {
+		if index == 0 {
+			return "", nil
+		}
+		return "", fmt.Errorf("string %#x is outside of the heap", index)
+	}
+	s, _, _ := strings.Cut(string(t.strings[index:]), "\x00")
+	return s, nil
+}
+
+// blob reads the length-prefixed blob at index of the #Blob heap
+func (t *metadataTables) blob(index uint32) ([]byte, error) {
+	if index == 0 {
+		return nil, nil
+	}
+	if int(index) >= len(t.blobs) {
+		return nil, fmt.Errorf("blob %#x is outside of the heap", index)
+	}
+
+	// lengths are compressed into 1, 2 or 4 bytes by their top bits
+	data := t.blobs[index:]
+	var length, prefix int
+	switch {
+	case data[0]&0x80 == 0:
+		length, prefix = int(data[0]), 1
+	case data[0]&0xc0 == 0x80 && len(data) >= 2:
+		length, prefix = int(binary.BigEndian.Uint16(data)&0x3fff), 2
+	case data[0]&0xe0 == 0xc0 && len(data) >= 4:
+		length, prefix = int(binary.BigEndian.Uint32(data)&0x1fffffff), 4
+	default:
+		return nil, fmt.Errorf("blob %#x has a malformed length", index)
+	}
+	if prefix+length > len(data) {
+		return nil, fmt.Errorf("blob %#x is outside of the heap", index)
+	}
+	return data[prefix : prefix+length], nil
+}
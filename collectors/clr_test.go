@@ -0,0 +1,196 @@
+package collectors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+// testRef is an AssemblyRef row of test metadata, with either a public key
+// or its token
+type testRef struct {
+	name, culture string
+	version       [4]uint16
+	key           []byte
+	fullKey       bool
+}
+
+// testMetadata builds CLR metadata with a Module, two TypeRefs ahead of
+// refs, and 4-byte heap indexes when wide
+func testMetadata(refs []testRef, wide bool) []byte {
+	le := binary.LittleEndian
+	strs := []byte{0}
+	str := func(s string) uint32 {
+		if s == "" {
+			return 0
+		}
+		offset := uint32(len(strs))
+		strs = append(append(strs, s...), 0)
+		return offset
+	}
+	blobs := []byte{0}
+	blob := func(b []byte) uint32 {
+		if len(b) == 0 {
+			return 0
+		}
+		offset := uint32(len(blobs))
+		blobs = append(append(blobs, byte(len(b))), b...)
+		return offset
+	}
+
+	var tables []byte
+	index := func(n uint32) {
+		if wide {
+			tables = le.AppendUint32(tables, n)
+		} else {
+			tables = le.AppendUint16(tables, uint16(n))
+		}
+	}
+
+	// Module: generation, name, and 3 GUIDs
+	tables = le.AppendUint16(tables, 0)
+	index(str("App.exe"))
+	index(1)
+	index(0)
+	index(0)
+
+	// TypeRef: resolution scope, name, namespace
+	for _, name := range []string{"Object", "Console"} {
+		tables = le.AppendUint16(tables, 0x6)
+		index(str(name))
+		index(str("System"))
+	}
+
+	for _, ref := range refs {
+		for _, part := range ref.version {
+			tables = le.AppendUint16(tables, part)
+		}
+		flags := uint32(0)
+		if ref.fullKey {
+			flags = 1
+		}
+		tables = le.AppendUint32(tables, flags)
+		index(blob(ref.key))
+		index(str(ref.name))
+		index(str(ref.culture))
+		index(0)
+	}
+
+	heapSizes := byte(0)
+	if wide {
+		heapSizes = 0x07
+	}
+	stream := make([]byte, 24)
+	stream[4] = 2
+	stream[6] = heapSizes
+	le.PutUint64(stream[8:], 1<<tModule|1<<tTypeRef|1<<tAssemblyRef)
+	stream = le.AppendUint32(stream, 1)
+	stream = le.AppendUint32(stream, 2)
+	stream = le.AppendUint32(stream, uint32(len(refs)))
+	stream = append(stream, tables...)
+
+	pad := func(b []byte) []byte {
+		return append(b, make([]byte, (4-len(b)%4)%4)...)
+	}
+	streams := []struct {
+		name string
+		data []byte
+	}{{"#~", pad(stream)}, {"#Strings", pad(strs)}, {"#Blob", pad(blobs)}}
+
+	version := pad([]byte("v4.0.30319\x00"))
+	root := []byte("BSJB")
+	root = le.AppendUint16(root, 1)
+	root = le.AppendUint16(root, 1)
+	root = le.AppendUint32(root, 0)
+	root = le.AppendUint32(root, uint32(len(version)))
+	root = append(root, version...)
+	root = le.AppendUint16(root, 0)
+	root = le.AppendUint16(root, uint16(len(streams)))
+
+	headersSize := 0
+	for _, s := range streams {
+		headersSize += 8 + len(pad([]byte(s.name+"\x00")))
+	}
+	offset := len(root) + headersSize
+	var data []byte
+	for _, s := range streams {
+		root = le.AppendUint32(root, uint32(offset))
+		root = le.AppendUint32(root, uint32(len(s.data)))
+		root = append(root, pad([]byte(s.name+"\x00"))...)
+		offset += len(s.data)
+		data = append(data, s.data...)
+	}
+	return append(root, data...)
+}
+
+// testDotNetPE builds a PE with metadata as its CLR metadata
+func testDotNetPE(metadata []byte) []byte {
+	const rva = 0x1000
+	header := make([]byte, 72)
+	binary.LittleEndian.PutUint32(header[0:], 72)
+	binary.LittleEndian.PutUint32(header[8:], rva+72)
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(metadata)))
+
+	image := testPE(".text", append(header, metadata...))
+	setTestDirectory(image, clrDirectory, rva, 72)
+	return image
+}
+
+func TestAssemblyRefs(t *testing.T) {
+	// the ECMA standard public key, whose token is that of mscorlib
+	ecmaKey := make([]byte, 16)
+	ecmaKey[8] = 4
+
+	refs := []testRef{
+		{name: "mscorlib", version: [4]uint16{4, 0, 0, 0}, key: ecmaKey, fullKey: true},
+		{name: "Vendor.Core", version: [4]uint16{1, 2, 3, 4}},
+		{name: "Vendor.Strings", culture: "fr-FR", version: [4]uint16{1, 0, 0, 0}, key: []byte{0xde, 0xad, 0xbe, 0xef, 0, 1, 2, 3}},
+	}
+	expected := []AssemblyRef{
+		{Name: "mscorlib", Version: "4.0.0.0", PublicKeyToken: "b77a5c561934e089"},
+		{Name: "Vendor.Core", Version: "1.2.3.4"},
+		{Name: "Vendor.Strings", Version: "1.0.0.0", Culture: "fr-FR", PublicKeyToken: "deadbeef00010203"},
+	}
+
+	for _, wide := range []bool{false, true} {
+		name := "2-byte heap indexes"
+		if wide {
+			name = "4-byte heap indexes"
+		}
+		t.Run(name, func(t *testing.T) {
+			img, err := newPEImage(bytes.NewReader(testDotNetPE(testMetadata(refs, wide))))
+			if err != nil {
+				t.Fatalf("Failed to parse test PE: %v", err)
+			}
+			got, err := img.assemblyRefs()
+			if err != nil {
+				t.Fatalf("Failed to read assembly references: %v", err)
+			}
+			if !slices.Equal(got, expected) {
+				t.Errorf("Expected %+v, got %+v", expected, got)
+			}
+		})
+	}
+
+	t.Run("Native images have none", func(t *testing.T) {
+		img, err := newPEImage(bytes.NewReader(testPE(".text", nil)))
+		if err != nil {
+			t.Fatalf("Failed to parse test PE: %v", err)
+		}
+		if refs, err := img.assemblyRefs(); refs != nil || err != nil {
+			t.Errorf("Expected no references, got %+v, %v", refs, err)
+		}
+	})
+
+	t.Run("Truncated metadata is rejected", func(t *testing.T) {
+		metadata := testMetadata(refs, false)
+		img, err := newPEImage(bytes.NewReader(testDotNetPE(metadata[:len(metadata)-40])))
+		if err != nil {
+			t.Fatalf("Failed to parse test PE: %v", err)
+		}
+		if _, err := img.assemblyRefs(); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package collectors
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// maxHashedSize bounds how much of a file is read to hash its content
+const maxHashedSize = 512 << 20
+
+// fileSHA256 returns the SHA-256 of the file at path on the collecting host.
+// Files larger than maxHashedSize aren't hashed.
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, io.LimitReader(file, maxHashedSize+1))
+	if err != nil {
+		return "", err
+	}
+	if n > maxHashedSize {
+		return "", fmt.Errorf("larger than %d bytes", maxHashedSize)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// impHash returns the import hash of a PE's static dll!function imports,
+// as computed by pefile: the MD5 of the lowercased dll.function list, with
+// the extension of the DLL dropped and ordinals written as ordN. Ordinals
+// aren't looked up by name for the few DLLs pefile knows the exports of.
+func impHash(imports []*Dep) string {
+	if len(imports) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(imports))
+	for _, imp := range imports {
+		dll, fn, _ := strings.Cut(strings.ToLower(imp.Name), "!")
+		switch ext := path.Ext(dll); ext {
+		case ".dll", ".ocx", ".sys":
+			dll = strings.TrimSuffix(dll, ext)
+		}
+		if ordinal, ok := strings.CutPrefix(importedFunction(fn), "#"); ok {
+			fn = "ord" + ordinal
+		}
+		names = append(names, dll+"."+fn)
+	}
+	sum := md5.Sum([]byte(strings.Join(names, ",")))
+	return hex.EncodeToString(sum[:])
+}
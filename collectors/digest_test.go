@@ -0,0 +1,54 @@
+package collectors
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSHA256(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.exe")
+	if err := os.WriteFile(path, []byte("abc"), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	sum, err := fileSHA256(path)
+	if err != nil {
+		t.Fatalf("Failed to hash file: %v", err)
+	}
+	expected := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if sum != expected {
+		t.Errorf("Expected %s, got %s", expected, sum)
+	}
+
+	t.Run("Files too large aren't hashed", func(t *testing.T) {
+		large := filepath.Join(t.TempDir(), "large.dll")
+		if err := os.WriteFile(large, nil, 0o644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+		if err := os.Truncate(large, maxHashedSize+1); err != nil {
+			t.Skipf("Sparse files unsupported: %v", err)
+		}
+		if sum, err := fileSHA256(large); err == nil {
+			t.Errorf("Expected an error, got %s", sum)
+		}
+	})
+}
+
+func TestImpHash(t *testing.T) {
+	imports := []*Dep{
+		{Name: "kernel32.dll!CreateFileW"},
+		{Name: "ADVAPI32.dll!RegOpenKeyExW"},
+		{Name: "msvcrt.DLL!printf"},
+		{Name: "ws2_32.dll!0x17"},
+		{Name: "vendor.plugin.ocx!Run"},
+	}
+	expected := "cddeda70f300a0240228676bc199280f"
+	if sum := impHash(imports); sum != expected {
+		t.Errorf("Expected %s, got %s", expected, sum)
+	}
+
+	if sum := impHash(nil); sum != "" {
+		t.Errorf("Expected no import hash without imports, got %s", sum)
+	}
+}
@@ -0,0 +1,109 @@
+package collectors
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/audibleblink/lpegopher/util"
+)
+
+// DynamicImport is the kind of dependency on a DLL whose name is only found
+// among the strings of a PE that loads libraries at run time. It's a guess,
+// so less certain than other kinds.
+const DynamicImport = "dynamic"
+
+// maxScannedSection bounds the data scanned for library names in a section
+const maxScannedSection = 32 << 20
+
+// libraryLoaders are the functions that load a library by a name the
+// caller passes
+var libraryLoaders = []string{
+	"LoadLibraryA", "LoadLibraryW", "LoadLibraryExA", "LoadLibraryExW", "LoadPackagedLibrary",
+}
+
+// dataSections are the sections scanned for library names
+var dataSections = []string{".rdata", ".data"}
+
+// libraryName matches the bare names of the files LoadLibrary is passed
+var libraryName = regexp.MustCompile(`(?i)^[\w.\-]{1,64}\.(dll|exe|sys)$`)
+
+// dynamicImports returns the lowercased names of libraries found as ASCII or
+// UTF-16 strings in the data sections of an image that imports a library
+// loader, leaving out those it imports. delayed are its delay-load imports.
+func (img *peImage) dynamicImports(delayed []string) ([]string, error) {
+	symbols, err := img.ImportedSymbols()
+	if err != nil {
+		return nil, err
+	}
+	imported := map[string]bool{}
+	loads := false
+	for _, symbol := range symbols {
+		fn, dll, _ := strings.Cut(symbol, ":")
+		imported[util.Lower(dll)] = true
+		loads = loads || slices.Contains(libraryLoaders, fn)
+	}
+	for _, imp := range delayed {
+		dll, fn, _ := strings.Cut(imp, "!")
+		imported[dll] = true
+		loads = loads || slices.Contains(libraryLoaders, fn)
+	}
+	if !loads {
+		return nil, nil
+	}
+
+	var names []string
+	for _, s := range img.Sections {
+		if !slices.Contains(dataSections, s.Name) {
+			continue
+		}
+		data := make([]byte, min(s.Size, maxScannedSection))
+		if _, err := s.ReadAt(data, 0); err != nil {
+			return nil, err
+		}
+		for _, name := range libraryNames(data) {
+			if !imported[name] && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// libraryNames returns the lowercased library names among the ASCII and
+// UTF-16 strings of data
+func libraryNames(data []byte) []string {
+	var names []string
+	check := func(s []byte) {
+		if libraryName.Match(s) {
+			names = append(names, util.Lower(string(s)))
+		}
+	}
+	printable := func(b byte) bool {
+		return b >= 0x20 && b < 0x7f
+	}
+
+	var run []byte
+	for _, b := range data {
+		if printable(b) {
+			run = append(run, b)
+			continue
+		}
+		check(run)
+		run = run[:0]
+	}
+	check(run)
+
+	// UTF-16 strings of the same characters, at even offsets
+	run = run[:0]
+	for i := 0; i+1 < len(data); i += 2 {
+		if printable(data[i]) && data[i+1] == 0 {
+			run = append(run, data[i])
+			continue
+		}
+		check(run)
+		run = run[:0]
+	}
+	check(run)
+	return names
+}
@@ -0,0 +1,66 @@
+package collectors
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"unicode/utf16"
+)
+
+// utf16String encodes s as a NUL-terminated UTF-16LE string
+func utf16String(s string) []byte {
+	var data []byte
+	for _, r := range utf16.Encode([]rune(s + "\x00")) {
+		data = append(data, byte(r), byte(r>>8))
+	}
+	return data
+}
+
+func TestLibraryNames(t *testing.T) {
+	var data []byte
+	data = append(data, "Plugin.DLL\x00"...)
+	data = append(data, "Failed to load %s.dll\x00"...)
+	data = append(data, `C:\Windows\System32\full.dll`+"\x00"...)
+	data = append(data, ".dll\x00*.dll\x00"...)
+
+	// wide strings are aligned to 2 bytes
+	data = append(data, "\x00\x00\x00"...)
+	data = append(data, utf16String("wide_helper.dll")...)
+	data = append(data, utf16String("updater.exe")...)
+	data = append(data, "netio.sys"...)
+
+	expected := []string{"plugin.dll", "netio.sys", "wide_helper.dll", "updater.exe"}
+	if names := libraryNames(data); !slices.Equal(names, expected) {
+		t.Errorf("Expected %q, got %q", expected, names)
+	}
+}
+
+func TestDynamicImports(t *testing.T) {
+	data := []byte("plugin.dll\x00wer.dll\x00plugin.dll\x00")
+	img, err := newPEImage(bytes.NewReader(testPE(".rdata", data)))
+	if err != nil {
+		t.Fatalf("Failed to parse test PE: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		delayed  []string
+		expected []string
+	}{
+		{"Images loading libraries", []string{"kernel32.dll!LoadLibraryExW"}, []string{"plugin.dll", "wer.dll"}},
+		{"Imported libraries are left out", []string{"kernel32.dll!LoadLibraryW", "wer.dll!WerReportCreate"}, []string{"plugin.dll"}},
+		{"Images that don't load libraries", []string{"kernel32.dll!CreateFileW"}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			names, err := img.dynamicImports(test.delayed)
+			if err != nil {
+				t.Fatalf("Failed to scan for libraries: %v", err)
+			}
+			if !slices.Equal(names, test.expected) {
+				t.Errorf("Expected %q, got %q", test.expected, names)
+			}
+		})
+	}
+}
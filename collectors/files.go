@@ -12,14 +12,18 @@ import (
 
 // Constants for file paths used for outputs
 const (
-	ExeFile       = "exes.csv"          // Path to write executable file data
-	DllFile       = "dlls.csv"          // Path to write dynamic link library data
-	DirFile       = "dirs.csv"          // Path to write directory data
-	PrincipalFile = "principals.csv"    // Path to write security principal data
-	RelsFile      = "relationships.csv" // Path to write relationship data
-	DepsFile      = "deps.csv"          // Path to write dependency data
-	RunnersFile   = "runners.csv"       // Path to write auto-runner data
-	ImportFile    = "imports.csv"       // Path to write import relationship data
+	ExeFile        = "exes.csv"          // Path to write executable file data
+	DllFile        = "dlls.csv"          // Path to write dynamic link library data
+	DirFile        = "dirs.csv"          // Path to write directory data
+	PrincipalFile  = "principals.csv"    // Path to write security principal data
+	RelsFile       = "relationships.csv" // Path to write relationship data
+	DepsFile       = "deps.csv"          // Path to write dependency data
+	RunnersFile    = "runners.csv"       // Path to write auto-runner data
+	ImportFile     = "imports.csv"       // Path to write import relationship data
+	CandidateFile  = "candidates.csv"    // Path to write unquoted path candidate data
+	ResolutionFile = "resolutions.csv"   // Path to write DLL search order data
+	ForwardFile    = "forwards.csv"      // Path to write export forwarder data
+	ScriptFile     = "scripts.csv"       // Path to write runner script data
 )
 
 var (
@@ -28,32 +32,40 @@ var (
 )
 
 var (
-	writers                        map[string]*concurrent.Writer
-	f0, f1, f2, f3, f4, f5, f6, f7 os.File
+	writers                                          map[string]*concurrent.Writer
+	f0, f1, f2, f3, f4, f5, f6, f7, f8, f9, f10, f11 os.File
 )
 
 // InitOutputFiles initializes output files for data collection
 func InitOutputFiles() {
 	var (
-		f0, _ = os.OpenFile(ExeFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
-		f1, _ = os.OpenFile(DllFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
-		f2, _ = os.OpenFile(DirFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
-		f3, _ = os.OpenFile(PrincipalFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
-		f4, _ = os.OpenFile(RelsFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
-		f5, _ = os.OpenFile(DepsFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
-		f6, _ = os.OpenFile(RunnersFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
-		f7, _ = os.OpenFile(ImportFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		f0, _  = os.OpenFile(ExeFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		f1, _  = os.OpenFile(DllFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		f2, _  = os.OpenFile(DirFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		f3, _  = os.OpenFile(PrincipalFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		f4, _  = os.OpenFile(RelsFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		f5, _  = os.OpenFile(DepsFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		f6, _  = os.OpenFile(RunnersFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		f7, _  = os.OpenFile(ImportFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		f8, _  = os.OpenFile(CandidateFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		f9, _  = os.OpenFile(ResolutionFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		f10, _ = os.OpenFile(ForwardFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		f11, _ = os.OpenFile(ScriptFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	)
 
 	writers = map[string]*concurrent.Writer{
-		ExeFile:       concurrent.NewWriter(f0),
-		DllFile:       concurrent.NewWriter(f1),
-		DirFile:       concurrent.NewWriter(f2),
-		PrincipalFile: concurrent.NewWriter(f3),
-		RelsFile:      concurrent.NewWriter(f4),
-		DepsFile:      concurrent.NewWriter(f5),
-		RunnersFile:   concurrent.NewWriter(f6),
-		ImportFile:    concurrent.NewWriter(f7),
+		ExeFile:        concurrent.NewWriter(f0),
+		DllFile:        concurrent.NewWriter(f1),
+		DirFile:        concurrent.NewWriter(f2),
+		PrincipalFile:  concurrent.NewWriter(f3),
+		RelsFile:       concurrent.NewWriter(f4),
+		DepsFile:       concurrent.NewWriter(f5),
+		RunnersFile:    concurrent.NewWriter(f6),
+		ImportFile:     concurrent.NewWriter(f7),
+		CandidateFile:  concurrent.NewWriter(f8),
+		ResolutionFile: concurrent.NewWriter(f9),
+		ForwardFile:    concurrent.NewWriter(f10),
+		ScriptFile:     concurrent.NewWriter(f11),
 	}
 }
 
@@ -69,6 +81,10 @@ func FlushAndClose() {
 	defer f5.Close()
 	defer f6.Close()
 	defer f7.Close()
+	defer f8.Close()
+	defer f9.Close()
+	defer f10.Close()
+	defer f11.Close()
 
 	for f, writer := range writers {
 		err := writer.Flush()
@@ -38,6 +38,10 @@ func TestInitOutputFiles(t *testing.T) {
 				DepsFile,
 				RunnersFile,
 				ImportFile,
+				CandidateFile,
+				ResolutionFile,
+				ForwardFile,
+				ScriptFile,
 			}
 
 			for _, file := range filesToCheck {
@@ -0,0 +1,148 @@
+package collectors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+const (
+	// rtManifest is the resource type of side-by-side assembly manifests
+	rtManifest = 24
+
+	// maxResource bounds the resources read from a damaged or hostile image
+	maxResource = 1 << 20
+)
+
+// Manifest is what the application manifest of an Exe asks of the loader
+// and of UAC
+type Manifest struct {
+	AutoElevate    bool               `json:"AutoElevate"`    // elevates without a consent prompt
+	ExecutionLevel string             `json:"ExecutionLevel"` // asInvoker, highestAvailable or requireAdministrator
+	UIAccess       bool               `json:"UIAccess"`       // may drive the UI of elevated windows
+	Dependencies   []AssemblyIdentity `json:"Dependencies"`   // side-by-side assemblies loaded with it
+}
+
+// AssemblyIdentity names a side-by-side assembly
+type AssemblyIdentity struct {
+	Type           string `xml:"type,attr" json:"Type"`
+	Name           string `xml:"name,attr" json:"Name"`
+	Version        string `xml:"version,attr" json:"Version"`
+	Arch           string `xml:"processorArchitecture,attr" json:"Arch"`
+	PublicKeyToken string `xml:"publicKeyToken,attr" json:"PublicKeyToken"`
+	Language       string `xml:"language,attr" json:"Language"`
+}
+
+// String returns the name/version an assembly is listed by on its node
+func (a AssemblyIdentity) String() string {
+	return a.Name + "/" + a.Version
+}
+
+// manifestXML is the part of the manifest schema the collector reads. Tags
+// leave out namespaces, which differ between manifests, so elements match
+// by their local name.
+type manifestXML struct {
+	ExecutionLevel struct {
+		Level    string `xml:"level,attr"`
+		UIAccess string `xml:"uiAccess,attr"`
+	} `xml:"trustInfo>security>requestedPrivileges>requestedExecutionLevel"`
+	AutoElevate  string             `xml:"application>windowsSettings>autoElevate"`
+	Dependencies []AssemblyIdentity `xml:"dependency>dependentAssembly>assemblyIdentity"`
+}
+
+// parseManifest reads an application manifest
+func parseManifest(data []byte) (*Manifest, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var doc manifestXML
+	err := xml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	isTrue := func(s string) bool {
+		return strings.EqualFold(strings.TrimSpace(s), "true")
+	}
+	return &Manifest{
+		AutoElevate:    isTrue(doc.AutoElevate),
+		ExecutionLevel: strings.TrimSpace(doc.ExecutionLevel.Level),
+		UIAccess:       isTrue(doc.ExecutionLevel.UIAccess),
+		Dependencies:   doc.Dependencies,
+	}, nil
+}
+
+// manifest returns the application manifest embedded in the image, or nil
+// when it has none
+func (img *peImage) manifest() (*Manifest, error) {
+	data, err := img.resource(rtManifest)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return parseManifest(data)
+}
+
+// resource returns the data of the first resource of type typ, whatever its
+// name or language, or nil when the image has none
+func (img *peImage) resource(typ uint32) ([]byte, error) {
+	dir := img.directory(resourceDirectory)
+	if dir.VirtualAddress == 0 || dir.Size == 0 {
+		return nil, nil
+	}
+
+	// the tree goes type, name, then language, each level a directory
+	// of entries whose offsets are relative to the start of the tree
+	const subdirectory = 1 << 31
+	le := binary.LittleEndian
+	offset := uint32(0)
+	for level := 0; level < 2; level++ {
+		header, err := img.readRVA(dir.VirtualAddress+offset, 16)
+		if err != nil {
+			return nil, err
+		}
+		count := uint32(le.Uint16(header[12:])) + uint32(le.Uint16(header[14:]))
+
+		found := false
+		for i := uint32(0); i < count; i++ {
+			entry, err := img.readRVA(dir.VirtualAddress+offset+16+i*8, 8)
+			if err != nil {
+				return nil, err
+			}
+			id, target := le.Uint32(entry), le.Uint32(entry[4:])
+			if level == 0 && id != typ {
+				continue
+			}
+			if target&subdirectory == 0 {
+				return nil, fmt.Errorf("resource tree ends at level %d", level)
+			}
+			offset, found = target&^subdirectory, true
+			break
+		}
+		if !found {
+			return nil, nil
+		}
+	}
+
+	// the language directory leads to the data entry
+	header, err := img.readRVA(dir.VirtualAddress+offset, 16)
+	if err != nil {
+		return nil, err
+	}
+	if le.Uint16(header[12:])+le.Uint16(header[14:]) == 0 {
+		return nil, nil
+	}
+	entry, err := img.readRVA(dir.VirtualAddress+offset+16, 8)
+	if err != nil {
+		return nil, err
+	}
+	dataEntry, err := img.readRVA(dir.VirtualAddress+le.Uint32(entry[4:])&^subdirectory, 16)
+	if err != nil {
+		return nil, err
+	}
+	rva, size := le.Uint32(dataEntry), le.Uint32(dataEntry[4:])
+	if size > maxResource {
+		return nil, fmt.Errorf("resource of %d bytes is too large", size)
+	}
+	return img.readRVA(rva, size)
+}
@@ -0,0 +1,140 @@
+package collectors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// testResourcePE builds a PE holding data as its only resource, of type typ
+func testResourcePE(typ uint32, data []byte) []byte {
+	le := binary.LittleEndian
+	const (
+		rva          = 0x1000
+		subdirectory = 1 << 31
+	)
+
+	// a type, a name and a language directory of one entry each, then
+	// the data entry and the data
+	tree := make([]byte, 88)
+	directory := func(offset int, id, target uint32) {
+		le.PutUint16(tree[offset+14:], 1)
+		le.PutUint32(tree[offset+16:], id)
+		le.PutUint32(tree[offset+20:], target)
+	}
+	directory(0, typ, subdirectory|24)
+	directory(24, 1, subdirectory|48)
+	directory(48, 1033, 72)
+	le.PutUint32(tree[72:], rva+88)
+	le.PutUint32(tree[76:], uint32(len(data)))
+	tree = append(tree, data...)
+
+	image := testPE(".rsrc", tree)
+	setTestDirectory(image, resourceDirectory, rva, uint32(len(tree)))
+	return image
+}
+
+const testManifest = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<assembly xmlns="urn:schemas-microsoft-com:asm.v1" xmlns:asmv3="urn:schemas-microsoft-com:asm.v3" manifestVersion="1.0">
+  <assemblyIdentity type="win32" name="Microsoft.Windows.FodHelper" version="5.1.0.0" processorArchitecture="amd64"/>
+  <dependency>
+    <dependentAssembly>
+      <assemblyIdentity type="win32" name="Microsoft.Windows.Common-Controls" version="6.0.0.0"
+        processorArchitecture="*" publicKeyToken="6595b64144ccf1df" language="*"/>
+    </dependentAssembly>
+  </dependency>
+  <trustInfo xmlns="urn:schemas-microsoft-com:asm.v3">
+    <security>
+      <requestedPrivileges>
+        <requestedExecutionLevel level="requireAdministrator" uiAccess="false"/>
+      </requestedPrivileges>
+    </security>
+  </trustInfo>
+  <asmv3:application>
+    <asmv3:windowsSettings xmlns="http://schemas.microsoft.com/SMI/2005/WindowsSettings">
+      <autoElevate> true </autoElevate>
+    </asmv3:windowsSettings>
+  </asmv3:application>
+</assembly>`
+
+func TestParseManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		expected *Manifest
+	}{
+		{
+			name:     "Auto-elevating",
+			manifest: testManifest,
+			expected: &Manifest{
+				AutoElevate:    true,
+				ExecutionLevel: "requireAdministrator",
+				Dependencies: []AssemblyIdentity{{
+					Type:           "win32",
+					Name:           "Microsoft.Windows.Common-Controls",
+					Version:        "6.0.0.0",
+					Arch:           "*",
+					PublicKeyToken: "6595b64144ccf1df",
+					Language:       "*",
+				}},
+			},
+		},
+		{
+			name: "UI access with a byte order mark",
+			manifest: "\xef\xbb\xbf" + `<assembly xmlns="urn:schemas-microsoft-com:asm.v1"><trustInfo xmlns="urn:schemas-microsoft-com:asm.v2">
+				<security><requestedPrivileges><requestedExecutionLevel level="asInvoker" uiAccess="true"/>
+				</requestedPrivileges></security></trustInfo></assembly>`,
+			expected: &Manifest{ExecutionLevel: "asInvoker", UIAccess: true},
+		},
+		{
+			name:     "Without trust info",
+			manifest: `<assembly><assemblyIdentity name="Vendor.App" version="1.0.0.0"/></assembly>`,
+			expected: &Manifest{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manifest, err := parseManifest([]byte(test.manifest))
+			if err != nil {
+				t.Fatalf("Failed to parse manifest: %v", err)
+			}
+			if !reflect.DeepEqual(manifest, test.expected) {
+				t.Errorf("Expected manifest %+v, got %+v", test.expected, manifest)
+			}
+		})
+	}
+
+	t.Run("Malformed manifests are rejected", func(t *testing.T) {
+		if _, err := parseManifest([]byte("<assembly><trustInfo>")); err == nil {
+			t.Error("Expected an error for a truncated manifest")
+		}
+	})
+}
+
+func TestImageManifest(t *testing.T) {
+	img, err := newPEImage(bytes.NewReader(testResourcePE(rtManifest, []byte(testManifest))))
+	if err != nil {
+		t.Fatalf("Failed to parse test PE: %v", err)
+	}
+	manifest, err := img.manifest()
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	if manifest == nil || !manifest.AutoElevate || manifest.ExecutionLevel != "requireAdministrator" {
+		t.Errorf("Expected an auto-elevating manifest, got %+v", manifest)
+	}
+
+	t.Run("Images without a manifest have none", func(t *testing.T) {
+		for _, image := range [][]byte{testPE(".text", nil), testResourcePE(16, []byte("version"))} {
+			img, err := newPEImage(bytes.NewReader(image))
+			if err != nil {
+				t.Fatalf("Failed to parse test PE: %v", err)
+			}
+			if manifest, err := img.manifest(); manifest != nil || err != nil {
+				t.Errorf("Expected no manifest, got %+v, %v", manifest, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package collectors
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/audibleblink/lpegopher/util"
+)
+
+// errNoSecurityDescriptor is returned when the filesystem holding a file
+// doesn't expose its Windows security descriptor
+var errNoSecurityDescriptor = errors.New("no security descriptor available")
+
+// Volume is a Windows system drive mounted on the collecting host, such as a
+// read-only NTFS mount or a mounted forensic image
+type Volume struct {
+	Mount string // Where the drive is mounted on the collecting host
+	Drive string // Drive letter the volume had on its original host, e.g. "c:"
+}
+
+// volume is set when collecting from an offline Volume instead of the live
+// host
+var volume *Volume
+
+// UseOfflineVolume directs collection at the Windows volume mounted at mount.
+// Collected paths are rewritten to their form on the original host, rooted
+// at drive.
+func UseOfflineVolume(mount, drive string) (*Volume, error) {
+	abs, err := filepath.Abs(mount)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", mount)
+	}
+
+	drive = util.Lower(strings.TrimRight(drive, `:\/`))
+	if len(drive) != 1 {
+		return nil, fmt.Errorf("invalid drive letter: %s", drive)
+	}
+
+	volume = &Volume{Mount: abs, Drive: drive + ":"}
+	return volume, nil
+}
+
+// Offline reports whether collection is running against an offline Volume
+func Offline() bool {
+	return volume != nil
+}
+
+// WindowsPath converts a path under the mount point into the lowercased,
+// slash-separated path it had on the original host
+func (v *Volume) WindowsPath(local string) string {
+	rel, err := filepath.Rel(v.Mount, local)
+	rel = filepath.ToSlash(rel)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return v.Drive + "/"
+	}
+	return util.Lower(v.Drive + "/" + rel)
+}
+
+// LocalPath finds the file under the mount point that the original host
+// knew as winPath. Windows paths are case-insensitive while most mounts are
+// not, so each path component is matched case-insensitively.
+func (v *Volume) LocalPath(winPath string) (string, error) {
+	winPath = strings.ReplaceAll(winPath, `\`, "/")
+	if len(winPath) >= 2 && winPath[1] == ':' {
+		if !strings.EqualFold(winPath[:2], v.Drive) {
+			return "", fmt.Errorf("%s is not on drive %s", winPath, v.Drive)
+		}
+		winPath = winPath[2:]
+	}
+
+	local := v.Mount
+	for _, part := range strings.Split(winPath, "/") {
+		if part == "" || part == "." {
+			continue
+		}
+
+		next := filepath.Join(local, part)
+		if _, err := os.Lstat(next); err == nil {
+			local = next
+			continue
+		}
+
+		entries, err := os.ReadDir(local)
+		if err != nil {
+			return "", err
+		}
+
+		found := false
+		for _, entry := range entries {
+			if strings.EqualFold(entry.Name(), part) {
+				local = filepath.Join(local, entry.Name())
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("%s: %w", winPath, os.ErrNotExist)
+		}
+	}
+	return local, nil
+}
+
+// localPath returns where the file the collected host knows by winPath is
+// on the collecting host
+func localPath(winPath string) (string, error) {
+	if Offline() {
+		return volume.LocalPath(winPath)
+	}
+	return winPath, nil
+}
+
+// hostPath converts a path on the collecting host into the lowercased path
+// by which the original host knows the same file
+func hostPath(local string) string {
+	if volume != nil {
+		return volume.WindowsPath(local)
+	}
+	abs, _ := filepath.Abs(local)
+	return util.Lower(abs)
+}
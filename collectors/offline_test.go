@@ -0,0 +1,73 @@
+package collectors
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVolumeWindowsPath(t *testing.T) {
+	vol := &Volume{Mount: "/mnt/win", Drive: "c:"}
+
+	tests := []struct {
+		local    string
+		expected string
+	}{
+		{"/mnt/win", "c:/"},
+		{"/mnt/win/Windows/System32/KERNEL32.dll", "c:/windows/system32/kernel32.dll"},
+		{"/mnt/win/Program Files/App", "c:/program files/app"},
+		{"/mnt", "c:/"},
+	}
+
+	for _, test := range tests {
+		result := vol.WindowsPath(test.local)
+		if result != test.expected {
+			t.Errorf("WindowsPath(%q) = %q, expected %q", test.local, result, test.expected)
+		}
+	}
+}
+
+func TestVolumeLocalPath(t *testing.T) {
+	mount, cleanup := createMockTempDir(t)
+	defer cleanup()
+
+	sys32 := filepath.Join(mount, "Windows", "System32")
+	if err := os.MkdirAll(sys32, 0755); err != nil {
+		t.Fatalf("Failed to create test directory structure: %v", err)
+	}
+
+	vol := &Volume{Mount: mount, Drive: "c:"}
+
+	t.Run("Components are matched case-insensitively", func(t *testing.T) {
+		local, err := vol.LocalPath(`C:\WINDOWS\system32`)
+		if err != nil {
+			t.Fatalf("LocalPath returned error: %v", err)
+		}
+		if local != sys32 {
+			t.Errorf("Expected %s, got %s", sys32, local)
+		}
+	})
+
+	t.Run("Paths without a drive are relative to the mount", func(t *testing.T) {
+		local, err := vol.LocalPath("testdata/TEST.exe")
+		if err != nil {
+			t.Fatalf("LocalPath returned error: %v", err)
+		}
+		if local != filepath.Join(mount, "testdata", "test.exe") {
+			t.Errorf("Unexpected local path %s", local)
+		}
+	})
+
+	t.Run("Other drives are rejected", func(t *testing.T) {
+		if _, err := vol.LocalPath(`d:\windows`); err == nil {
+			t.Error("Expected an error for a path on another drive")
+		}
+	})
+
+	t.Run("Missing files are reported", func(t *testing.T) {
+		if _, err := vol.LocalPath(`c:\windows\missing.dll`); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected a not-exist error, got %v", err)
+		}
+	})
+}
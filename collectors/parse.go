@@ -0,0 +1,141 @@
+package collectors
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/audibleblink/lpegopher/node"
+)
+
+// the limits PE parsing runs within unless configured otherwise
+const (
+	DefaultMaxPESize    = 256 << 20 // bytes
+	DefaultParseTimeout = 30 * time.Second
+
+	// maxStalledParses bounds the parses left running after timing out.
+	// Each keeps its PE open and the memory it took, so past the bound no
+	// PE is parsed until one of them finishes.
+	maxStalledParses = 8
+)
+
+var (
+	// maxPESize is the size, in bytes, of the largest file parsed as a PE.
+	// Parsing never reads more than the file, so it bounds the memory a
+	// malformed PE can make a walker use.
+	maxPESize int64 = DefaultMaxPESize
+
+	// parseTimeout bounds the time a walker waits for a PE to be parsed
+	parseTimeout = DefaultParseTimeout
+
+	// stalledParses counts the parses that timed out and are still running
+	stalledParses atomic.Int32
+)
+
+// ConfigurePELimits sets the size, in bytes, of the largest file parsed as
+// a PE and how long parsing one may take. Zero lifts a limit. It must run
+// before PE collection.
+func ConfigurePELimits(maxSize int64, timeout time.Duration) {
+	maxPESize = maxSize
+	parseTimeout = timeout
+}
+
+// parsePE fills report in from the PE at path on the collecting host,
+// within the configured limits. Whatever couldn't be parsed is reported by
+// the error, with report keeping what could.
+//
+// A PE that times out is left to finish parsing in the background, since
+// it can't be interrupted; its handle is closed once it does. Those are
+// bounded by maxStalledParses: past it, PEs aren't parsed at all.
+func parsePE(report *INode, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if maxPESize > 0 && info.Size() > maxPESize {
+		return fmt.Errorf("larger than %d bytes", maxPESize)
+	}
+	if stalled := stalledParses.Load(); stalled >= maxStalledParses {
+		return fmt.Errorf("not parsed while %d timed out parses are still running", stalled)
+	}
+
+	parsed := *report
+	done := make(chan error, 1)
+	go func() {
+		done <- parsePEFile(&parsed, path)
+	}()
+
+	if parseTimeout > 0 {
+		timer := time.NewTimer(parseTimeout)
+		defer timer.Stop()
+		select {
+		case err = <-done:
+		case <-timer.C:
+			stalledParses.Add(1)
+			go func() {
+				<-done
+				stalledParses.Add(-1)
+			}()
+			return fmt.Errorf("parsing timed out after %s", parseTimeout)
+		}
+	} else {
+		err = <-done
+	}
+	*report = parsed
+	return err
+}
+
+// parsePEFile fills report in from the PE at path on the collecting host,
+// recovering from the panics of the parsers
+func parsePEFile(report *INode, path string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parser panicked: %v", r)
+		}
+	}()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var errs []error
+	report.SHA256, err = fileSHA256(path)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("hashing: %w", err))
+	}
+
+	err = populateImageTables(report, file, path)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if report.Type == node.Exe {
+		report.DotLocal = dotLocal(path)
+		if report.Header != nil && report.Header.DotNet {
+			report.PrivatePaths = privateProbingPaths(path)
+		}
+	}
+
+	var sections []string
+	peFile, err := newPEFile(file)
+	if err == nil {
+		sections = sectionNames(peFile)
+		err = populatePEReport(report, peFile)
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+	report.Capabilities = capabilitiesOf(report)
+
+	if len(rules) > 0 {
+		report.Tags, err = matchRules(report, file, sections)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rules: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
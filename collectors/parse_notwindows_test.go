@@ -0,0 +1,37 @@
+//go:build !windows
+
+package collectors
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParsePETimeout(t *testing.T) {
+	withTestPELimits(t, DefaultMaxPESize, 50*time.Millisecond)
+
+	// opening a FIFO blocks until it has a writer, like a stalled parse
+	path := filepath.Join(t.TempDir(), "stalled.dll")
+	if err := unix.Mkfifo(path, 0o644); err != nil {
+		t.Skipf("FIFOs unavailable: %v", err)
+	}
+	t.Cleanup(func() {
+		if w, err := os.OpenFile(path, os.O_WRONLY, 0); err == nil {
+			w.Close()
+		}
+	})
+
+	report := newPEReport(path)
+	err := parsePE(report, path)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected parsing to time out, got %v", err)
+	}
+	if report.Header != nil {
+		t.Errorf("Expected a timed out parse to leave the report alone, got %+v", report.Header)
+	}
+}
@@ -0,0 +1,163 @@
+package collectors
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/audibleblink/lpegopher/node"
+)
+
+// withTestPELimits sets the PE parsing limits for the duration of a test
+func withTestPELimits(t *testing.T, maxSize int64, timeout time.Duration) {
+	ConfigurePELimits(maxSize, timeout)
+	t.Cleanup(func() {
+		ConfigurePELimits(DefaultMaxPESize, DefaultParseTimeout)
+	})
+}
+
+func TestParsePE(t *testing.T) {
+	dir := t.TempDir()
+	valid := testExportsPE(1, []string{"Run"})
+	tests := []struct {
+		name    string
+		data    []byte
+		maxSize int64
+		wantErr string
+	}{
+		{"Valid PEs parse", valid, DefaultMaxPESize, ""},
+		{"Files over the size limit aren't parsed", valid, int64(len(valid)) - 1, "larger than"},
+		{"Zero lifts the size limit", valid, 0, ""},
+		{"Files that aren't PEs fail", []byte("MZ not really a PE"), DefaultMaxPESize, "headers"},
+		{"Truncated PEs fail", valid[:0x100], DefaultMaxPESize, "headers"},
+	}
+
+	for n, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withTestPELimits(t, test.maxSize, DefaultParseTimeout)
+			path := filepath.Join(dir, string(rune('a'+n))+".dll")
+			if err := os.WriteFile(path, test.data, 0o644); err != nil {
+				t.Fatalf("Failed to write test PE: %v", err)
+			}
+
+			report := newPEReport(path)
+			err := parsePE(report, path)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Expected %s to parse, got %v", path, err)
+				}
+				if report.Header == nil || report.SHA256 == "" || len(report.Exports) != 1 {
+					t.Errorf("Expected a parsed report, got %+v", report)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Expected an error containing %q, got %v", test.wantErr, err)
+			}
+			if report.Type != node.Dll {
+				t.Errorf("Expected an unparsed report to keep its type, got %q", report.Type)
+			}
+		})
+	}
+}
+
+func TestUnparsedPEsAreCollected(t *testing.T) {
+	mount := useTestVolume(t)
+
+	dir := filepath.Join(mount, "Tools")
+	os.MkdirAll(dir, 0o755)
+	if err := os.WriteFile(filepath.Join(dir, "broken.dll"), []byte("MZ broken"), 0o644); err != nil {
+		t.Fatalf("Failed to write test PE: %v", err)
+	}
+
+	PEs(dir)
+
+	rows := collectedRows(t, DllFile)
+	if len(rows) != 1 {
+		t.Fatalf("Expected the unparsed Dll to be collected, got %q", rows)
+	}
+	fields := strings.Split(rows[0], ",")
+	if fields[2] != "c:/tools/broken.dll" || !strings.HasPrefix(fields[36], `"`) {
+		t.Errorf("Expected c:/tools/broken.dll with a parse error, got %s", rows[0])
+	}
+}
+
+// FuzzPEImage runs the parsers of the PE tables go-pe doesn't parse over
+// arbitrary images. Unlike collection, it doesn't recover from their panics.
+func FuzzPEImage(f *testing.F) {
+	f.Add(testPE(".text", nil))
+	f.Add(testExportsPE(1, []string{"Alpha", "-", "Beta=other.Beta"}))
+	f.Add(testImportsPE(map[string][]string{"helper.dll": {"Run"}}, [][]string{{"kernel32.dll"}}))
+	f.Add(testResourcePE(24, []byte(`<assembly><trustInfo/></assembly>`)))
+	f.Add(testDotNetPE(testMetadata([]testRef{{name: "System.Xml", version: [4]uint16{4, 0, 0, 0}}}, false)))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		img, err := newPEImage(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		img.header()
+		signatureOf(img)
+		img.exportTable()
+		delayed, _ := img.delayImports()
+		img.dynamicImports(delayed)
+		img.boundImports()
+		img.assemblyRefs()
+		img.manifest()
+	})
+}
+
+func TestParsePEWhileStalled(t *testing.T) {
+	stalledParses.Add(maxStalledParses)
+	t.Cleanup(func() {
+		stalledParses.Add(-maxStalledParses)
+	})
+
+	path := filepath.Join(t.TempDir(), "valid.dll")
+	if err := os.WriteFile(path, testExportsPE(1, []string{"Run"}), 0o644); err != nil {
+		t.Fatalf("Failed to write test PE: %v", err)
+	}
+
+	report := newPEReport(path)
+	err := parsePE(report, path)
+	if err == nil || !strings.Contains(err.Error(), "still running") {
+		t.Errorf("Expected no parsing while too many parses are stalled, got %v", err)
+	}
+	if report.Header != nil {
+		t.Errorf("Expected the report left alone, got %+v", report.Header)
+	}
+}
+
+// fuzzParseTimeout is how long parsing a fuzzed PE may take before it's
+// reported as hanging, well within the timeout of the fuzzer
+const fuzzParseTimeout = 2 * time.Second
+
+// FuzzParsePE runs the whole of PE parsing over arbitrary files, which must
+// neither panic nor hang
+func FuzzParsePE(f *testing.F) {
+	f.Add(testExportsPE(1, []string{"Alpha", "Beta=other.Beta"}))
+	f.Add(testImportsPE(map[string][]string{"helper.dll": {"Run"}}, nil))
+	f.Add([]byte("MZ"))
+
+	dir := f.TempDir()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		withTestPELimits(t, DefaultMaxPESize, fuzzParseTimeout)
+		path := filepath.Join(dir, "fuzz.dll")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("Failed to write test PE: %v", err)
+		}
+
+		report := newPEReport(path)
+		err := parsePE(report, path)
+		if err != nil && strings.Contains(err.Error(), "timed out") {
+			t.Fatalf("Parsing hung: %v", err)
+		}
+		if err != nil {
+			report.ParseError = err.Error()
+		}
+		report.ToCSV()
+	})
+}
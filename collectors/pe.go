@@ -0,0 +1,333 @@
+package collectors
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/audibleblink/go-winacl"
+	"www.velocidex.com/golang/binparsergen/reader"
+	"www.velocidex.com/golang/go-pe"
+
+	"github.com/audibleblink/logerr"
+	"github.com/audibleblink/lpegopher/node"
+	"github.com/audibleblink/lpegopher/util"
+)
+
+func PEs(dir string) {
+	log := logerr.Add("pe collector")
+	walkStartPath, _ := filepath.Abs(dir)
+	filepath.WalkDir(walkStartPath, walkFunction)
+	log.Infof("completed collection of %s", walkStartPath)
+}
+
+func walkFunction(path string, info os.DirEntry, err error) error {
+	log := logerr.Add("dirwalk")
+
+	if err != nil {
+		log.Warnf("%v", err)
+		// info is nil when the walk's root can't be read
+		return nil
+	}
+
+	if info.IsDir() {
+		return nil
+	}
+
+	if isPECandidate(path) {
+		parent := writeDirectory(filepath.Dir(path))
+
+		report := newPEReport(path)
+		report.Parent = parent
+
+		err = parsePE(report, path)
+		if err != nil {
+			log.Debugf("pe parsing failed for %s: %s", path, err)
+			report.ParseError = err.Error()
+		}
+
+		err = handlePerms(report, path)
+		if err != nil {
+			log.Warnf("could not generate report for %s: %s", path, err)
+			return nil
+		}
+
+		doPrint(report)
+	}
+	return nil
+}
+
+// writeDirectory writes the report of the directory at path on the
+// collecting host, unless it already was, and returns its path as reported
+func writeDirectory(path string) string {
+	dir := hostPath(path)
+	_, alreadyDidIt := cache.LoadOrStore(dir, true)
+	if !alreadyDidIt {
+		doPrint(newDirectoryReport(path))
+	}
+	return dir
+}
+
+// newDirectoryReport builds the report for the directory found at path on
+// the collecting host
+func newDirectoryReport(path string) *INode {
+	report := &INode{}
+	report.Path = hostPath(path)
+	report.Name = filepath.Base(report.Path)
+	report.Type = node.Dir
+	report.Parent = hostPath(filepath.Dir(path))
+	err := handlePerms(report, path)
+	if err != nil {
+		return report
+	}
+	return report
+}
+
+// newPEReport builds the report for the PE found at path on the collecting
+// host
+func newPEReport(path string) *INode {
+	report := &INode{}
+	report.Path = hostPath(path)
+	report.Name = filepath.Base(report.Path)
+
+	report.Type = nodeTypeByExtension(path)
+	return report
+}
+
+// newPEFile parses the PE read from file, which stays open while the
+// PEFile is used
+func newPEFile(file io.ReaderAt) (*pe.PEFile, error) {
+	peReader, err := reader.NewPagedReader(file, 4096, 100)
+	if err != nil {
+		return nil, err
+	}
+	return pe.NewPEFile(peReader)
+}
+
+// sectionNames returns the names of the sections of peFile. go-pe reads
+// names up to a NUL, past the 8 bytes a name may fill.
+func sectionNames(peFile *pe.PEFile) []string {
+	names := make([]string, 0, len(peFile.Sections))
+	for _, section := range peFile.Sections {
+		name := section.Name
+		if len(name) > 8 {
+			name = name[:8]
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func populatePEReport(report *INode, peFile *pe.PEFile) error {
+	imports := make([]*Dep, 0)
+	for _, imp := range peFile.Imports() {
+		// function names keep their case, only the DLL is case-insensitive
+		dll, fn, _ := strings.Cut(imp, "!")
+		imports = append(imports, &Dep{Name: util.Lower(dll) + "!" + fn})
+	}
+	report.Imports = imports
+	report.ImpHash = impHash(imports)
+
+	if report.Header != nil {
+		version := peFile.VersionInformation()
+		report.Header.CompanyName, _ = version.GetString("CompanyName")
+		report.Header.ProductName, _ = version.GetString("ProductName")
+		report.Header.FileVersion, _ = version.GetString("FileVersion")
+		report.Header.OriginalFilename, _ = version.GetString("OriginalFilename")
+	}
+	return nil
+}
+
+func pullDACL(path string) (DACL, error) {
+	dacl := DACL{}
+	sd, err := securityDescriptorFor(path)
+	if errors.Is(err, errNoSecurityDescriptor) {
+		// offline volumes mounted without ACL support carry no
+		// ownership or ACE data, but the node itself is still useful
+		return dacl, nil
+	}
+	if err != nil {
+		return dacl, err
+	}
+	dacl.Owner = &Principal{Name: sidResolve(sd.Owner)}
+	dacl.Group = &Principal{Name: sidResolve(sd.Group)}
+	for _, ace := range sd.DACL.Aces {
+		dacl.Aces = append(dacl.Aces, newReadableAce(ace))
+	}
+	return dacl, err
+}
+
+func newReadableAce(ace winacl.ACE) ReadableAce {
+	var rAce ReadableAce
+
+	perms := ace.AccessMask.String()
+	rAce.Rights = strings.Split(perms, " ")
+
+	switch ace.ObjectAce.(type) {
+	case winacl.BasicAce:
+		name := sidResolve(ace.ObjectAce.GetPrincipal())
+		rAce.Principal = &Principal{Name: name}
+
+	case winacl.AdvancedAce:
+		aa := ace.ObjectAce.(winacl.AdvancedAce)
+		sid := aa.GetPrincipal()
+		name := sidResolve(sid)
+		rAce.Principal = &Principal{Name: name}
+	}
+	return rAce
+}
+
+// handlePerms attaches the DACL of the file at path on the collecting host
+// to report
+func handlePerms(report *INode, path string) error {
+	dacl, err := pullDACL(path)
+	if err != nil {
+		return err
+	}
+	report.DACL = dacl
+	return nil
+}
+
+func doPrint(report *INode) {
+	var nodeID string
+	switch report.Type {
+	case node.Exe:
+		nodeID = report.Write(writers[ExeFile])
+	case node.Dll:
+		nodeID = report.Write(writers[DllFile])
+	case node.Dir:
+		nodeID = report.Write(writers[DirFile])
+	case node.Script:
+		nodeID = report.Write(writers[ScriptFile])
+	}
+
+	for _, ace := range report.DACL.Aces {
+		pID := ace.Principal.Write(writers[PrincipalFile])
+		for _, priv := range ace.Rights {
+			if node.AbusableAces[priv] {
+				rel := &Rel{
+					Start: pID,
+					Rel:   priv,
+					End:   nodeID,
+				}
+				rel.Write(writers[RelsFile])
+			}
+		}
+	}
+
+	writeForwards(nodeID, report)
+
+	dlls := make([]string, 0, len(report.Imports))
+	for _, imp := range importsByDLL(report) {
+		dep := &Dep{Name: imp.dll, Host: apiSetHost(imp.dll)}
+		depID := dep.Write(writers[DepsFile])
+		rel := &Import{Start: nodeID, End: depID, Fns: imp.fns, Kind: imp.kind}
+		rel.Write(writers[ImportFile])
+
+		if !slices.Contains(dlls, imp.dll) {
+			dlls = append(dlls, imp.dll)
+		}
+	}
+
+	for _, dll := range report.DynamicImports {
+		dep := &Dep{Name: dll, Host: apiSetHost(dll)}
+		depID := dep.Write(writers[DepsFile])
+		rel := &Import{Start: nodeID, End: depID, Fns: []string{}, Kind: DynamicImport}
+		rel.Write(writers[ImportFile])
+
+		if !slices.Contains(dlls, dll) {
+			dlls = append(dlls, dll)
+		}
+	}
+
+	for _, ref := range report.AssemblyRefs {
+		dep := &Dep{Name: ref.FileName()}
+		depID := dep.Write(writers[DepsFile])
+		rel := &Import{Start: nodeID, End: depID, Fns: []string{}, Kind: ManagedImport}
+		rel.Write(writers[ImportFile])
+	}
+
+	if report.Type == node.Exe {
+		writeResolutions(nodeID, report, dlls)
+		writeAssemblyResolutions(nodeID, report)
+	}
+}
+
+// writeForwards relates the Dll dllID to the DLLs its exports are forwarded
+// to. The loader loads those as it would imports of the Dll, so they're
+// resolved from the Dll's directory.
+func writeForwards(dllID string, report *INode) {
+	for _, export := range report.Exports {
+		dll, fn := export.forwardTarget()
+		if dll == "" {
+			continue
+		}
+
+		dep := &Dep{Name: dll, Host: apiSetHost(dll)}
+		fwd := &Forward{Start: dllID, End: dep.Write(writers[DepsFile]), Fn: export.Symbol(), Target: fn}
+		if searchOrder != nil {
+			resolved, _ := searchOrder.resolve(loadContext{appDir: report.Parent, wow64: searchOrder.isWOW64(report)}, dll)
+			if resolved != "" {
+				fwd.Resolved = hashFor(resolved)
+			}
+		}
+		fwd.Write(writers[ForwardFile])
+	}
+}
+
+// dllImports are the functions a PE imports from a DLL one way
+type dllImports struct {
+	dll  string
+	kind string
+	fns  []string
+}
+
+// importsByDLL groups the dll!function imports of report by DLL and kind,
+// in import table order
+func importsByDLL(report *INode) []*dllImports {
+	var grouped []*dllImports
+	byKey := map[string]*dllImports{}
+
+	add := func(kind string, imports []*Dep) {
+		for _, imp := range imports {
+			dll, fn, _ := strings.Cut(imp.Name, "!")
+			k := kind
+			if k == StaticImport && slices.Contains(report.BoundImports, dll) {
+				k = BoundImport
+			}
+
+			group, ok := byKey[k+dll]
+			if !ok {
+				group = &dllImports{dll: dll, kind: k, fns: []string{}}
+				byKey[k+dll] = group
+				grouped = append(grouped, group)
+			}
+			fn = importedFunction(fn)
+			if fn != "" && !slices.Contains(group.fns, fn) {
+				group.fns = append(group.fns, fn)
+			}
+		}
+	}
+	add(StaticImport, report.Imports)
+	add(DelayImport, report.DelayImports)
+	return grouped
+}
+
+// importedFunction returns the name of a function as found in the import
+// table, with ordinals, which go-pe renders in hex, written as #N
+func importedFunction(fn string) string {
+	hex, ok := strings.CutPrefix(fn, "0x")
+	if !ok {
+		return fn
+	}
+	ordinal, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return fn
+	}
+	return fmt.Sprintf("#%d", ordinal)
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+
+package collectors
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/audibleblink/go-winacl"
+	"golang.org/x/sys/unix"
+)
+
+// ntfsACLAttr is the extended attribute through which ntfs-3g exposes the
+// raw, self-relative security descriptor of a file
+const ntfsACLAttr = "system.ntfs_acl"
+
+func securityDescriptorFor(path string) (sd winacl.NtSecurityDescriptor, err error) {
+	size, err := unix.Getxattr(path, ntfsACLAttr, nil)
+	if err != nil {
+		if errors.Is(err, unix.ENODATA) || errors.Is(err, unix.ENOTSUP) {
+			err = errNoSecurityDescriptor
+		}
+		return
+	}
+
+	sdBytes := make([]byte, size)
+	size, err = unix.Getxattr(path, ntfsACLAttr, sdBytes)
+	if err != nil {
+		return sd, fmt.Errorf("reading %s: %w", ntfsACLAttr, err)
+	}
+
+	sd, err = winacl.NewNtSecurityDescriptor(sdBytes[:size])
+	return
+}
+
+func sidResolve(sid winacl.SID) string {
+	return offlineSIDResolve(sid.String())
+}
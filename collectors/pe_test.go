@@ -0,0 +1,60 @@
+package collectors
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/audibleblink/lpegopher/node"
+)
+
+func TestImportedFunction(t *testing.T) {
+	tests := []struct {
+		fn       string
+		expected string
+	}{
+		{"CreateFileW", "CreateFileW"},
+		{"0x1f", "#31"},
+		{"0x0", "#0"},
+		{"0xnope", "0xnope"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if result := importedFunction(test.fn); result != test.expected {
+			t.Errorf("importedFunction(%q) = %q, expected %q", test.fn, result, test.expected)
+		}
+	}
+}
+
+func TestDoPrintImports(t *testing.T) {
+	useTestVolume(t)
+
+	report := &INode{
+		Path:   "c:/tools/app.exe",
+		Name:   "app.exe",
+		Type:   node.Exe,
+		Parent: "c:/tools",
+		Imports: []*Dep{
+			{Name: "vendor.dll!CreateFileW"},
+			{Name: "ws2_32.dll!0x73"},
+			{Name: "vendor.dll!ReadFile"},
+			{Name: "vendor.dll!CreateFileW"},
+			{Name: "bound.dll!Init"},
+		},
+		DelayImports: []*Dep{{Name: "vendor.dll!DumpState"}},
+		BoundImports: []string{"bound.dll"},
+	}
+	doPrint(report)
+
+	exeID := report.ID()
+	expected := []string{
+		exeID + ",IMPORTS," + hashFor("vendor.dll") + `,"CreateFileW;ReadFile",static`,
+		exeID + ",IMPORTS," + hashFor("ws2_32.dll") + `,"#115",static`,
+		exeID + ",IMPORTS," + hashFor("bound.dll") + `,"Init",bound`,
+		exeID + ",IMPORTS," + hashFor("vendor.dll") + `,"DumpState",delay`,
+	}
+	rows := collectedRows(t, ImportFile)
+	if !slices.Equal(rows, expected) {
+		t.Errorf("Expected imports %q, got %q", expected, rows)
+	}
+}
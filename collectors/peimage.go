@@ -0,0 +1,431 @@
+package collectors
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/audibleblink/lpegopher/node"
+	"github.com/audibleblink/lpegopher/util"
+)
+
+// the data directories of a PE image, by index
+const (
+	exportDirectory      = 0
+	resourceDirectory    = 2
+	securityDirectory    = 4
+	boundImportDirectory = 11
+	delayImportDirectory = 13
+	clrDirectory         = 14
+)
+
+// machines names the architectures of PE images
+var machines = map[uint16]string{
+	pe.IMAGE_FILE_MACHINE_I386:  "x86",
+	pe.IMAGE_FILE_MACHINE_AMD64: "x64",
+	pe.IMAGE_FILE_MACHINE_ARM64: "ARM64",
+	pe.IMAGE_FILE_MACHINE_ARMNT: "ARM",
+	pe.IMAGE_FILE_MACHINE_IA64:  "IA64",
+}
+
+// subsystems names the subsystems PE images run in
+var subsystems = map[uint16]string{
+	pe.IMAGE_SUBSYSTEM_NATIVE:                   "native",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_GUI:              "gui",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_CUI:              "console",
+	pe.IMAGE_SUBSYSTEM_POSIX_CUI:                "posix",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_CE_GUI:           "wince",
+	pe.IMAGE_SUBSYSTEM_EFI_APPLICATION:          "efi",
+	pe.IMAGE_SUBSYSTEM_EFI_BOOT_SERVICE_DRIVER:  "efi",
+	pe.IMAGE_SUBSYSTEM_EFI_RUNTIME_DRIVER:       "efi",
+	pe.IMAGE_SUBSYSTEM_EFI_ROM:                  "efi",
+	pe.IMAGE_SUBSYSTEM_XBOX:                     "xbox",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_BOOT_APPLICATION: "boot",
+}
+
+// maxExports bounds the export table of a damaged or hostile image, and
+// maxThunks each of its import lookup tables
+const (
+	maxExports = 0x10000
+	maxThunks  = 0x10000
+)
+
+// peImage is a PE parsed with debug/pe, for the tables go-pe doesn't expose
+type peImage struct {
+	*pe.File
+	r io.ReaderAt
+}
+
+// newPEImage parses the PE read from r
+func newPEImage(r io.ReaderAt) (*peImage, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	return &peImage{File: f, r: r}, nil
+}
+
+// populateImageTables adds the header metadata, the signature, the manifest
+// and the tables go-pe doesn't parse, from file, the PE at path on the
+// collecting host, to report
+func populateImageTables(report *INode, file io.ReaderAt, path string) error {
+	img, err := newPEImage(file)
+	if err != nil {
+		return fmt.Errorf("headers: %w", err)
+	}
+
+	report.Header = img.header()
+	report.Type = img.nodeType(path)
+	report.Signature = signatureOf(img)
+
+	// the tables don't depend on each other, so one that can't be read
+	// doesn't keep the rest from the report
+	var errs []error
+	if report.Type == node.Dll {
+		report.Exports, err = img.exportTable()
+		report.ExportsParsed = err == nil
+		if err != nil {
+			errs = append(errs, fmt.Errorf("exports: %w", err))
+		}
+	}
+	report.Kind = img.peKind(report, path)
+
+	delayed, err := img.delayImports()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("delay-load imports: %w", err))
+	}
+	for _, imp := range delayed {
+		report.DelayImports = append(report.DelayImports, &Dep{Name: imp})
+	}
+
+	report.DynamicImports, err = img.dynamicImports(delayed)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("dynamic imports: %w", err))
+	}
+
+	report.BoundImports, err = img.boundImports()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("bound imports: %w", err))
+	}
+
+	if report.Header.DotNet {
+		report.AssemblyRefs, err = img.assemblyRefs()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("assembly references: %w", err))
+		}
+	}
+
+	if report.Type == node.Exe {
+		report.Manifest, err = img.manifest()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("manifest: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// header returns the metadata of the image's headers
+func (img *peImage) header() *PEHeader {
+	h := &PEHeader{
+		Machine:   machines[img.FileHeader.Machine],
+		Timestamp: img.FileHeader.TimeDateStamp,
+		DotNet:    img.directory(clrDirectory).VirtualAddress != 0,
+	}
+	if h.Machine == "" {
+		h.Machine = fmt.Sprintf("%#x", img.FileHeader.Machine)
+	}
+
+	var subsystem, dllCharacteristics uint16
+	switch oh := img.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		subsystem, dllCharacteristics = oh.Subsystem, oh.DllCharacteristics
+	case *pe.OptionalHeader64:
+		subsystem, dllCharacteristics = oh.Subsystem, oh.DllCharacteristics
+	}
+	h.Subsystem = subsystems[subsystem]
+
+	// an image without relocations can't be moved, whatever it asks for
+	relocatable := img.FileHeader.Characteristics&pe.IMAGE_FILE_RELOCS_STRIPPED == 0
+	h.ASLR = dllCharacteristics&pe.IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE != 0 && relocatable
+	h.DEP = dllCharacteristics&pe.IMAGE_DLLCHARACTERISTICS_NX_COMPAT != 0
+	h.CFG = dllCharacteristics&pe.IMAGE_DLLCHARACTERISTICS_GUARD_CF != 0
+	h.HighEntropyVA = dllCharacteristics&pe.IMAGE_DLLCHARACTERISTICS_HIGH_ENTROPY_VA != 0
+	return h
+}
+
+// directory returns the data directory at index, which is empty when the
+// image doesn't have one
+func (img *peImage) directory(index int) pe.DataDirectory {
+	var dirs []pe.DataDirectory
+	switch oh := img.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		dirs = oh.DataDirectory[:min(int(oh.NumberOfRvaAndSizes), len(oh.DataDirectory))]
+	case *pe.OptionalHeader64:
+		dirs = oh.DataDirectory[:min(int(oh.NumberOfRvaAndSizes), len(oh.DataDirectory))]
+	}
+	if index >= len(dirs) {
+		return pe.DataDirectory{}
+	}
+	return dirs[index]
+}
+
+// is64 reports whether the image uses the PE32+ format
+func (img *peImage) is64() bool {
+	_, ok := img.OptionalHeader.(*pe.OptionalHeader64)
+	return ok
+}
+
+// imageBase returns the preferred load address of the image
+func (img *peImage) imageBase() uint64 {
+	switch oh := img.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		return uint64(oh.ImageBase)
+	case *pe.OptionalHeader64:
+		return oh.ImageBase
+	}
+	return 0
+}
+
+// headerSize returns the size of the headers, which are mapped at rva 0
+func (img *peImage) headerSize() uint32 {
+	switch oh := img.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		return oh.SizeOfHeaders
+	case *pe.OptionalHeader64:
+		return oh.SizeOfHeaders
+	}
+	return 0
+}
+
+// readRVA reads size bytes at the relative virtual address rva. Sizes come
+// from the image, so the bytes are read before they're allocated for: a
+// bogus size can't make it allocate more than the file holds.
+func (img *peImage) readRVA(rva, size uint32) ([]byte, error) {
+	for _, s := range img.Sections {
+		if rva < s.VirtualAddress || rva-s.VirtualAddress >= max(s.VirtualSize, s.Size) {
+			continue
+		}
+		return readFull(s, int64(rva-s.VirtualAddress), size, rva)
+	}
+
+	// some tables, like bound imports, live in the headers
+	if uint64(rva)+uint64(size) <= uint64(img.headerSize()) {
+		return readFull(img.r, int64(rva), size, rva)
+	}
+	return nil, fmt.Errorf("rva %#x is outside of the image", rva)
+}
+
+// readFull reads the size bytes at offset of r, which hold rva
+func readFull(r io.ReaderAt, offset int64, size, rva uint32) ([]byte, error) {
+	data, err := io.ReadAll(io.NewSectionReader(r, offset, int64(size)))
+	if err == nil && len(data) < int(size) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading rva %#x: %w", rva, err)
+	}
+	return data, nil
+}
+
+// readRVAString reads the NUL-terminated string at rva
+func (img *peImage) readRVAString(rva uint32) (string, error) {
+	for _, s := range img.Sections {
+		if rva < s.VirtualAddress || rva-s.VirtualAddress >= s.Size {
+			continue
+		}
+		data := make([]byte, min(s.Size-(rva-s.VirtualAddress), 512))
+		_, err := s.ReadAt(data, int64(rva-s.VirtualAddress))
+		if err != nil {
+			return "", fmt.Errorf("reading rva %#x: %w", rva, err)
+		}
+		if end := bytes.IndexByte(data, 0); end != -1 {
+			data = data[:end]
+		}
+		return string(data), nil
+	}
+	return "", fmt.Errorf("rva %#x is outside of every section", rva)
+}
+
+// exportTable parses the export directory. Unlike go-pe, it keeps the
+// names of forwarded exports and reports biased ordinals, the ones
+// importers and GetProcAddress use.
+func (img *peImage) exportTable() ([]Export, error) {
+	dir := img.directory(exportDirectory)
+	if dir.VirtualAddress == 0 || dir.Size == 0 {
+		return nil, nil
+	}
+
+	header, err := img.readRVA(dir.VirtualAddress, 40)
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	base := le.Uint32(header[16:])
+	numFuncs := le.Uint32(header[20:])
+	numNames := le.Uint32(header[24:])
+	if numFuncs > maxExports || numNames > maxExports {
+		return nil, fmt.Errorf("export table too large: %d functions, %d names", numFuncs, numNames)
+	}
+
+	funcs, err := img.readRVA(le.Uint32(header[28:]), numFuncs*4)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[uint32]string{}
+	if numNames > 0 {
+		nameRVAs, err := img.readRVA(le.Uint32(header[32:]), numNames*4)
+		if err != nil {
+			return nil, err
+		}
+		nameOrdinals, err := img.readRVA(le.Uint32(header[36:]), numNames*2)
+		if err != nil {
+			return nil, err
+		}
+		for i := uint32(0); i < numNames; i++ {
+			name, err := img.readRVAString(le.Uint32(nameRVAs[i*4:]))
+			if err != nil {
+				return nil, err
+			}
+			names[uint32(le.Uint16(nameOrdinals[i*2:]))] = name
+		}
+	}
+
+	exports := make([]Export, 0, numFuncs)
+	for i := uint32(0); i < numFuncs; i++ {
+		addr := le.Uint32(funcs[i*4:])
+		if addr == 0 {
+			// an unused slot between ordinals
+			continue
+		}
+		export := Export{Name: names[i], Ordinal: base + i}
+
+		// an address inside the export directory names another DLL's
+		// function rather than code
+		if addr >= dir.VirtualAddress && addr-dir.VirtualAddress < dir.Size {
+			export.Forwarder, err = img.readRVAString(addr)
+			if err != nil {
+				return nil, err
+			}
+		}
+		exports = append(exports, export)
+	}
+	return exports, nil
+}
+
+// delayImports parses the delay-load import directory into dll!function
+// entries, the form go-pe gives static imports in
+func (img *peImage) delayImports() ([]string, error) {
+	dir := img.directory(delayImportDirectory)
+	if dir.VirtualAddress == 0 || dir.Size == 0 {
+		return nil, nil
+	}
+
+	const descriptorSize = 32
+	le := binary.LittleEndian
+	var imports []string
+	for rva := dir.VirtualAddress; ; rva += descriptorSize {
+		desc, err := img.readRVA(rva, descriptorSize)
+		if err != nil {
+			return nil, err
+		}
+		nameRVA, intRVA := le.Uint32(desc[4:]), le.Uint32(desc[16:])
+		if nameRVA == 0 {
+			break
+		}
+
+		// descriptors from before Visual C++ 7 hold addresses, not rvas
+		if le.Uint32(desc[0:])&1 == 0 {
+			base := uint32(img.imageBase())
+			nameRVA, intRVA = nameRVA-base, intRVA-base
+		}
+
+		dll, err := img.readRVAString(nameRVA)
+		if err != nil {
+			return nil, err
+		}
+		fns, err := img.thunkNames(intRVA)
+		if err != nil {
+			return nil, err
+		}
+		for _, fn := range fns {
+			imports = append(imports, util.Lower(dll)+"!"+fn)
+		}
+	}
+	return imports, nil
+}
+
+// thunkNames returns the functions named by the import lookup table at rva,
+// with imports by ordinal in hex like go-pe renders them
+func (img *peImage) thunkNames(rva uint32) ([]string, error) {
+	width, ordinalFlag := uint32(4), uint64(1)<<31
+	if img.is64() {
+		width, ordinalFlag = 8, uint64(1)<<63
+	}
+
+	var names []string
+	for i := uint32(0); i < maxThunks; i++ {
+		data, err := img.readRVA(rva+i*width, width)
+		if err != nil {
+			return nil, err
+		}
+		thunk := uint64(binary.LittleEndian.Uint32(data))
+		if width == 8 {
+			thunk = binary.LittleEndian.Uint64(data)
+		}
+		if thunk == 0 {
+			break
+		}
+
+		if thunk&ordinalFlag != 0 {
+			names = append(names, fmt.Sprintf("%#x", thunk&0xffff))
+			continue
+		}
+		// skip the hint preceding the name
+		name, err := img.readRVAString(uint32(thunk) + 2)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// boundImports returns the lowercased names of the DLLs whose imports were
+// bound at link or install time
+func (img *peImage) boundImports() ([]string, error) {
+	dir := img.directory(boundImportDirectory)
+	if dir.VirtualAddress == 0 || dir.Size == 0 {
+		return nil, nil
+	}
+
+	table, err := img.readRVA(dir.VirtualAddress, dir.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	// each descriptor is followed by its forwarder references, which are
+	// laid out like descriptors; module names are offsets from the table
+	const descriptorSize = 8
+	le := binary.LittleEndian
+	var dlls []string
+	for offset := 0; offset+descriptorSize <= len(table); {
+		desc := table[offset:]
+		nameOffset, refs := le.Uint16(desc[4:]), le.Uint16(desc[6:])
+		if le.Uint32(desc) == 0 && nameOffset == 0 {
+			break
+		}
+		if int(nameOffset) < len(table) {
+			name := table[nameOffset:]
+			if end := bytes.IndexByte(name, 0); end != -1 {
+				name = name[:end]
+			}
+			dlls = append(dlls, util.Lower(string(name)))
+		}
+		offset += descriptorSize * (1 + int(refs))
+	}
+	return dlls, nil
+}
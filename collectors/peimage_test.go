@@ -0,0 +1,319 @@
+package collectors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/audibleblink/lpegopher/node"
+)
+
+// testExportsPE builds a PE exporting funcs from ordinal base onwards. A
+// func is a name, "" for one exported by ordinal only, "-" for an unused
+// slot, and name=DLL.Function for a forwarder.
+func testExportsPE(base uint32, funcs []string) []byte {
+	le := binary.LittleEndian
+	const rva = 0x1000
+
+	data := make([]byte, 40+len(funcs)*4)
+	str := func(s string) uint32 {
+		offset := uint32(len(data))
+		data = append(append(data, s...), 0)
+		return rva + offset
+	}
+
+	type named struct {
+		name    string
+		ordinal uint16
+	}
+	var names []named
+	for i, fn := range funcs {
+		addr := uint32(0x2000 + i*0x10)
+		name, forwarder, forwards := strings.Cut(fn, "=")
+		switch {
+		case fn == "-":
+			addr = 0
+		case forwards:
+			addr = str(forwarder)
+		}
+		if fn != "-" && len(name) > 0 {
+			names = append(names, named{name, uint16(i)})
+		}
+		le.PutUint32(data[40+i*4:], addr)
+	}
+
+	nameTable := len(data)
+	data = append(data, make([]byte, len(names)*6)...)
+	for i, n := range names {
+		le.PutUint32(data[nameTable+i*4:], str(n.name))
+		le.PutUint16(data[nameTable+len(names)*4+i*2:], n.ordinal)
+	}
+
+	le.PutUint32(data[16:], base)
+	le.PutUint32(data[20:], uint32(len(funcs)))
+	le.PutUint32(data[24:], uint32(len(names)))
+	le.PutUint32(data[28:], rva+40)
+	le.PutUint32(data[32:], rva+uint32(nameTable))
+	le.PutUint32(data[36:], rva+uint32(nameTable+len(names)*4))
+
+	image := testPE(".edata", data)
+	setTestDirectory(image, exportDirectory, rva, uint32(len(data)))
+	return image
+}
+
+// setTestDirectory points the data directory at index of a testPE image to
+// size bytes at rva
+func setTestDirectory(image []byte, index int, rva, size uint32) {
+	dir := 0x40 + 4 + 20 + 112 + index*8
+	binary.LittleEndian.PutUint32(image[dir:], rva)
+	binary.LittleEndian.PutUint32(image[dir+4:], size)
+}
+
+// testImportsPE builds a PE delay-loading delayed, a map of DLLs to their
+// functions, #N for one imported by ordinal, and with static imports bound
+// to bound, each DLL followed by those it forwards to
+func testImportsPE(delayed map[string][]string, bound [][]string) []byte {
+	le := binary.LittleEndian
+	const rva = 0x1000
+
+	dlls := slices.Sorted(maps.Keys(delayed))
+	data := make([]byte, (len(dlls)+1)*32)
+	str := func(s string) uint32 {
+		offset := uint32(len(data))
+		data = append(append(data, s...), 0)
+		return rva + offset
+	}
+
+	for i, dll := range dlls {
+		names := make([]uint64, len(delayed[dll]))
+		for j, fn := range delayed[dll] {
+			if ordinal, ok := strings.CutPrefix(fn, "#"); ok {
+				n, _ := strconv.Atoi(ordinal)
+				names[j] = 1<<63 | uint64(n)
+				continue
+			}
+			names[j] = uint64(str("\x00\x00" + fn))
+		}
+
+		name := str(dll)
+		le.PutUint32(data[i*32:], 1)
+		le.PutUint32(data[i*32+4:], name)
+		lookupTable := len(data)
+		data = append(data, make([]byte, (len(names)+1)*8)...)
+		for j, name := range names {
+			le.PutUint64(data[lookupTable+j*8:], name)
+		}
+		le.PutUint32(data[i*32+16:], rva+uint32(lookupTable))
+	}
+
+	image := testPE(".didat", data)
+	setTestDirectory(image, delayImportDirectory, rva, uint32(len(data)))
+
+	// bound imports live in the headers, after the section table
+	const boundTable = 0x190
+	var table, names []byte
+	for _, dlls := range bound {
+		for i, dll := range dlls {
+			entry := make([]byte, 8)
+			le.PutUint16(entry[4:], uint16(len(names)))
+			if i == 0 {
+				le.PutUint16(entry[6:], uint16(len(dlls)-1))
+			}
+			table = append(table, entry...)
+			names = append(append(names, dll...), 0)
+		}
+	}
+	table = append(table, make([]byte, 8)...)
+	for offset := 0; offset < len(table)-8; offset += 8 {
+		nameOffset := le.Uint16(table[offset+4:]) + uint16(len(table))
+		le.PutUint16(table[offset+4:], nameOffset)
+	}
+	table = append(table, names...)
+	copy(image[boundTable:], table)
+	if len(bound) > 0 {
+		setTestDirectory(image, boundImportDirectory, boundTable, uint32(len(table)))
+	}
+	return image
+}
+
+func TestExportTable(t *testing.T) {
+	image := testExportsPE(5, []string{"Alpha", "-", "Beta=other.Beta", ""})
+	img, err := newPEImage(bytes.NewReader(image))
+	if err != nil {
+		t.Fatalf("Failed to parse test PE: %v", err)
+	}
+
+	exports, err := img.exportTable()
+	if err != nil {
+		t.Fatalf("Failed to read exports: %v", err)
+	}
+	expected := []Export{
+		{Name: "Alpha", Ordinal: 5},
+		{Name: "Beta", Ordinal: 7, Forwarder: "other.Beta"},
+		{Ordinal: 8},
+	}
+	if !slices.Equal(exports, expected) {
+		t.Errorf("Expected exports %+v, got %+v", expected, exports)
+	}
+
+	t.Run("Images without exports have none", func(t *testing.T) {
+		img, err := newPEImage(bytes.NewReader(testPE(".text", nil)))
+		if err != nil {
+			t.Fatalf("Failed to parse test PE: %v", err)
+		}
+		exports, err := img.exportTable()
+		if err != nil || exports != nil {
+			t.Errorf("Expected no exports, got %+v, %v", exports, err)
+		}
+	})
+
+	t.Run("Dlls without exports have them parsed", func(t *testing.T) {
+		report := &INode{}
+		err := populateImageTables(report, bytes.NewReader(testPE(".text", nil)), "noexports.dll")
+		if err != nil {
+			t.Fatalf("Failed to parse test PE: %v", err)
+		}
+		if report.Type != node.Dll || !report.ExportsParsed || len(report.Exports) != 0 {
+			t.Errorf("Expected a Dll with parsed, empty exports, got %+v", report)
+		}
+	})
+}
+
+func TestImageImports(t *testing.T) {
+	image := testImportsPE(
+		map[string][]string{
+			"Wer.dll":     {"WerReportCreate", "#12"},
+			"dbghelp.dll": {"MiniDumpWriteDump"},
+		},
+		[][]string{{"KERNEL32.dll", "ntdll.dll"}, {"user32.dll"}},
+	)
+	img, err := newPEImage(bytes.NewReader(image))
+	if err != nil {
+		t.Fatalf("Failed to parse test PE: %v", err)
+	}
+
+	delayed, err := img.delayImports()
+	if err != nil {
+		t.Fatalf("Failed to read delay-load imports: %v", err)
+	}
+	expectedDelayed := []string{"wer.dll!WerReportCreate", "wer.dll!0xc", "dbghelp.dll!MiniDumpWriteDump"}
+	slices.Sort(expectedDelayed)
+	slices.Sort(delayed)
+	if !slices.Equal(delayed, expectedDelayed) {
+		t.Errorf("Expected delay-load imports %q, got %q", expectedDelayed, delayed)
+	}
+
+	bound, err := img.boundImports()
+	if err != nil {
+		t.Fatalf("Failed to read bound imports: %v", err)
+	}
+	if expected := []string{"kernel32.dll", "user32.dll"}; !slices.Equal(bound, expected) {
+		t.Errorf("Expected bound imports %q, got %q", expected, bound)
+	}
+}
+
+func TestCorruptTablesDontDropOthers(t *testing.T) {
+	image := testImportsPE(map[string][]string{"helper.dll": {"Run"}}, [][]string{{"kernel32.dll"}})
+	setTestDirectory(image, exportDirectory, 0x7fff0000, 40)
+
+	report := &INode{}
+	err := populateImageTables(report, bytes.NewReader(image), "corrupt.dll")
+	if err == nil || !strings.Contains(err.Error(), "exports") {
+		t.Errorf("Expected the corrupt export directory reported, got %v", err)
+	}
+	if report.ExportsParsed {
+		t.Error("Expected the exports not to be marked parsed")
+	}
+	if len(report.DelayImports) != 1 || report.DelayImports[0].Name != "helper.dll!Run" {
+		t.Errorf("Expected the delay imports despite the exports, got %+v", report.DelayImports)
+	}
+	if !slices.Equal(report.BoundImports, []string{"kernel32.dll"}) {
+		t.Errorf("Expected the bound imports despite the exports, got %q", report.BoundImports)
+	}
+}
+
+func TestImageHeader(t *testing.T) {
+	hardened := testPE(".text", nil)
+	optional := hardened[0x40+4+20:]
+	binary.LittleEndian.PutUint16(optional[70:], 0x4160)
+	setTestDirectory(hardened, clrDirectory, 0x1000, 72)
+
+	stripped := testPE(".text", nil)
+	fileHeader := stripped[0x40+4:]
+	binary.LittleEndian.PutUint16(fileHeader[0:], 0x14c)
+	binary.LittleEndian.PutUint16(fileHeader[18:], 0x2023)
+	binary.LittleEndian.PutUint16(stripped[0x40+4+20+70:], 0x0040)
+
+	tests := []struct {
+		name     string
+		image    []byte
+		expected PEHeader
+	}{
+		{
+			name:  "Hardened .NET images",
+			image: hardened,
+			expected: PEHeader{
+				Machine:       "x64",
+				Subsystem:     "console",
+				ASLR:          true,
+				DEP:           true,
+				CFG:           true,
+				HighEntropyVA: true,
+				DotNet:        true,
+			},
+		},
+		{
+			name:     "Images without relocations can't use ASLR",
+			image:    stripped,
+			expected: PEHeader{Machine: "x86", Subsystem: "console"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := newPEImage(bytes.NewReader(test.image))
+			if err != nil {
+				t.Fatalf("Failed to parse test PE: %v", err)
+			}
+			if h := img.header(); *h != test.expected {
+				t.Errorf("Expected header %+v, got %+v", test.expected, *h)
+			}
+		})
+	}
+}
+
+func TestReadRVA(t *testing.T) {
+	img, err := newPEImage(bytes.NewReader(testPE(".rdata", []byte("lpegopher"))))
+	if err != nil {
+		t.Fatalf("Failed to parse test PE: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		rva     uint32
+		size    uint32
+		want    string
+		wantErr bool
+	}{
+		{"Reads within a section", 0x1002, 5, "egoph", false},
+		{"Reads the headers", 0, 2, "MZ", false},
+		{"Sizes past the end of the file fail", 0x1000, 0xffffffff, "", true},
+		{"Addresses outside of the image fail", 0x90000, 4, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := img.readRVA(test.rva, test.size)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Expected error %v, got %v", test.wantErr, err)
+			}
+			if string(data) != test.want {
+				t.Errorf("Expected %q, got %q", test.want, data)
+			}
+		})
+	}
+}
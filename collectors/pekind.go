@@ -0,0 +1,175 @@
+package collectors
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/audibleblink/lpegopher/node"
+	"github.com/audibleblink/lpegopher/util"
+)
+
+// the kinds of PE collected, recorded as pe_kind
+const (
+	KindExe          = "exe"    // a program
+	KindDll          = "dll"    // a library
+	KindDriver       = "driver" // a kernel-mode driver or library
+	KindControlPanel = "cpl"    // a control panel item
+	KindCOMServer    = "com"    // an in-process COM server
+	KindScreenSaver  = "scr"    // a screen saver
+	KindEFI          = "efi"    // an EFI application or driver
+	KindResources    = "mui"    // a resource-only language pack
+)
+
+// DefaultPEExtensions are the extensions of the files collected as PEs
+// unless configured otherwise
+var DefaultPEExtensions = []string{
+	"exe", "dll", "sys", "cpl", "ocx", "scr", "drv", "ax", "efi", "mui", "node",
+}
+
+var (
+	// sniffPEs makes the collector read the header of every file to find
+	// PEs, rather than going by extension
+	sniffPEs bool
+
+	// peExtensions are the lowercased extensions, without a dot, of the
+	// files collected as PEs when not sniffing
+	peExtensions = extensionSet(DefaultPEExtensions)
+)
+
+// ConfigurePEDetection sets how the collector recognizes PEs: by reading
+// the header of every file when sniff is set, else by the extensions given,
+// or DefaultPEExtensions when there are none. It must run before PE
+// collection.
+func ConfigurePEDetection(sniff bool, extensions []string) {
+	sniffPEs = sniff
+	if len(extensions) == 0 {
+		extensions = DefaultPEExtensions
+	}
+	peExtensions = extensionSet(extensions)
+}
+
+// extensionSet returns the set of extensions, lowercased and without a dot
+func extensionSet(extensions []string) map[string]bool {
+	set := map[string]bool{}
+	for _, ext := range extensions {
+		set[util.Lower(strings.TrimPrefix(ext, "."))] = true
+	}
+	return set
+}
+
+// isPECandidate reports whether the file at path on the collecting host is
+// to be collected as a PE
+func isPECandidate(path string) bool {
+	if sniffPEs {
+		return sniffPE(path)
+	}
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	return ext != "" && peExtensions[util.Lower(ext)]
+}
+
+// sniffPE reports whether the file at path on the collecting host starts
+// with the MZ header of a PE pointing at a PE signature
+func sniffPE(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	dos := make([]byte, 0x40)
+	if _, err := io.ReadFull(file, dos); err != nil || string(dos[:2]) != "MZ" {
+		return false
+	}
+
+	signature := make([]byte, 4)
+	offset := int64(binary.LittleEndian.Uint32(dos[0x3c:]))
+	if _, err := file.ReadAt(signature, offset); err != nil {
+		return false
+	}
+	return string(signature) == "PE\x00\x00"
+}
+
+// nodeTypeByExtension returns the node type of the PE at path from its
+// extension alone, for PEs whose headers can't be read
+func nodeTypeByExtension(path string) string {
+	switch util.Lower(filepath.Ext(path)) {
+	case ".exe", ".scr":
+		return node.Exe
+	default:
+		return node.Dll
+	}
+}
+
+// nodeType returns the node type of img, which is at path. Only programs
+// that run as processes of their own are Exes; everything else a process,
+// the kernel or the firmware loads is a Dll.
+func (img *peImage) nodeType(path string) string {
+	switch img.kernelOrFirmware(path) {
+	case KindDriver, KindEFI:
+		return node.Dll
+	}
+	if img.FileHeader.Characteristics&pe.IMAGE_FILE_DLL != 0 {
+		return node.Dll
+	}
+	return node.Exe
+}
+
+// kernelOrFirmware returns KindDriver or KindEFI when img, which is at path,
+// is loaded by the kernel or the firmware, else ""
+func (img *peImage) kernelOrFirmware(path string) string {
+	var subsystem uint16
+	switch oh := img.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		subsystem = oh.Subsystem
+	case *pe.OptionalHeader64:
+		subsystem = oh.Subsystem
+	}
+
+	switch subsystem {
+	case pe.IMAGE_SUBSYSTEM_EFI_APPLICATION, pe.IMAGE_SUBSYSTEM_EFI_BOOT_SERVICE_DRIVER,
+		pe.IMAGE_SUBSYSTEM_EFI_RUNTIME_DRIVER, pe.IMAGE_SUBSYSTEM_EFI_ROM:
+		return KindEFI
+	case pe.IMAGE_SUBSYSTEM_NATIVE:
+		// native programs like smss.exe run in user mode
+		if util.Lower(filepath.Ext(path)) != ".exe" {
+			return KindDriver
+		}
+	}
+	return ""
+}
+
+// peKind returns the kind of the PE of report, which is at path, from its
+// header, its extension and the functions it exports
+func (img *peImage) peKind(report *INode, path string) string {
+	if kind := img.kernelOrFirmware(path); kind != "" {
+		return kind
+	}
+
+	ext := util.Lower(filepath.Ext(path))
+	if report.Type == node.Exe {
+		if ext == ".scr" {
+			return KindScreenSaver
+		}
+		return KindExe
+	}
+
+	exports := func(name string) bool {
+		return slices.ContainsFunc(report.Exports, func(e Export) bool {
+			return e.Name == name
+		})
+	}
+	switch {
+	case ext == ".mui":
+		return KindResources
+	case ext == ".cpl" || exports("CPlApplet"):
+		return KindControlPanel
+	case ext == ".ocx" || ext == ".ax" || exports("DllGetClassObject"):
+		return KindCOMServer
+	}
+	return KindDll
+}
@@ -0,0 +1,119 @@
+package collectors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/audibleblink/lpegopher/node"
+)
+
+// withTestCharacteristics sets the file characteristics and subsystem of a
+// testPE image
+func withTestCharacteristics(image []byte, characteristics, subsystem uint16) []byte {
+	fileHeader := image[0x40+4:]
+	binary.LittleEndian.PutUint16(fileHeader[18:], characteristics)
+	binary.LittleEndian.PutUint16(fileHeader[20+68:], subsystem)
+	return image
+}
+
+func TestPECandidates(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"driver.sys":    testPE(".text", nil),
+		"helper":        testPE(".text", nil),
+		"readme.txt":    []byte("MZ but not a PE at all, even though it's long enough to hold a header"),
+		"truncated.dll": []byte("MZ"),
+		"notes.exe":     []byte("not a PE"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	t.Cleanup(func() { ConfigurePEDetection(false, nil) })
+
+	tests := []struct {
+		name       string
+		sniff      bool
+		extensions []string
+		expected   map[string]bool
+	}{
+		{
+			name:     "Default extensions",
+			expected: map[string]bool{"driver.sys": true, "truncated.dll": true, "notes.exe": true},
+		},
+		{
+			name:       "Configured extensions",
+			extensions: []string{".EXE"},
+			expected:   map[string]bool{"notes.exe": true},
+		},
+		{
+			name:     "Sniffing finds PEs by their headers",
+			sniff:    true,
+			expected: map[string]bool{"driver.sys": true, "helper": true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ConfigurePEDetection(test.sniff, test.extensions)
+			for name := range files {
+				if got := isPECandidate(filepath.Join(dir, name)); got != test.expected[name] {
+					t.Errorf("Expected %s to be a candidate: %v, got %v", name, test.expected[name], got)
+				}
+			}
+		})
+	}
+}
+
+func TestPEKind(t *testing.T) {
+	const (
+		dll = 0x2022
+		exe = 0x0022
+	)
+
+	tests := []struct {
+		name     string
+		path     string
+		image    []byte
+		nodeType string
+		kind     string
+	}{
+		{"Programs", "app.exe", withTestCharacteristics(testPE(".text", nil), exe, 3), node.Exe, KindExe},
+		{"Programs without an extension", "app", withTestCharacteristics(testPE(".text", nil), exe, 2), node.Exe, KindExe},
+		{"Screen savers", "bubbles.scr", withTestCharacteristics(testPE(".text", nil), exe, 2), node.Exe, KindScreenSaver},
+		{"Native programs", "smss.exe", withTestCharacteristics(testPE(".text", nil), exe, 1), node.Exe, KindExe},
+		{"Drivers", "null.sys", withTestCharacteristics(testPE(".text", nil), exe, 1), node.Dll, KindDriver},
+		{"Kernel libraries", "ci.dll", withTestCharacteristics(testPE(".text", nil), dll, 1), node.Dll, KindDriver},
+		{"EFI applications", "bootmgfw.efi", withTestCharacteristics(testPE(".text", nil), exe, 10), node.Dll, KindEFI},
+		{"Libraries", "helper.dll", testPE(".text", nil), node.Dll, KindDll},
+		{"Control panel items by export", "applet.dll", testExportsPE(1, []string{"CPlApplet"}), node.Dll, KindControlPanel},
+		{"Control panel items by extension", "desk.cpl", testPE(".text", nil), node.Dll, KindControlPanel},
+		{"COM servers by export", "server.dll", testExportsPE(1, []string{"DllCanUnloadNow", "DllGetClassObject"}), node.Dll, KindCOMServer},
+		{"COM servers by extension", "filter.ax", testPE(".text", nil), node.Dll, KindCOMServer},
+		{"Language packs", "shell32.dll.mui", testPE(".rsrc", nil), node.Dll, KindResources},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := newPEImage(bytes.NewReader(test.image))
+			if err != nil {
+				t.Fatalf("Failed to parse test PE: %v", err)
+			}
+
+			report := &INode{Type: img.nodeType(test.path)}
+			if report.Type != test.nodeType {
+				t.Errorf("Expected node type %s, got %s", test.nodeType, report.Type)
+			}
+			if report.Type == node.Dll {
+				report.Exports, _ = img.exportTable()
+			}
+			if kind := img.peKind(report, test.path); kind != test.kind {
+				t.Errorf("Expected kind %s, got %s", test.kind, kind)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package collectors
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/audibleblink/go-winacl"
+
+	"github.com/audibleblink/logerr"
+	"github.com/audibleblink/lpegopher/hive"
+	"github.com/audibleblink/lpegopher/util"
+)
+
+// Locations of the remaining hives and keys that describe accounts on a
+// Windows system volume
+const (
+	softwareHive = `Windows\System32\config\SOFTWARE`
+	samHive      = `Windows\System32\config\SAM`
+	profileList  = `Microsoft\Windows NT\CurrentVersion\ProfileList`
+	samAccount   = `SAM\Domains\Account`
+)
+
+// offlineProfile is a user profile registered on the offline host
+type offlineProfile struct {
+	SID  string
+	Name string
+	Dir  string // the profile directory as the original host knew it
+}
+
+var (
+	// offlineProfiles are the profiles of the offline host, populated by
+	// LoadOfflineAccounts
+	offlineProfiles []offlineProfile
+
+	// offlineAccounts maps the SIDs of the offline host's accounts to
+	// names, so ACEs and runners refer to the same principals
+	offlineAccounts = map[string]string{}
+)
+
+// LoadOfflineAccounts reads the profiles and local accounts of the offline
+// volume. It must run before any offline collector resolves a SID.
+func LoadOfflineAccounts() error {
+	log := logerr.Add("offline accounts")
+
+	localNames := offlineLocalAccounts()
+	computer := offlineComputerName()
+
+	software, err := openOfflineHive(softwareHive)
+	if err != nil {
+		return log.Wrap(err)
+	}
+	defer software.Close()
+
+	profiles, err := software.OpenKey(profileList)
+	if err != nil {
+		return log.Wrap(err)
+	}
+
+	sidKeys, err := profiles.Subkeys()
+	if err != nil {
+		return log.Wrap(err)
+	}
+
+	for _, sidKey := range sidKeys {
+		dir, _, err := sidKey.GetStringValue("ProfileImagePath")
+		if err != nil {
+			log.Debugf("profile %s has no image path: %s", sidKey.Name, err)
+			continue
+		}
+		dir = expandOfflineEnv(dir, "")
+
+		name, ok := localNames[sidKey.Name]
+		switch {
+		case ok && computer != "":
+			name = fmt.Sprintf(`%s\%s`, computer, name)
+		case !ok:
+			name = offlineSIDResolve(sidKey.Name)
+		}
+		if strings.HasPrefix(name, "S-1-") {
+			// not an account Windows knows by name, so go by the
+			// profile directory, which is named after the user
+			name = util.WinBase(dir)
+		}
+
+		offlineAccounts[sidKey.Name] = name
+		offlineProfiles = append(offlineProfiles, offlineProfile{
+			SID:  sidKey.Name,
+			Name: name,
+			Dir:  dir,
+		})
+
+		principal := Principal{Name: name, Type: "user"}
+		principal.Write(writers[PrincipalFile])
+	}
+
+	addUnregisteredProfiles()
+	return nil
+}
+
+// addUnregisteredProfiles adds the directories below Users that hold an
+// NTUSER.DAT but are missing from ProfileList, named after the directory
+func addUnregisteredProfiles() {
+	users, err := volume.LocalPath("Users")
+	if err != nil {
+		return
+	}
+
+	entries, err := os.ReadDir(users)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		dir := volume.Drive + `\Users\` + entry.Name()
+		if !entry.IsDir() || slices.ContainsFunc(offlineProfiles, func(p offlineProfile) bool {
+			return strings.EqualFold(p.Dir, dir)
+		}) {
+			continue
+		}
+		if _, err := volume.LocalPath(dir + `\NTUSER.DAT`); err != nil {
+			continue
+		}
+
+		offlineProfiles = append(offlineProfiles, offlineProfile{Name: entry.Name(), Dir: dir})
+		principal := Principal{Name: entry.Name(), Type: "user"}
+		principal.Write(writers[PrincipalFile])
+	}
+}
+
+// offlineSIDResolve names a SID of the offline host, preferring the names
+// read from its own hives to the well-known names of go-winacl
+func offlineSIDResolve(sidStr string) string {
+	if name, ok := offlineAccounts[sidStr]; ok {
+		return name
+	}
+
+	sid, err := winacl.NewSIDFromString(sidStr)
+	if err != nil {
+		return sidStr
+	}
+	return sid.Resolve()
+}
+
+// offlineLocalAccounts maps the SIDs of the offline host's local accounts to
+// their names using the SAM hive
+func offlineLocalAccounts() map[string]string {
+	log := logerr.Add("offline local accounts")
+	accounts := map[string]string{}
+
+	sam, err := openOfflineHive(samHive)
+	if err != nil {
+		log.Debugf("local account names unavailable: %s", err)
+		return accounts
+	}
+	defer sam.Close()
+
+	account, err := sam.OpenKey(samAccount)
+	if err != nil {
+		log.Debugf("local account names unavailable: %s", err)
+		return accounts
+	}
+
+	// the machine SID's sub-authorities close out the account domain's
+	// V value
+	v, _, err := account.GetBinaryValue("V")
+	if err != nil || len(v) < 12 {
+		log.Debugf("machine SID unavailable: %v", err)
+		return accounts
+	}
+	machineSID := fmt.Sprintf(
+		"S-1-5-21-%d-%d-%d",
+		binary.LittleEndian.Uint32(v[len(v)-12:]),
+		binary.LittleEndian.Uint32(v[len(v)-8:]),
+		binary.LittleEndian.Uint32(v[len(v)-4:]),
+	)
+
+	names, err := account.OpenKey(`Users\Names`)
+	if err != nil {
+		log.Debugf("local account names unavailable: %s", err)
+		return accounts
+	}
+
+	users, err := names.Subkeys()
+	if err != nil {
+		log.Debugf("local account names unavailable: %s", err)
+		return accounts
+	}
+
+	// each user's key is named after the account, and the type of its
+	// default value is the account's RID
+	for _, user := range users {
+		rid, err := user.Value("")
+		if err != nil {
+			continue
+		}
+		accounts[fmt.Sprintf("%s-%d", machineSID, rid.Type)] = user.Name
+	}
+	return accounts
+}
+
+// offlineComputerName reads the offline host's name from its SYSTEM hive
+func offlineComputerName() string {
+	system, err := openOfflineHive(systemHive)
+	if err != nil {
+		return ""
+	}
+	defer system.Close()
+
+	key, err := system.OpenKey(
+		currentControlSet(system) + `\Control\ComputerName\ComputerName`,
+	)
+	if err != nil {
+		return ""
+	}
+
+	name, _, err := key.GetStringValue("ComputerName")
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// expandOfflineEnv expands the environment variables in path that have
+// well-known values on a Windows host, as the original host would have.
+// profileDir fills in the per-user variables, when known.
+func expandOfflineEnv(path, profileDir string) string {
+	drive := strings.ToUpper(volume.Drive)
+	vars := map[string]string{
+		"systemdrive":       drive,
+		"systemroot":        drive + `\Windows`,
+		"windir":            drive + `\Windows`,
+		"programfiles":      drive + `\Program Files`,
+		"programfiles(x86)": drive + `\Program Files (x86)`,
+		"programw6432":      drive + `\Program Files`,
+		"programdata":       drive + `\ProgramData`,
+		"allusersprofile":   drive + `\ProgramData`,
+		"public":            drive + `\Users\Public`,
+	}
+	if profileDir != "" {
+		vars["userprofile"] = profileDir
+		vars["appdata"] = profileDir + `\AppData\Roaming`
+		vars["localappdata"] = profileDir + `\AppData\Local`
+		vars["temp"] = profileDir + `\AppData\Local\Temp`
+		vars["tmp"] = profileDir + `\AppData\Local\Temp`
+	}
+
+	var out strings.Builder
+	for {
+		start := strings.Index(path, "%")
+		if start == -1 {
+			break
+		}
+		end := strings.Index(path[start+1:], "%")
+		if end == -1 {
+			break
+		}
+		end += start + 1
+
+		val, ok := vars[util.Lower(path[start+1:end])]
+		if !ok {
+			// leave unknown variables in place
+			out.WriteString(path[:end])
+			path = path[end:]
+			continue
+		}
+		out.WriteString(path[:start])
+		out.WriteString(val)
+		path = path[end+1:]
+	}
+	out.WriteString(path)
+	return out.String()
+}
+
+// openProfileHive opens the NTUSER.DAT of an offline profile
+func openProfileHive(profile offlineProfile) (*hive.Hive, error) {
+	return openOfflineHive(profile.Dir + `\NTUSER.DAT`)
+}
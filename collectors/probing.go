@@ -0,0 +1,169 @@
+package collectors
+
+import (
+	"encoding/xml"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/audibleblink/lpegopher/util"
+)
+
+// ManagedImport is the kind of import of a managed assembly, which the CLR
+// loads by probing rather than by the DLL search order
+const ManagedImport = "managed"
+
+// frameworkTokens are the public key tokens of the .NET Framework's own
+// assemblies, which the runtime provides when they're in no GAC
+var frameworkTokens = map[string]bool{
+	"b77a5c561934e089": true,
+	"b03f5f7f11d50a3a": true,
+	"31bf3856ad364e35": true,
+	"7cec85d7bea7798e": true,
+	"cc7b13ffcd2ddd51": true,
+}
+
+// FileName returns the name of the file the assembly is probed for
+func (a AssemblyRef) FileName() string {
+	return util.Lower(a.Name) + ".dll"
+}
+
+// appConfig is the part of a .NET application configuration file the
+// collector reads
+type appConfig struct {
+	Probing []struct {
+		PrivatePath string `xml:"privatePath,attr"`
+	} `xml:"runtime>assemblyBinding>probing"`
+}
+
+// privateProbingPaths returns the privatePath directories the .exe.config
+// of the .NET Exe at path on the collecting host adds to probing. Like the
+// CLR, it drops any that aren't below the application directory.
+func privateProbingPaths(path string) []string {
+	data, err := os.ReadFile(path + ".config")
+	if err != nil {
+		return nil
+	}
+
+	var config appConfig
+	if xml.Unmarshal(data, &config) != nil {
+		return nil
+	}
+
+	var paths []string
+	for _, probing := range config.Probing {
+		for _, dir := range strings.Split(probing.PrivatePath, ";") {
+			dir = strings.Trim(strings.ReplaceAll(strings.TrimSpace(dir), "/", `\`), `\`)
+			if dir == "" || strings.Contains(dir, ":") || slices.Contains(strings.Split(dir, `\`), "..") {
+				continue
+			}
+			if !slices.Contains(paths, dir) {
+				paths = append(paths, dir)
+			}
+		}
+	}
+	return paths
+}
+
+// resolveAssembly follows CLR probing for ref as loaded by a managed Exe in
+// appDir with privatePaths. Strong-named assemblies load from the GAC when
+// they're in it; otherwise each probed directory is searched for a DLL, then
+// for an Exe, by the assembly's name. It returns the path the assembly loads
+// from, if any, and the directories probed where a planted copy would load
+// instead.
+func (o *dllSearchOrder) resolveAssembly(appDir string, privatePaths []string, ref AssemblyRef) (resolved string, plantable []string) {
+	if ref.PublicKeyToken != "" {
+		if gac := o.gacAssembly(ref); gac != "" {
+			return gac, nil
+		}
+	}
+
+	name := util.Lower(ref.Name)
+	var dirs []string
+	for _, base := range append([]string{""}, privatePaths...) {
+		dir := appDir
+		if base != "" {
+			dir += `\` + base
+		}
+		if ref.Culture != "" && !strings.EqualFold(ref.Culture, "neutral") {
+			dir += `\` + util.Lower(ref.Culture)
+		}
+		dirs = append(dirs, dir, dir+`\`+name)
+	}
+
+	for _, ext := range []string{".dll", ".exe"} {
+		for _, dir := range dirs {
+			if dirHas(dir, name+ext) {
+				return dir + `\` + name + ext, plantable
+			}
+			if !slices.Contains(plantable, dir) {
+				plantable = append(plantable, dir)
+			}
+		}
+	}
+
+	// the runtime supplies its own assemblies
+	if frameworkTokens[ref.PublicKeyToken] {
+		return "", nil
+	}
+	return "", plantable
+}
+
+// gacAssembly returns the path of ref in the global assembly caches, if
+// it's there. Binding policy usually redirects references to other versions
+// of an assembly in the GAC, so without an exact match the newest version
+// by the same publisher is taken.
+func (o *dllSearchOrder) gacAssembly(ref AssemblyRef) string {
+	name := util.Lower(ref.Name)
+	culture := util.Lower(ref.Culture)
+	if culture == "neutral" {
+		culture = ""
+	}
+
+	var best string
+	var bestVersion []int
+	for _, gac := range o.gacs {
+		dir := gac + `\` + name
+		for _, entry := range readHostDir(dir) {
+			// v4.0_1.0.0.0__b77a5c561934e089 in the .NET 4 GAC,
+			// 1.0.0.0__b77a5c561934e089 in the older one
+			parts := strings.Split(strings.TrimPrefix(util.Lower(entry.Name()), "v4.0_"), "_")
+			if !entry.IsDir() || len(parts) != 3 || parts[1] != culture || parts[2] != ref.PublicKeyToken {
+				continue
+			}
+			path := dir + `\` + entry.Name()
+			if !dirHas(path, name+".dll") {
+				continue
+			}
+			if parts[0] == ref.Version {
+				return path + `\` + name + ".dll"
+			}
+			if version := versionParts(parts[0]); best == "" || slices.Compare(version, bestVersion) > 0 {
+				best, bestVersion = path+`\`+name+".dll", version
+			}
+		}
+	}
+	return best
+}
+
+// writeAssemblyResolutions relates the managed Exe exeID to where each of the
+// assemblies it references loads from, and to the directories a copy could
+// be planted in
+func writeAssemblyResolutions(exeID string, exe *INode) {
+	if searchOrder == nil {
+		return
+	}
+
+	for _, ref := range exe.AssemblyRefs {
+		resolved, plantable := searchOrder.resolveAssembly(exe.Parent, exe.PrivatePaths, ref)
+		if resolved != "" {
+			res := Resolution{Exe: exeID, Rel: ResolvesTo, End: hashFor(resolved), Dll: ref.FileName()}
+			res.Write(writers[ResolutionFile])
+		}
+		for _, dir := range plantable {
+			writeSearchDirectory(dir)
+			res := Resolution{Exe: exeID, Rel: PlantableIn, End: hashFor(dir), Dll: ref.FileName()}
+			res.Write(writers[ResolutionFile])
+		}
+	}
+}
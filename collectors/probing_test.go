@@ -0,0 +1,124 @@
+package collectors
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPrivateProbingPaths(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.exe")
+	config := `<?xml version="1.0" encoding="utf-8"?>
+<configuration>
+  <runtime>
+    <assemblyBinding xmlns="urn:schemas-microsoft-com:asm.v1">
+      <probing privatePath="bin; lib/x64 ;..\shared;C:\Tools;bin"/>
+    </assemblyBinding>
+  </runtime>
+</configuration>`
+	if err := os.WriteFile(path+".config", []byte(config), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	expected := []string{"bin", `lib\x64`}
+	if paths := privateProbingPaths(path); !slices.Equal(paths, expected) {
+		t.Errorf("Expected %q, got %q", expected, paths)
+	}
+
+	if paths := privateProbingPaths(filepath.Join(t.TempDir(), "other.exe")); paths != nil {
+		t.Errorf("Expected no paths without a config, got %q", paths)
+	}
+}
+
+func TestAssemblyProbing(t *testing.T) {
+	mount := useTestVolume(t)
+
+	for _, file := range []string{
+		"Windows/Microsoft.NET/assembly/GAC_MSIL/System.Xml/v4.0_4.0.0.0__b77a5c561934e089/System.Xml.dll",
+		"Windows/Microsoft.NET/assembly/GAC_MSIL/Vendor.Shared/v4.0_2.0.0.0__0123456789abcdef/Vendor.Shared.dll",
+		"Windows/Microsoft.NET/assembly/GAC_MSIL/Vendor.Shared/v4.0_2.1.0.0__0123456789abcdef/Vendor.Shared.dll",
+		"Windows/assembly/GAC_MSIL/Vendor.Legacy/1.0.0.0__0123456789abcdef/Vendor.Legacy.dll",
+		"Program Files/App/App.exe",
+		"Program Files/App/Vendor.Core.dll",
+		"Program Files/App/bin/Vendor.Plugin/Vendor.Plugin.dll",
+		"Program Files/App/fr-fr/Vendor.Strings.dll",
+		"Program Files/App/Vendor.Tool.exe",
+	} {
+		path := filepath.Join(mount, filepath.FromSlash(file))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", file, err)
+		}
+	}
+	LoadSearchOrder()
+
+	appDir := "c:/program files/app"
+	privatePaths := []string{"bin"}
+	gac := `C:\Windows\Microsoft.NET\assembly\GAC_MSIL`
+	tests := []struct {
+		name      string
+		ref       AssemblyRef
+		resolved  string
+		plantable []string
+	}{
+		{
+			name:     "Strong-named assemblies load from the GAC",
+			ref:      AssemblyRef{Name: "System.Xml", Version: "4.0.0.0", PublicKeyToken: "b77a5c561934e089"},
+			resolved: gac + `\system.xml\v4.0_4.0.0.0__b77a5c561934e089\system.xml.dll`,
+		},
+		{
+			name:     "Binding policy takes the newest version in the GAC",
+			ref:      AssemblyRef{Name: "Vendor.Shared", Version: "1.0.0.0", PublicKeyToken: "0123456789abcdef"},
+			resolved: gac + `\vendor.shared\v4.0_2.1.0.0__0123456789abcdef\vendor.shared.dll`,
+		},
+		{
+			name:     "The older GAC is searched too",
+			ref:      AssemblyRef{Name: "Vendor.Legacy", Version: "1.0.0.0", PublicKeyToken: "0123456789abcdef"},
+			resolved: `C:\Windows\assembly\GAC_MSIL\vendor.legacy\1.0.0.0__0123456789abcdef\vendor.legacy.dll`,
+		},
+		{
+			name:     "The application directory is probed first",
+			ref:      AssemblyRef{Name: "Vendor.Core", Version: "1.0.0.0"},
+			resolved: appDir + `\vendor.core.dll`,
+		},
+		{
+			name:      "Private paths are probed after it",
+			ref:       AssemblyRef{Name: "Vendor.Plugin", Version: "1.0.0.0"},
+			resolved:  appDir + `\bin\vendor.plugin\vendor.plugin.dll`,
+			plantable: []string{appDir, appDir + `\vendor.plugin`, appDir + `\bin`},
+		},
+		{
+			name:     "Satellite assemblies are probed in a directory of their culture",
+			ref:      AssemblyRef{Name: "Vendor.Strings", Version: "1.0.0.0", Culture: "fr-FR"},
+			resolved: appDir + `\fr-fr\vendor.strings.dll`,
+		},
+		{
+			name:      "Exes are probed for after DLLs",
+			ref:       AssemblyRef{Name: "Vendor.Tool", Version: "1.0.0.0"},
+			resolved:  appDir + `\vendor.tool.exe`,
+			plantable: []string{appDir, appDir + `\vendor.tool`, appDir + `\bin`, appDir + `\bin\vendor.tool`},
+		},
+		{
+			name:      "Missing assemblies are plantable wherever they're probed for",
+			ref:       AssemblyRef{Name: "Vendor.Missing", Version: "1.0.0.0", PublicKeyToken: "0123456789abcdef"},
+			plantable: []string{appDir, appDir + `\vendor.missing`, appDir + `\bin`, appDir + `\bin\vendor.missing`},
+		},
+		{
+			name: "Missing framework assemblies come from the runtime",
+			ref:  AssemblyRef{Name: "System.Runtime", Version: "4.2.0.0", PublicKeyToken: "b03f5f7f11d50a3a"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolved, plantable := searchOrder.resolveAssembly(appDir, privatePaths, test.ref)
+			if resolved != test.resolved {
+				t.Errorf("Resolved to %q, expected %q", resolved, test.resolved)
+			}
+			if !slices.Equal(plantable, test.plantable) {
+				t.Errorf("Plantable in %v, expected %v", plantable, test.plantable)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package collectors
+
+import (
+	"strings"
+
+	"github.com/audibleblink/lpegopher/util"
+)
+
+// proxyLaunchers extract the file a LOLBin launcher actually runs from its
+// arguments, keyed by the launcher's name. svchost is missing because its
+// arguments only name a service group; service collectors read the
+// ServiceDll instead.
+var proxyLaunchers = map[string]func(args []string) string{
+	"rundll32.exe":   rundll32Payload,
+	"regsvr32.exe":   firstOperand,
+	"cmd.exe":        cmdPayload,
+	"powershell.exe": powershellPayload,
+	"pwsh.exe":       powershellPayload,
+	"wscript.exe":    firstOperand,
+	"cscript.exe":    firstOperand,
+	"mshta.exe":      firstOperand,
+}
+
+// proxyPayload returns the file a runner whose executable is exe hands its
+// arguments to, or nil when exe isn't a known launcher or the payload isn't
+// a file, like the URLs mshta fetches. Payloads without a directory are
+// searched for the way the launcher would find them, with PATHEXT, and are
+// nil when they aren't found on the collected host.
+func proxyPayload(exe, args string) *INode {
+	launcher, ok := proxyLaunchers[util.Lower(util.WinBase(exe))]
+	if !ok {
+		return nil
+	}
+
+	payload := strings.TrimSpace(launcher(util.SplitArgs(args)))
+	if payload == "" {
+		return nil
+	}
+
+	payload = expandRunnerPath(payload)
+	if !isFilePath(payload) {
+		return nil
+	}
+	if !strings.ContainsAny(payload, `\/:`) {
+		appDir := strings.ReplaceAll(util.WinDir(exe), "/", `\`)
+		payload = util.SearchPath(payload, runnerSearchDirs(appDir), util.PathExt, runnerFileExists)
+		if payload == "" {
+			return nil
+		}
+	}
+	return runnerExe(payload)
+}
+
+// isFilePath reports whether a payload names a file rather than a URL or a
+// protocol like javascript:, whose colon comes after a drive letter would
+func isFilePath(payload string) bool {
+	colon := strings.IndexByte(payload, ':')
+	return colon == -1 || colon == 1
+}
+
+// rundll32Payload returns the DLL of `rundll32 <dll>,<entrypoint>`
+func rundll32Payload(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	dll, _, _ := strings.Cut(args[0], ",")
+	return dll
+}
+
+// firstOperand returns the first argument that isn't a switch
+func firstOperand(args []string) string {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "/") && !strings.HasPrefix(arg, "-") {
+			return arg
+		}
+	}
+	return ""
+}
+
+// cmdPayload returns the command cmd runs with /c or /k
+func cmdPayload(args []string) string {
+	for i, arg := range args {
+		switch util.Lower(arg) {
+		case "/c", "/k", "/r":
+			if i+1 < len(args) {
+				return args[i+1]
+			}
+		}
+	}
+	return ""
+}
+
+// powershellPayload returns the script PowerShell runs with -File, which may
+// be abbreviated down to -f
+func powershellPayload(args []string) string {
+	for i, arg := range args {
+		flag := util.Lower(strings.TrimLeft(arg, "-/"))
+		if flag != "" && len(flag) < len(arg) && strings.HasPrefix("file", flag) && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
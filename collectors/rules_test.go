@@ -0,0 +1,169 @@
+package collectors
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// withTestRules sets the tagging rules for the duration of a test
+func withTestRules(t *testing.T, yaml string) {
+	loaded, err := parseRules([]byte(yaml))
+	if err != nil {
+		t.Fatalf("Failed to parse test rules: %v", err)
+	}
+	rules = loaded
+	t.Cleanup(func() {
+		rules = nil
+	})
+}
+
+func TestParseRules(t *testing.T) {
+	valid := `
+rules:
+  - tag: vendor-updater
+    strings: ["update.vendor.com"]
+    imports: [WININET.dll!InternetOpenUrlA, URLDownloadToFileW]
+  - tag: packed
+    sections: [UPX0, .aspack]
+    hex: ["60 e8 ?? ?? ?? ?? 5d"]
+`
+	loaded, err := parseRules([]byte(valid))
+	if err != nil {
+		t.Fatalf("Expected valid rules to parse, got %v", err)
+	}
+	if len(loaded) != 2 || loaded[0].Tag != "vendor-updater" || loaded[1].Tag != "packed" {
+		t.Fatalf("Expected 2 rules, got %+v", loaded)
+	}
+	if !slices.Equal(loaded[0].Imports, []string{"wininet.dll!InternetOpenUrlA", "URLDownloadToFileW"}) {
+		t.Errorf("Expected DLL names to be lowercased, got %v", loaded[0].Imports)
+	}
+	if len(loaded[0].patterns) != 2 || len(loaded[1].patterns) != 1 {
+		t.Errorf("Expected ASCII and UTF-16 patterns for strings, one for hex")
+	}
+
+	if loaded, err := parseRules(nil); err != nil || len(loaded) != 0 {
+		t.Errorf("Expected no rules from an empty file, got %v, %v", loaded, err)
+	}
+
+	invalid := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{"Rules need a tag", "rules: [{strings: [x]}]", "no tag"},
+		{"Rules need criteria", "rules: [{tag: empty}]", "no criteria"},
+		{"Hex must be whole bytes", "rules: [{tag: odd, hex: ['4d 5']}]", "whole number"},
+		{"Hex must be hex", "rules: [{tag: bad, hex: ['4d zz']}]", "invalid byte"},
+		{"Hex can't be all wildcards", "rules: [{tag: any, hex: ['?? ??']}]", "matches anything"},
+		{"Strings can't be empty", "rules: [{tag: blank, strings: ['']}]", "empty string"},
+		{"Unknown keys are rejected", "rules: [{tag: typo, string: [x]}]", "not found"},
+	}
+	for _, test := range invalid {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseRules([]byte(test.yaml))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected an error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestBytePattern(t *testing.T) {
+	pattern, err := parseHexPattern("?? 5a ?? 00")
+	if err != nil {
+		t.Fatalf("Failed to parse hex pattern: %v", err)
+	}
+
+	tests := []struct {
+		data []byte
+		want bool
+	}{
+		{[]byte{0x4d, 0x5a, 0x90, 0x00}, true},
+		{[]byte{0x5a, 0x5a, 0x5a, 0x5a, 0x01, 0x00}, true},
+		{[]byte{0x4d, 0x5a, 0x90, 0x01}, false},
+		{[]byte{0x5a, 0x90, 0x00}, false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if got := pattern.in(test.data); got != test.want {
+			t.Errorf("Expected pattern in % x to be %v, got %v", test.data, test.want, got)
+		}
+	}
+}
+
+func TestScanPatterns(t *testing.T) {
+	// the pattern straddles the first two chunks
+	data := make([]byte, 2*scanChunkSize)
+	copy(data[scanChunkSize-3:], "secret")
+	straddling := literalPattern([]byte("secret"))
+	missing := literalPattern([]byte("absent"))
+
+	found, err := scanPatterns(bytes.NewReader(data), []*bytePattern{straddling, missing})
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	if !found[straddling] || found[missing] {
+		t.Errorf("Expected only the straddling pattern found, got %v", found)
+	}
+}
+
+func TestMatchRules(t *testing.T) {
+	withTestRules(t, `
+rules:
+  - tag: downloader
+    imports: [URLDownloadToFileW, kernel32.dll!CreateFileW]
+  - tag: wrong-dll
+    imports: [user32.dll!CreateFileW]
+  - tag: credentials
+    strings: [Password=]
+  - tag: packed
+    sections: [UPX0]
+  - tag: packed-and-wide
+    sections: [.text]
+    strings: [Password=]
+`)
+
+	report := &INode{
+		Imports:      []*Dep{{Name: "kernel32.dll!CreateFileW"}},
+		DelayImports: []*Dep{{Name: "urlmon.dll!URLDownloadToFileW"}},
+	}
+	content := append([]byte("MZ...."), utf16String("Password=hunter2")...)
+
+	tags, err := matchRules(report, bytes.NewReader(content), []string{".text", ".rdata"})
+	if err != nil {
+		t.Fatalf("Failed to match rules: %v", err)
+	}
+	expected := []string{"downloader", "credentials", "packed-and-wide"}
+	if !slices.Equal(tags, expected) {
+		t.Errorf("Expected tags %v, got %v", expected, tags)
+	}
+}
+
+func TestParsePETags(t *testing.T) {
+	withTestRules(t, `
+rules:
+  - tag: helper-runner
+    imports: [helper.dll!Run]
+    sections: [.didat]
+  - tag: never
+    strings: [not in the file]
+`)
+
+	path := filepath.Join(t.TempDir(), "tagged.exe")
+	image := testImportsPE(map[string][]string{"helper.dll": {"Run"}}, nil)
+	if err := os.WriteFile(path, image, 0o644); err != nil {
+		t.Fatalf("Failed to write test PE: %v", err)
+	}
+
+	report := newPEReport(path)
+	if err := parsePE(report, path); err != nil {
+		t.Fatalf("Failed to parse test PE: %v", err)
+	}
+	if !slices.Equal(report.Tags, []string{"helper-runner"}) {
+		t.Errorf("Expected the PE tagged helper-runner, got %v", report.Tags)
+	}
+}
@@ -0,0 +1,191 @@
+package collectors
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"github.com/audibleblink/lpegopher/node"
+	"github.com/audibleblink/lpegopher/util"
+)
+
+// serviceStartTypes names the values of a service's Start setting
+var serviceStartTypes = map[uint32]string{
+	0: "boot",
+	1: "system",
+	2: "auto",
+	3: "demand",
+	4: "disabled",
+}
+
+// serviceWin32 matches the own-process and shared-process service types,
+// the only kinds the SCM reports when listing services
+const serviceWin32 = 0x00000030
+
+// runnerExe builds the INode for the executable at the Windows path a runner
+// launches
+func runnerExe(path string) *INode {
+	return &INode{
+		Path:   path,
+		Name:   util.WinBase(path),
+		Parent: util.WinDir(path),
+	}
+}
+
+// parseRunnerCommandLine splits a runner's command line, which may still
+// hold environment variables, checking the candidate binaries against the
+// collected host's filesystem
+func parseRunnerCommandLine(cmdline string) util.CommandLine {
+	return util.ParseCommandLine(expandRunnerPath(cmdline), runnerSearchDirs(""), runnerFileExists)
+}
+
+// runnerSearchDirs returns where CreateProcess looks for a binary a runner
+// names without a directory, when launched by the program in appDir.
+// Runners are started by services.exe, svchost and the like, which run from
+// and in System32, so it stands in for the current directory, and for
+// appDir when that's unknown.
+func runnerSearchDirs(appDir string) []string {
+	root := systemRoot()
+	if root == "" {
+		return nil
+	}
+	if appDir == "" {
+		appDir = root + `\System32`
+	}
+
+	var pathDirs []string
+	if searchOrder != nil {
+		pathDirs = searchOrder.dirs
+	}
+	return util.CreateProcessDirs(appDir, root+`\System32`, root, pathDirs)
+}
+
+// precedingCandidates returns the paths CreateProcess tries before the
+// binary of cmd
+func precedingCandidates(cmd util.CommandLine) []string {
+	if len(cmd.Candidates) < 2 {
+		return nil
+	}
+	return cmd.Candidates[:len(cmd.Candidates)-1]
+}
+
+// runnerFileExists reports whether the Windows path of a runner's binary
+// names a file on the collected host
+func runnerFileExists(winPath string) bool {
+	local, err := localPath(winPath)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(local)
+	return err == nil && !info.IsDir()
+}
+
+// scriptExtensions are the extensions of the scripts interpreter runners run
+var scriptExtensions = []string{
+	".bat", ".cmd", ".ps1", ".psm1", ".vbs", ".vbe", ".js", ".jse", ".wsf", ".wsh", ".hta",
+}
+
+// isScript reports whether the Windows path of a runner's payload names a
+// script rather than a PE
+func isScript(winPath string) bool {
+	return slices.Contains(scriptExtensions, util.Lower(path.Ext(util.WinBase(winPath))))
+}
+
+// newScriptReport builds the report for the script found at path on the
+// collecting host
+func newScriptReport(path string) *INode {
+	report := &INode{}
+	report.Path = hostPath(path)
+	report.Name = filepath.Base(report.Path)
+	report.Type = node.Script
+	report.Parent = hostPath(filepath.Dir(path))
+	err := handlePerms(report, path)
+	if err != nil {
+		return report
+	}
+	return report
+}
+
+// newServiceRunner builds a service runner from its configuration, which
+// reads the same whether it comes from the SCM or an offline SYSTEM hive.
+// serviceDll is the DLL svchost loads for shared services, if any.
+func newServiceRunner(name, binaryPath, startName string, startType uint32, serviceDll string) PERunner {
+	cmd := parseRunnerCommandLine(binaryPath)
+	runner := PERunner{
+		Name:    name,
+		Type:    "service",
+		Args:    cmd.RawArgs,
+		Exe:     runnerExe(cmd.Binary),
+		Context: &Principal{Name: startName},
+		Start:   serviceStartTypes[startType],
+
+		Candidates: precedingCandidates(cmd),
+	}
+	if serviceDll != "" {
+		runner.Payload = runnerExe(expandRunnerPath(serviceDll))
+	}
+	return runner
+}
+
+// newAutorunRunner builds the runner for a Run-key entry called name
+func newAutorunRunner(name, cmdline string, context *Principal) PERunner {
+	cmd := parseRunnerCommandLine(cmdline)
+	return PERunner{
+		Name:    name,
+		Type:    "autorun",
+		Args:    cmd.RawArgs,
+		Exe:     runnerExe(cmd.Binary),
+		Context: context,
+
+		Candidates: precedingCandidates(cmd),
+	}
+}
+
+// newTaskRunner builds the runner for a task action that launches the
+// executable at path
+func newTaskRunner(name, path, args string, context *Principal, runLevel string) PERunner {
+	return PERunner{
+		Name:     name,
+		Type:     "task",
+		Args:     args,
+		Exe:      runnerExe(path),
+		Context:  context,
+		RunLevel: runLevel,
+	}
+}
+
+// writeRunner writes a runner along with its principal, the directories its
+// candidates would be planted in and, when it runs a script, the script. Its
+// executable and PE payloads are related by path to
+// the PEs collected, so they aren't written here: a partial row would take
+// the place of the full one in the cache.
+func writeRunner(runner PERunner) {
+	if runner.Payload == nil {
+		runner.Payload = proxyPayload(runner.Exe.Path, runner.Args)
+	}
+
+	if runner.Payload != nil && isScript(runner.Payload.Path) {
+		local, err := localPath(runner.Payload.Path)
+		if err == nil && runnerFileExists(runner.Payload.Path) {
+			doPrint(newScriptReport(local))
+		}
+	}
+	runner.Context.Write(writers[PrincipalFile])
+	runnerID := runner.Write(writers[RunnersFile])
+
+	for _, path := range runner.Candidates {
+		candidate := Candidate{Runner: runnerID, Path: path}
+		candidate.Write(writers[CandidateFile])
+
+		// candidates sit in directories that may hold no PE
+		local, err := localPath(util.WinDir(path))
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(local)
+		if err == nil && info.IsDir() {
+			writeDirectory(local)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package collectors
+
+// comServer returns the binary registered for the COM class clsid, which can
+// only be read from an offline volume on this platform
+func comServer(clsid string) string {
+	return offlineCOMServer(clsid)
+}
+
+// sessionManagerDLLs returns the KnownDLLs of native and WOW64 processes and
+// the system PATH of the collected host, which can only be an offline volume
+// on this platform
+func sessionManagerDLLs() (known, known32 []string, pathVar string) {
+	return offlineSessionManagerDLLs()
+}
+
+// devOverrideEnabled reports whether DotLocal redirection applies to Exes
+// with a manifest on the collected host, which can only be an offline
+// volume on this platform
+func devOverrideEnabled() bool {
+	return offlineDevOverrideEnabled()
+}
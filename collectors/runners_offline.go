@@ -0,0 +1,223 @@
+package collectors
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/audibleblink/logerr"
+	"github.com/audibleblink/lpegopher/hive"
+)
+
+// systemHive is the location of the SYSTEM hive on a Windows system volume
+const systemHive = `Windows\System32\config\SYSTEM`
+
+// openOfflineHive opens the hive at the Windows path winPath on the offline
+// volume
+func openOfflineHive(winPath string) (*hive.Hive, error) {
+	if volume == nil {
+		return nil, fmt.Errorf("no offline volume in use")
+	}
+
+	local, err := volume.LocalPath(winPath)
+	if err != nil {
+		return nil, err
+	}
+	return hive.Open(local)
+}
+
+// currentControlSet returns the name of the control set the offline host
+// last booted with, falling back to ControlSet001
+func currentControlSet(system *hive.Hive) string {
+	current := uint64(1)
+	sel, err := system.OpenKey("Select")
+	if err == nil {
+		if val, _, err := sel.GetIntegerValue("Current"); err == nil && val > 0 {
+			current = val
+		}
+	}
+	return fmt.Sprintf("ControlSet%03d", current)
+}
+
+// OfflineServices collects service runners from the SYSTEM hive of the
+// offline volume
+func OfflineServices() {
+	log := logerr.Add("offline services")
+	defer logerr.ClearContext()
+
+	system, err := openOfflineHive(systemHive)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	defer system.Close()
+
+	services, err := system.OpenKey(currentControlSet(system) + `\Services`)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+
+	svcKeys, err := services.Subkeys()
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+
+	for _, svcKey := range svcKeys {
+		svcType, _, err := svcKey.GetIntegerValue("Type")
+		if err != nil || svcType&serviceWin32 == 0 {
+			// drivers and other non-Win32 services aren't listed by the SCM
+			continue
+		}
+
+		imagePath, _, err := svcKey.GetStringValue("ImagePath")
+		if err != nil {
+			log.Debugf("service %s has no image path: %s", svcKey.Name, err)
+			continue
+		}
+
+		start, _, err := svcKey.GetIntegerValue("Start")
+		if err != nil {
+			log.Debugf("service %s has no start type: %s", svcKey.Name, err)
+			start = math.MaxUint32 // not a start type, so it's left blank
+		}
+
+		// services without an explicit account run as LocalSystem
+		objectName, _, err := svcKey.GetStringValue("ObjectName")
+		if err != nil || objectName == "" {
+			objectName = "LocalSystem"
+		}
+
+		// localized display names are resource references that only
+		// the live SCM can resolve
+		displayName, _, err := svcKey.GetStringValue("DisplayName")
+		if err != nil || displayName == "" || strings.HasPrefix(displayName, "@") {
+			displayName = svcKey.Name
+		}
+
+		service := newServiceRunner(displayName, imagePath, objectName, uint32(start), offlineServiceDll(svcKey))
+		writeRunner(service)
+	}
+}
+
+// offlineServiceDll returns the DLL svchost loads for a shared service,
+// which is usually set in its Parameters key
+func offlineServiceDll(svcKey *hive.Key) string {
+	params, err := svcKey.OpenKey("Parameters")
+	if err == nil {
+		if dll, _, err := params.GetStringValue("ServiceDll"); err == nil {
+			return dll
+		}
+	}
+	dll, _, _ := svcKey.GetStringValue("ServiceDll")
+	return dll
+}
+
+// runKeys are the Run-style keys found below both HKLM\Software and
+// HKCU\Software
+var runKeys = []string{
+	`Microsoft\Windows\CurrentVersion\Run`,
+	`Microsoft\Windows\CurrentVersion\RunOnce`,
+	`Microsoft\Windows\CurrentVersion\RunServices`,
+	`Microsoft\Windows\CurrentVersion\RunServicesOnce`,
+}
+
+// OfflineAutoruns collects Run-key runners from the SOFTWARE hive and the
+// NTUSER.DAT of every profile on the offline volume. HKCU entries run as
+// the profile's owner.
+func OfflineAutoruns() {
+	log := logerr.Add("offline autoruns")
+	defer logerr.ClearContext()
+
+	software, err := openOfflineHive(softwareHive)
+	if err != nil {
+		log.Error(err.Error())
+	} else {
+		// machine-wide entries run as whoever logs on
+		root, err := software.Root()
+		if err == nil {
+			offlineRunKeys(root, "", &Principal{Name: "unknown"})
+		}
+		software.Close()
+	}
+
+	for _, profile := range offlineProfiles {
+		ntuser, err := openProfileHive(profile)
+		if err != nil {
+			log.Debugf("unable to open hive of %s: %s", profile.Name, err)
+			continue
+		}
+
+		userSoftware, err := ntuser.OpenKey("Software")
+		if err == nil {
+			offlineRunKeys(userSoftware, profile.Dir, &Principal{Name: profile.Name})
+		}
+		ntuser.Close()
+	}
+}
+
+// offlineRunKeys writes a runner for every value of the runKeys below
+// software
+func offlineRunKeys(software *hive.Key, profileDir string, context *Principal) {
+	log := logerr.Add("offline run keys")
+
+	for _, subKey := range runKeys {
+		key, err := software.OpenKey(subKey)
+		if err != nil {
+			log.Debugf("unable to read key: %s", err)
+			continue
+		}
+
+		valueNames, err := key.ReadValueNames()
+		if err != nil {
+			log.Debugf("unable to read values: %s", err)
+			continue
+		}
+
+		for _, valueName := range valueNames {
+			val, _, err := key.GetStringValue(valueName)
+			if err != nil {
+				log.Debugf("unable to read value: %s", err)
+				continue
+			}
+
+			cmdline := expandOfflineEnv(val, profileDir)
+			autorun := newAutorunRunner(valueName, cmdline, context)
+			writeRunner(autorun)
+		}
+	}
+}
+
+// comClassKeys are the SOFTWARE hive keys COM classes are registered below
+var comClassKeys = []string{`Classes\CLSID`, `Classes\Wow6432Node\CLSID`}
+
+// offlineCOMServer returns the binary the offline host registered for the
+// COM class clsid
+func offlineCOMServer(clsid string) string {
+	software, err := openOfflineHive(softwareHive)
+	if err != nil {
+		return ""
+	}
+	defer software.Close()
+
+	for _, classes := range comClassKeys {
+		class, err := software.OpenKey(classes + `\` + clsid)
+		if err != nil {
+			continue
+		}
+
+		path := comServerPath(func(subKey string) (string, error) {
+			key, err := class.OpenKey(subKey)
+			if err != nil {
+				return "", err
+			}
+			val, _, err := key.GetStringValue("")
+			return val, err
+		})
+		if path != "" {
+			return path
+		}
+	}
+	return ""
+}
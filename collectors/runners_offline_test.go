@@ -0,0 +1,343 @@
+package collectors
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/audibleblink/lpegopher/hive"
+	"github.com/audibleblink/lpegopher/hive/hivetest"
+)
+
+// useTestVolume points the offline collectors at a temporary volume and
+// output directory for the duration of a test
+func useTestVolume(t *testing.T) string {
+	mount := t.TempDir()
+	outDir := t.TempDir()
+
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	os.Chdir(outDir)
+
+	if _, err := UseOfflineVolume(mount, "c:"); err != nil {
+		t.Fatalf("UseOfflineVolume returned error: %v", err)
+	}
+	InitOutputFiles()
+
+	t.Cleanup(func() {
+		volume = nil
+		offlineProfiles = nil
+		offlineAccounts = map[string]string{}
+		searchOrder = nil
+		dirListings = &sync.Map{}
+		os.Chdir(origDir)
+	})
+	return mount
+}
+
+// collectedRows flushes collector output and returns the rows of file
+func collectedRows(t *testing.T, file string) []string {
+	FlushAndClose()
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", file, err)
+	}
+	return strings.Split(strings.TrimSpace(string(content)), "\n")
+}
+
+func TestOfflineServices(t *testing.T) {
+	mount := useTestVolume(t)
+
+	b := hivetest.New()
+	vendor := b.Key("VendorSvc", nil, []uint32{
+		b.Value("ImagePath", hive.EXPAND_SZ, hivetest.SZ(`"C:\Program Files\Vendor\svc.exe" -run`)),
+		b.Value("ObjectName", hive.SZ, hivetest.SZ(`NT AUTHORITY\LocalService`)),
+		b.Value("DisplayName", hive.SZ, hivetest.SZ("Vendor Service")),
+		b.Value("Start", hive.DWORD, hivetest.DWORD(2)),
+		b.Value("Type", hive.DWORD, hivetest.DWORD(0x10)),
+	})
+	params := b.Key("Parameters", nil, []uint32{
+		b.Value("ServiceDll", hive.EXPAND_SZ, hivetest.SZ(`%systemroot%\system32\schedsvc.dll`)),
+	})
+	shared := b.Key("Schedule", []uint32{params}, []uint32{
+		b.Value("ImagePath", hive.EXPAND_SZ, hivetest.SZ(`C:\Windows\system32\svchost.exe -k netsvcs`)),
+		b.Value("DisplayName", hive.SZ, hivetest.SZ("@%SystemRoot%\\system32\\schedsvc.dll,-100")),
+		b.Value("Start", hive.DWORD, hivetest.DWORD(4)),
+		b.Value("Type", hive.DWORD, hivetest.DWORD(0x20)),
+	})
+	driver := b.Key("Disk", nil, []uint32{
+		b.Value("ImagePath", hive.EXPAND_SZ, hivetest.SZ(`System32\drivers\disk.sys`)),
+		b.Value("Type", hive.DWORD, hivetest.DWORD(0x1)),
+	})
+	services := b.Key("Services", []uint32{vendor, shared, driver}, nil)
+	controlSet := b.Key("ControlSet002", []uint32{services}, nil)
+	sel := b.Key("Select", nil, []uint32{b.Value("Current", hive.DWORD, hivetest.DWORD(2))})
+	root := b.Key("ROOT", []uint32{controlSet, sel}, nil)
+
+	err := b.WriteFile(filepath.Join(mount, "Windows", "System32", "config", "SYSTEM"), root)
+	if err != nil {
+		t.Fatalf("Failed to write test hive: %v", err)
+	}
+
+	OfflineServices()
+	rows := collectedRows(t, RunnersFile)
+
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 service runners, got %d: %v", len(rows), rows)
+	}
+
+	expected := [][]string{
+		{"vendor service", "service", "c:/program files/vendor/svc.exe", "svc.exe", "c:/program files/vendor", `nt authority\localservice`, "", "auto", `"-run"`, ""},
+		{"schedule", "service", "c:/windows/system32/svchost.exe", "svchost.exe", "c:/windows/system32", "localsystem", "", "disabled", `"-k netsvcs"`, "c:/windows/system32/schedsvc.dll"},
+	}
+	for i, row := range rows {
+		fields := strings.Split(row, ",")
+		for j, want := range expected[i] {
+			if fields[j+1] != want {
+				t.Errorf("Runner %d field %d = %q, expected %q", i, j+1, fields[j+1], want)
+			}
+		}
+	}
+}
+
+func TestUnquotedServiceCandidates(t *testing.T) {
+	mount := useTestVolume(t)
+
+	b := hivetest.New()
+	svc := b.Key("Unquoted", nil, []uint32{
+		b.Value("ImagePath", hive.EXPAND_SZ, hivetest.SZ(`C:\Program Files\Vendor App\svc.exe -run`)),
+		b.Value("Start", hive.DWORD, hivetest.DWORD(2)),
+		b.Value("Type", hive.DWORD, hivetest.DWORD(0x10)),
+	})
+	services := b.Key("Services", []uint32{svc}, nil)
+	controlSet := b.Key("ControlSet001", []uint32{services}, nil)
+	err := b.WriteFile(filepath.Join(mount, "Windows", "System32", "config", "SYSTEM"), b.Key("ROOT", []uint32{controlSet}, nil))
+	if err != nil {
+		t.Fatalf("Failed to write test hive: %v", err)
+	}
+
+	OfflineServices()
+	runners := collectedRows(t, RunnersFile)
+	candidates, err := os.ReadFile(CandidateFile)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", CandidateFile, err)
+	}
+
+	runnerID := strings.Split(runners[0], ",")[0]
+	expected := runnerID + ",c:/program.exe,program.exe,c:/\n" +
+		runnerID + ",c:/program files/vendor.exe,vendor.exe,c:/program files\n"
+	if string(candidates) != expected {
+		t.Errorf("Expected candidates\n%s\ngot\n%s", expected, candidates)
+	}
+}
+
+func TestOfflineAutoruns(t *testing.T) {
+	mount := useTestVolume(t)
+	config := filepath.Join(mount, "Windows", "System32", "config")
+	machineSID := "S-1-5-21-1-2-3"
+	aliceSID := machineSID + "-1001"
+
+	// SYSTEM names the computer
+	b := hivetest.New()
+	name := b.Key("ComputerName", nil, []uint32{
+		b.Value("ComputerName", hive.SZ, hivetest.SZ("DESK")),
+	})
+	computerName := b.Key("ComputerName", []uint32{name}, nil)
+	control := b.Key("Control", []uint32{computerName}, nil)
+	controlSet := b.Key("ControlSet001", []uint32{control}, nil)
+	if err := b.WriteFile(filepath.Join(config, "SYSTEM"), b.Key("ROOT", []uint32{controlSet}, nil)); err != nil {
+		t.Fatalf("Failed to write test hive: %v", err)
+	}
+
+	// SAM maps alice's RID to her name
+	b = hivetest.New()
+	v := append(make([]byte, 8), hivetest.DWORD(1)...)
+	v = append(v, hivetest.DWORD(2)...)
+	v = append(v, hivetest.DWORD(3)...)
+	alice := b.Key("alice", nil, []uint32{b.Value("", 1001, nil)})
+	names := b.Key("Names", []uint32{alice}, nil)
+	users := b.Key("Users", []uint32{names}, nil)
+	account := b.Key("Account", []uint32{users}, []uint32{b.Value("V", hive.BINARY, v)})
+	domains := b.Key("Domains", []uint32{account}, nil)
+	sam := b.Key("SAM", []uint32{domains}, nil)
+	if err := b.WriteFile(filepath.Join(config, "SAM"), b.Key("ROOT", []uint32{sam}, nil)); err != nil {
+		t.Fatalf("Failed to write test hive: %v", err)
+	}
+
+	// SOFTWARE registers alice's profile and a machine-wide Run entry
+	b = hivetest.New()
+	aliceProfile := b.Key(aliceSID, nil, []uint32{
+		b.Value("ProfileImagePath", hive.EXPAND_SZ, hivetest.SZ(`%SystemDrive%\Users\alice`)),
+	})
+	profiles := b.Key("ProfileList", []uint32{aliceProfile}, nil)
+	currentVersionNT := b.Key("CurrentVersion", []uint32{profiles}, nil)
+	windowsNT := b.Key("Windows NT", []uint32{currentVersionNT}, nil)
+	run := b.Key("Run", nil, []uint32{
+		b.Value("Updater", hive.SZ, hivetest.SZ(`"C:\Program Files\Vendor\update.exe" /silent`)),
+	})
+	currentVersion := b.Key("CurrentVersion", []uint32{run}, nil)
+	windows := b.Key("Windows", []uint32{currentVersion}, nil)
+	microsoft := b.Key("Microsoft", []uint32{windowsNT, windows}, nil)
+	if err := b.WriteFile(filepath.Join(config, "SOFTWARE"), b.Key("ROOT", []uint32{microsoft}, nil)); err != nil {
+		t.Fatalf("Failed to write test hive: %v", err)
+	}
+
+	// alice's NTUSER.DAT starts an app from her profile
+	b = hivetest.New()
+	run = b.Key("Run", nil, []uint32{
+		b.Value("Chat", hive.EXPAND_SZ, hivetest.SZ(`%LOCALAPPDATA%\Chat\chat.exe --tray`)),
+	})
+	currentVersion = b.Key("CurrentVersion", []uint32{run}, nil)
+	windows = b.Key("Windows", []uint32{currentVersion}, nil)
+	microsoft = b.Key("Microsoft", []uint32{windows}, nil)
+	software := b.Key("Software", []uint32{microsoft}, nil)
+	ntuser := filepath.Join(mount, "Users", "alice", "NTUSER.DAT")
+	if err := b.WriteFile(ntuser, b.Key("ROOT", []uint32{software}, nil)); err != nil {
+		t.Fatalf("Failed to write test hive: %v", err)
+	}
+
+	if err := LoadOfflineAccounts(); err != nil {
+		t.Fatalf("LoadOfflineAccounts returned error: %v", err)
+	}
+	if got := offlineSIDResolve(aliceSID); got != `DESK\alice` {
+		t.Errorf("Expected alice's SID to resolve to DESK\\alice, got %s", got)
+	}
+
+	OfflineAutoruns()
+	rows := collectedRows(t, RunnersFile)
+
+	expected := map[string][]string{
+		"updater": {"autorun", "c:/program files/vendor/update.exe", "update.exe", "c:/program files/vendor", "unknown"},
+		"chat":    {"autorun", "c:/users/alice/appdata/local/chat/chat.exe", "chat.exe", "c:/users/alice/appdata/local/chat", `desk\alice`},
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("Expected %d autorun runners, got %d: %v", len(expected), len(rows), rows)
+	}
+	for _, row := range rows {
+		fields := strings.Split(row, ",")
+		want, ok := expected[fields[1]]
+		if !ok {
+			t.Errorf("Unexpected runner %s", row)
+			continue
+		}
+		for j, field := range want {
+			if fields[j+2] != field {
+				t.Errorf("Runner %s field %d = %q, expected %q", fields[1], j+2, fields[j+2], field)
+			}
+		}
+	}
+}
+
+func TestExpandOfflineEnv(t *testing.T) {
+	useTestVolume(t)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`%SystemRoot%\system32\svchost.exe`, `C:\Windows\system32\svchost.exe`},
+		{`%ProgramFiles(x86)%\App\app.exe`, `C:\Program Files (x86)\App\app.exe`},
+		{`%APPDATA%\app.exe`, `C:\Users\bob\AppData\Roaming\app.exe`},
+		{`%UNKNOWN%\app.exe %windir%`, `%UNKNOWN%\app.exe C:\Windows`},
+		{`C:\no\vars.exe`, `C:\no\vars.exe`},
+	}
+
+	for _, test := range tests {
+		result := expandOfflineEnv(test.input, `C:\Users\bob`)
+		if result != test.expected {
+			t.Errorf("expandOfflineEnv(%q) = %q, expected %q", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestParseRunnerCommandLine(t *testing.T) {
+	mount := useTestVolume(t)
+
+	planted := filepath.Join(mount, "Program Files", "Vendor.exe")
+	if err := os.MkdirAll(filepath.Dir(planted), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(planted, nil, 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cmd := parseRunnerCommandLine(`%ProgramFiles%\Vendor App\svc.exe -run`)
+	if cmd.Binary != `C:\Program Files\Vendor.exe` {
+		t.Errorf("Expected the planted binary on the volume to win, got %s", cmd.Binary)
+	}
+	if cmd.RawArgs != `App\svc.exe -run` {
+		t.Errorf("Unexpected args %q", cmd.RawArgs)
+	}
+
+	svchost := filepath.Join(mount, "Windows", "System32", "svchost.exe")
+	if err := os.MkdirAll(filepath.Dir(svchost), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(svchost, nil, 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cmd = parseRunnerCommandLine(`svchost -k netsvcs`)
+	if cmd.Binary != `C:\Windows\System32\svchost.exe` {
+		t.Errorf("Expected a binary without a directory to be found in System32, got %s", cmd.Binary)
+	}
+}
+
+func TestWriteRunnerScripts(t *testing.T) {
+	mount := useTestVolume(t)
+
+	script := filepath.Join(mount, "Scripts", "logon.bat")
+	if err := os.MkdirAll(filepath.Dir(script), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(script, []byte("@echo off"), 0o644); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+
+	context := &Principal{Name: "scriptuser"}
+	writeRunner(newAutorunRunner("WriteRunnerScript", `cmd.exe /c C:\Scripts\logon.bat`, context))
+	writeRunner(newAutorunRunner("WriteRunnerMissingScript", `cmd.exe /c C:\Scripts\gone.ps1`, context))
+	writeRunner(newAutorunRunner("WriteRunnerDll", `rundll32.exe C:\Scripts\payload.dll,Run`, context))
+
+	scripts := collectedRows(t, ScriptFile)
+	if len(scripts) != 1 || !strings.Contains(scripts[0], "/scripts/logon.bat") {
+		t.Errorf("Expected only the script on the volume to be written, got %q", scripts)
+	}
+	for _, file := range []string{ExeFile, DllFile} {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file, err)
+		}
+		if len(content) != 0 {
+			t.Errorf("Expected runners to write no PEs to %s, got %q", file, content)
+		}
+	}
+}
+
+func TestWriteRunnerCandidateDirs(t *testing.T) {
+	mount := useTestVolume(t)
+
+	if err := os.MkdirAll(filepath.Join(mount, "Candidate Dirs", "Vendor App"), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	context := &Principal{Name: "candidateuser"}
+	writeRunner(newAutorunRunner("CandidateDirs", `C:\Candidate Dirs\Vendor App\app.exe -run`, context))
+	writeRunner(newAutorunRunner("MissingCandidateDirs", `C:\Missing Dirs\Vendor App\app.exe`, context))
+
+	dirs := collectedRows(t, DirFile)
+	var written []string
+	for _, row := range dirs {
+		fields := strings.Split(row, ",")
+		if len(fields) > 2 && strings.Contains(fields[2], "dirs") {
+			written = append(written, fields[2])
+		}
+	}
+	if len(written) != 1 || written[0] != "c:/candidate dirs" {
+		t.Errorf("Expected the directory of the existing candidate written, got %q", written)
+	}
+}
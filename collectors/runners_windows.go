@@ -1,8 +1,11 @@
 package collectors
 
 import (
+	"encoding/xml"
 	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
 
 	"github.com/audibleblink/getsystem"
 	"github.com/audibleblink/memutils"
@@ -63,27 +66,9 @@ func Autoruns() {
 					log.Debugf("unable to read value: %s", err)
 					continue
 				}
-				path, args := util.SmoothBrainPath(util.EvaluatePath(val))
-
 				context := &Principal{Name: "unknown"}
-
-				exe := &INode{
-					Path:   path,
-					Name:   filepath.Base(path),
-					Parent: filepath.Dir(path),
-				}
-
-				autorun := PERunner{
-					Name:    valueName,
-					Type:    "autorun",
-					Args:    args,
-					Exe:     exe,
-					Context: context,
-				}
-
-				autorun.Exe.Write(writers[ExeFile])
-				autorun.Context.Write(writers[PrincipalFile])
-				autorun.Write(writers[RunnersFile])
+				autorun := newAutorunRunner(valueName, util.EvaluatePath(val), context)
+				writeRunner(autorun)
 			}
 		}
 	}
@@ -94,54 +79,98 @@ func Tasks() {
 
 	svc, err := taskmaster.Connect()
 	if err != nil {
-		log.Fatalf("could not connect to tasks scheduler: %s", err)
+		log.Warnf("could not connect to tasks scheduler, reading task xml: %s", err)
+		TasksFromXML(liveTasksDir())
+		return
 	}
+	defer svc.Disconnect()
+
 	tasks, err := svc.GetRegisteredTasks()
 	if err != nil {
-		log.Fatalf("could not fetch registered tasks: %s", err)
+		log.Warnf("could not fetch registered tasks, reading task xml: %s", err)
+		TasksFromXML(liveTasksDir())
+		return
 	}
 
 	for _, task := range tasks {
-		if task.Enabled {
+		if !task.Enabled {
+			continue
+		}
 
-			var execAction taskmaster.ExecAction
-			actionType := task.Definition.Actions[0].GetType()
+		principal := taskmasterPrincipal(task.Definition.Principal)
+		actions := taskmasterActions(task.Definition.Actions)
+		for _, runner := range taskRunners(task.Path, principal, actions) {
+			writeRunner(runner)
+		}
+	}
+}
 
-			switch actionType {
-			case taskmaster.TASK_ACTION_EXEC:
-				execAction = task.Definition.Actions[0].(taskmaster.ExecAction)
-			default:
-				log.Debugf("task %s has no action, continuing", task.Name)
-				continue
-			}
+// taskmasterPrincipal converts a task principal from the Task Scheduler API
+// to its form in task XML
+func taskmasterPrincipal(p taskmaster.Principal) taskPrincipal {
+	principal := taskPrincipal{
+		ID:       p.ID,
+		UserID:   p.UserID,
+		GroupID:  p.GroupID,
+		RunLevel: "LeastPrivilege",
+	}
+	if p.RunLevel == taskmaster.TASK_RUNLEVEL_HIGHEST {
+		principal.RunLevel = "HighestAvailable"
+	}
+	if p.LogonType == taskmaster.TASK_LOGON_GROUP {
+		principal.LogonType = "Group"
+	}
+	return principal
+}
 
-			if execAction.Path == "" {
-				continue
-			}
+// taskmasterActions converts the actions of a task from the Task Scheduler
+// API to their form in task XML
+func taskmasterActions(actions []taskmaster.Action) []taskAction {
+	converted := make([]taskAction, 0, len(actions))
+	for _, action := range actions {
+		switch a := action.(type) {
+		case taskmaster.ExecAction:
+			converted = append(converted, taskAction{
+				XMLName:   xml.Name{Local: "Exec"},
+				Command:   a.Path,
+				Arguments: a.Args,
+			})
+		case taskmaster.ComHandlerAction:
+			converted = append(converted, taskAction{
+				XMLName: xml.Name{Local: "ComHandler"},
+				ClassID: a.ClassID,
+				Data:    a.Data,
+			})
+		}
+	}
+	return converted
+}
 
-			fullPath := util.EvaluatePath(execAction.Path)
-			args := execAction.Args
+// comServer returns the binary registered for the COM class clsid
+func comServer(clsid string) string {
+	if Offline() {
+		return offlineCOMServer(clsid)
+	}
 
-			exe := &INode{
-				Path:   fullPath,
-				Name:   filepath.Base(fullPath),
-				Parent: filepath.Dir(fullPath),
-			}
+	return comServerPath(func(subKey string) (string, error) {
+		key, err := registry.OpenKey(
+			registry.CLASSES_ROOT,
+			`CLSID\`+clsid+`\`+subKey,
+			registry.QUERY_VALUE,
+		)
+		if err != nil {
+			return "", err
+		}
+		defer key.Close()
 
-			taschzk := PERunner{
-				Name:     task.Name,
-				Type:     "task",
-				Args:     args,
-				Exe:      exe,
-				Context:  &Principal{Name: task.Definition.Context},
-				RunLevel: task.Definition.Principal.RunLevel.String(),
-			}
+		val, _, err := key.GetStringValue("")
+		return val, err
+	})
+}
 
-			taschzk.Exe.Write(writers[ExeFile])
-			taschzk.Context.Write(writers[PrincipalFile])
-			taschzk.Write(writers[RunnersFile])
-		}
-	}
+// liveTasksDir is where the running host keeps its task definitions
+func liveTasksDir() string {
+	return filepath.Join(os.Getenv("SystemRoot"), "System32", "Tasks")
 }
 
 func Services() {
@@ -187,27 +216,88 @@ func Services() {
 			continue
 		}
 
-		path, args := util.SmoothBrainPath(conf.BinaryPathName)
-		context := &Principal{Name: conf.ServiceStartName}
+		service := newServiceRunner(
+			conf.DisplayName,
+			conf.BinaryPathName,
+			conf.ServiceStartName,
+			conf.StartType,
+			serviceDll(svcName),
+		)
+		writeRunner(service)
+	}
+}
 
-		exe := &INode{
-			Path:   path,
-			Name:   filepath.Base(path),
-			Parent: filepath.Dir(path),
-		}
+// sessionManagerDLLs returns the KnownDLLs of native and WOW64 processes and
+// the system PATH of the collected host
+func sessionManagerDLLs() (known, known32 []string, pathVar string) {
+	if Offline() {
+		return offlineSessionManagerDLLs()
+	}
 
-		service := PERunner{
-			Name:    conf.DisplayName,
-			Type:    "service",
-			Args:    args,
-			Exe:     exe,
-			Context: context,
+	base := `SYSTEM\CurrentControlSet\` + sessionManager
+	known = knownDLLs(base + `\KnownDLLs`)
+	known32 = knownDLLs(base + `\KnownDLLs32`)
+
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, base+`\Environment`, registry.QUERY_VALUE)
+	if err == nil {
+		pathVar, _, _ = key.GetStringValue("Path")
+		key.Close()
+	}
+	return
+}
+
+// knownDLLs returns the DLLs listed by the KnownDLLs key at path
+func knownDLLs(path string) (known []string) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+	if err != nil {
+		return nil
+	}
+	defer key.Close()
+
+	names, _ := key.ReadValueNames(-1)
+	for _, name := range names {
+		dll, _, err := key.GetStringValue(name)
+		if err == nil {
+			known = append(known, dll)
 		}
+	}
+	return slices.DeleteFunc(known, isKnownDLLDirectory)
+}
+
+// devOverrideEnabled reports whether DotLocal redirection applies to Exes
+// with a manifest on the collected host
+func devOverrideEnabled() bool {
+	if Offline() {
+		return offlineDevOverrideEnabled()
+	}
 
-		service.Exe.Write(writers[ExeFile])
-		service.Context.Write(writers[PrincipalFile])
-		service.Write(writers[RunnersFile])
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\`+imageFileExecutionOptions, registry.QUERY_VALUE)
+	if err != nil {
+		return false
 	}
+	defer key.Close()
+	enabled, _, err := key.GetIntegerValue("DevOverrideEnable")
+	return err == nil && enabled != 0
+}
+
+// serviceDll returns the DLL svchost loads for a shared service
+func serviceDll(svcName string) string {
+	for _, subKey := range []string{`\Parameters`, ""} {
+		key, err := registry.OpenKey(
+			registry.LOCAL_MACHINE,
+			`SYSTEM\CurrentControlSet\Services\`+svcName+subKey,
+			registry.QUERY_VALUE,
+		)
+		if err != nil {
+			continue
+		}
+		dll, _, err := key.GetStringValue("ServiceDll")
+		key.Close()
+		if err == nil {
+			return dll
+		}
+	}
+	return ""
 }
 
 func Processes() {
@@ -222,12 +312,7 @@ func Processes() {
 
 	for _, process := range processes {
 
-		path, args := util.SmoothBrainPath(util.EvaluatePath(process.Exe))
-		exe := &INode{
-			Path:   path,
-			Name:   filepath.Base(path),
-			Parent: filepath.Dir(path),
-		}
+		cmd := parseRunnerCommandLine(process.Exe)
 
 		token, err := tokenForPid(process.Pid)
 		if err != nil {
@@ -246,14 +331,14 @@ func Processes() {
 		proc := PERunner{
 			Name:    process.Exe,
 			Type:    "process",
-			Args:    args,
-			Exe:     exe,
+			Args:    cmd.RawArgs,
+			Exe:     runnerExe(cmd.Binary),
 			Context: context,
+
+			Candidates: precedingCandidates(cmd),
 		}
 
-		proc.Exe.Write(writers[ExeFile])
-		proc.Context.Write(writers[PrincipalFile])
-		proc.Write(writers[RunnersFile])
+		writeRunner(proc)
 	}
 }
 
@@ -0,0 +1,332 @@
+package collectors
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/audibleblink/logerr"
+	"github.com/audibleblink/lpegopher/hive"
+	"github.com/audibleblink/lpegopher/node"
+	"github.com/audibleblink/lpegopher/util"
+)
+
+// sessionManager holds the KnownDLLs and system environment of a control set
+const sessionManager = `Control\Session Manager`
+
+// dllSearchOrder is how the collected host finds the DLLs an Exe imports
+type dllSearchOrder struct {
+	knownDLLs   map[string]bool // loaded from System32 whatever the search order
+	knownDLLs32 map[string]bool // loaded from SysWOW64 by WOW64 processes
+	system32    string
+	syswow64    string            // where WOW64 processes find System32, if the host has it
+	dirs        []string          // searched after the application directory, in order
+	apiSets     map[string]string // API set contracts to the DLLs hosting them
+
+	assemblies  []sxsAssembly // side-by-side assemblies installed in WinSxS
+	devOverride bool          // DotLocal redirection applies to Exes with a manifest
+	gacs        []string      // global assembly caches of managed assemblies
+}
+
+var (
+	// searchOrder is the DLL search order of the collected host, populated
+	// by LoadSearchOrder. Imports aren't resolved without it.
+	searchOrder *dllSearchOrder
+
+	// dirListings caches the lowercased file names of each directory
+	// consulted while resolving imports
+	dirListings = &sync.Map{}
+)
+
+// LoadSearchOrder reads the KnownDLLs and system PATH of the collected host
+// to build its DLL search order. It must run before PE collection for
+// imports to be resolved.
+func LoadSearchOrder() {
+	log := logerr.Add("search order")
+
+	var err error
+	root := systemRoot()
+	order := &dllSearchOrder{
+		knownDLLs:   map[string]bool{},
+		knownDLLs32: map[string]bool{},
+		system32:    root + `\System32`,
+		syswow64:    root + `\SysWOW64`,
+	}
+
+	// with SafeDllSearchMode on, the current directory follows the
+	// Windows directory, but it isn't known for a runner so it's left out
+	order.dirs = []string{order.system32, root + `\System`, root}
+
+	known, known32, pathVar := sessionManagerDLLs()
+	for _, dll := range known {
+		order.knownDLLs[util.Lower(dll)] = true
+	}
+	for _, dll := range known32 {
+		order.knownDLLs32[util.Lower(dll)] = true
+	}
+
+	for _, dir := range strings.Split(pathVar, ";") {
+		dir = expandRunnerPath(strings.Trim(dir, `" `))
+		if len(dir) > 3 {
+			dir = strings.TrimRight(dir, `\/`)
+		}
+		if dir == "" || slices.ContainsFunc(order.dirs, func(d string) bool {
+			return util.PathFix(d) == util.PathFix(dir)
+		}) {
+			continue
+		}
+		order.dirs = append(order.dirs, dir)
+	}
+
+	// a host without SysWOW64 runs 32-bit PEs natively
+	if len(readHostDir(order.syswow64)) == 0 {
+		order.syswow64 = ""
+	}
+
+	order.apiSets, err = loadAPISetSchema(order.system32 + `\apisetschema.dll`)
+	if err != nil {
+		log.Warnf("api set contracts won't be resolved: %s", err)
+	}
+
+	order.assemblies = loadAssemblies(root + `\WinSxS`)
+	order.devOverride = devOverrideEnabled()
+	for _, gac := range []string{`Microsoft.NET\assembly`, `assembly`} {
+		for _, arch := range []string{"GAC_MSIL", "GAC_64", "GAC_32"} {
+			order.gacs = append(order.gacs, root+`\`+gac+`\`+arch)
+		}
+	}
+
+	log.Debugf("%d known dlls, %d api sets, %d assemblies, search order %v",
+		len(order.knownDLLs), len(order.apiSets), len(order.assemblies), order.dirs)
+	searchOrder = order
+}
+
+// systemRoot returns the Windows directory of the collected host
+func systemRoot() string {
+	if Offline() {
+		return strings.ToUpper(volume.Drive) + `\Windows`
+	}
+	return os.Getenv("SystemRoot")
+}
+
+// offlineSessionManagerDLLs returns the KnownDLLs of native and WOW64
+// processes and the system PATH recorded in the SYSTEM hive of the offline
+// volume
+func offlineSessionManagerDLLs() (known, known32 []string, pathVar string) {
+	log := logerr.Add("offline session manager")
+
+	system, err := openOfflineHive(systemHive)
+	if err != nil {
+		log.Debugf("search order settings unavailable: %s", err)
+		return
+	}
+	defer system.Close()
+
+	manager, err := system.OpenKey(currentControlSet(system) + `\` + sessionManager)
+	if err != nil {
+		log.Debugf("search order settings unavailable: %s", err)
+		return
+	}
+
+	known = offlineKnownDLLs(manager, "KnownDLLs")
+	known32 = offlineKnownDLLs(manager, "KnownDLLs32")
+
+	env, err := manager.OpenKey("Environment")
+	if err == nil {
+		pathVar, _, _ = env.GetStringValue("Path")
+	}
+	return
+}
+
+// offlineKnownDLLs returns the DLLs listed by the KnownDLLs key called keyName
+// under the session manager
+func offlineKnownDLLs(manager *hive.Key, keyName string) (known []string) {
+	key, err := manager.OpenKey(keyName)
+	if err != nil {
+		return nil
+	}
+	names, _ := key.ReadValueNames()
+	for _, name := range names {
+		dll, _, err := key.GetStringValue(name)
+		if err == nil {
+			known = append(known, dll)
+		}
+	}
+	return slices.DeleteFunc(known, isKnownDLLDirectory)
+}
+
+// isKnownDLLDirectory reports whether a KnownDLLs value is one of the
+// directories the key also records, rather than a DLL
+func isKnownDLLDirectory(value string) bool {
+	return !strings.HasSuffix(util.Lower(value), ".dll")
+}
+
+// resolve follows the search order for dll as imported by the Exe of ctx.
+// It returns the path the DLL loads from, if any, and the directories
+// searched before it where a planted copy would load instead.
+func (o *dllSearchOrder) resolve(ctx loadContext, dll string) (resolved string, plantable []string) {
+	// WOW64 processes have their own KnownDLLs, and the file system
+	// redirector sends them to SysWOW64 wherever System32 is searched
+	system32, knownDLLs, dirs := o.system32, o.knownDLLs, o.dirs
+	if ctx.wow64 {
+		system32, knownDLLs = o.syswow64, o.knownDLLs32
+		dirs = make([]string, len(o.dirs))
+		for n, dir := range o.dirs {
+			dirs[n] = dir
+			if util.PathFix(dir) == util.PathFix(o.system32) {
+				dirs[n] = o.syswow64
+			}
+		}
+	}
+
+	// API sets are redirected by the loader before any directory is
+	// searched, so a file by the contract's name is never loaded
+	if isAPISet(dll) {
+		if host := o.apiSetHost(dll); host != "" && dirHas(system32, host) {
+			resolved = system32 + `\` + host
+		}
+		return
+	}
+
+	// DotLocal redirection comes first, but can't redirect KnownDLLs
+	if ctx.dotLocal != "" && !knownDLLs[dll] {
+		if dirHas(ctx.dotLocal, dll) {
+			return ctx.dotLocal + `\` + dll, nil
+		}
+		plantable = append(plantable, ctx.dotLocal)
+	}
+
+	// then the side-by-side assemblies the Exe's manifest depends on
+	for _, dir := range ctx.assemblies {
+		if dirHas(dir, dll) {
+			return dir + `\` + dll, plantable
+		}
+	}
+
+	if knownDLLs[dll] {
+		if dirHas(system32, dll) {
+			resolved = system32 + `\` + dll
+		}
+		return
+	}
+
+	searched := map[string]bool{}
+	for _, dir := range append([]string{ctx.appDir}, dirs...) {
+		key := util.PathFix(dir)
+		if searched[key] {
+			continue
+		}
+		searched[key] = true
+
+		if dirHas(dir, dll) {
+			return dir + `\` + dll, plantable
+		}
+		plantable = append(plantable, dir)
+	}
+	return "", plantable
+}
+
+// isWOW64 reports whether the PE of report runs under WOW64 on the
+// collected host, as 32-bit x86 code does on a 64-bit host
+func (o *dllSearchOrder) isWOW64(report *INode) bool {
+	return o.syswow64 != "" && report.Header != nil && report.Header.Machine == "x86"
+}
+
+// apiSetHost returns the DLL hosting the API set contract dll, if known
+func (o *dllSearchOrder) apiSetHost(dll string) string {
+	if !isAPISet(dll) {
+		return ""
+	}
+	return o.apiSets[apiSetKey(dll)]
+}
+
+// apiSetHost returns the DLL hosting the API set contract dll on the
+// collected host, if known
+func apiSetHost(dll string) string {
+	if searchOrder == nil {
+		return ""
+	}
+	return searchOrder.apiSetHost(dll)
+}
+
+// dirHas reports whether the directory at the Windows path dir on the
+// collected host holds a file called name, which must be lowercase
+func dirHas(dir, name string) bool {
+	key := util.PathFix(dir)
+	listing, ok := dirListings.Load(key)
+	if !ok {
+		listing, _ = dirListings.LoadOrStore(key, listDir(dir))
+	}
+	return listing.(map[string]bool)[name]
+}
+
+// listDir returns the lowercased names of the files in the directory at
+// the Windows path dir on the collected host
+func listDir(dir string) map[string]bool {
+	names := map[string]bool{}
+	for _, entry := range readHostDir(dir) {
+		if !entry.IsDir() {
+			names[util.Lower(entry.Name())] = true
+		}
+	}
+	return names
+}
+
+// readHostDir returns the entries of the directory at the Windows path dir
+// on the collected host, or none if it can't be read
+func readHostDir(dir string) []os.DirEntry {
+	local, err := localPath(dir)
+	if err != nil {
+		return nil
+	}
+
+	entries, _ := os.ReadDir(local)
+	return entries
+}
+
+// writeResolutions relates the Exe exeID to where each of the DLLs it
+// imports loads from, and to the directories a copy could be planted in
+func writeResolutions(exeID string, exe *INode, dlls []string) {
+	if searchOrder == nil {
+		return
+	}
+
+	ctx := searchOrder.loadContext(exe)
+	for _, dll := range dlls {
+		resolved, plantable := searchOrder.resolve(ctx, dll)
+		if resolved != "" {
+			res := Resolution{Exe: exeID, Rel: ResolvesTo, End: hashFor(resolved), Dll: dll}
+			res.Write(writers[ResolutionFile])
+		}
+		for _, dir := range plantable {
+			writeSearchDirectory(dir)
+			res := Resolution{Exe: exeID, Rel: PlantableIn, End: hashFor(dir), Dll: dll}
+			res.Write(writers[ResolutionFile])
+		}
+	}
+}
+
+// writeSearchDirectory writes the report of dir, a directory DLLs are
+// searched for in, so planting there relates to a Directory node even when
+// dir holds no PE. A directory missing from the collected host, like the
+// .local of most Exes, is written without an ACL.
+func writeSearchDirectory(dir string) {
+	local, err := localPath(dir)
+	if err == nil {
+		if info, err := os.Stat(local); err == nil && info.IsDir() {
+			writeDirectory(local)
+			return
+		}
+	}
+
+	_, alreadyDidIt := cache.LoadOrStore(util.PathFix(dir), true)
+	if !alreadyDidIt {
+		doPrint(&INode{
+			Path:   dir,
+			Name:   util.WinBase(dir),
+			Parent: util.WinDir(dir),
+			Type:   node.Dir,
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package collectors
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/audibleblink/lpegopher/hive"
+	"github.com/audibleblink/lpegopher/hive/hivetest"
+)
+
+func TestDLLSearchOrder(t *testing.T) {
+	mount := useTestVolume(t)
+
+	b := hivetest.New()
+	known := b.Key("KnownDLLs", nil, []uint32{
+		b.Value("kernel32", hive.SZ, hivetest.SZ("kernel32.dll")),
+		b.Value("DllDirectory", hive.EXPAND_SZ, hivetest.SZ(`%SystemRoot%\system32`)),
+	})
+	env := b.Key("Environment", nil, []uint32{
+		b.Value("Path", hive.EXPAND_SZ, hivetest.SZ(`%SystemRoot%\system32;%SystemRoot%;C:\Tools\;`)),
+	})
+	manager := b.Key("Session Manager", []uint32{known, env}, nil)
+	control := b.Key("Control", []uint32{manager}, nil)
+	controlSet := b.Key("ControlSet001", []uint32{control}, nil)
+	err := b.WriteFile(filepath.Join(mount, "Windows", "System32", "config", "SYSTEM"), b.Key("ROOT", []uint32{controlSet}, nil))
+	if err != nil {
+		t.Fatalf("Failed to write test hive: %v", err)
+	}
+
+	for _, file := range []string{
+		"Windows/System32/kernel32.dll",
+		"Windows/System32/Version.dll",
+		"Windows/System32/KernelBase.dll",
+		"Tools/helper.dll",
+		"Program Files/App/app.exe",
+		"Program Files/App/local.dll",
+	} {
+		path := filepath.Join(mount, filepath.FromSlash(file))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", file, err)
+		}
+	}
+
+	schema := testAPISetSchema([][]string{{"api-ms-win-core-file-l1-2-4", "kernelbase.dll"}})
+	err = os.WriteFile(filepath.Join(mount, "Windows", "System32", "apisetschema.dll"), testPE(apiSetSection, schema), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write api set schema: %v", err)
+	}
+
+	LoadSearchOrder()
+	expectedDirs := []string{`C:\Windows\System32`, `C:\Windows\System`, `C:\Windows`, `C:\Tools`}
+	if !slices.Equal(searchOrder.dirs, expectedDirs) {
+		t.Fatalf("Expected search order %v, got %v", expectedDirs, searchOrder.dirs)
+	}
+
+	appDir := "c:/program files/app"
+	tests := []struct {
+		dll       string
+		resolved  string
+		plantable []string
+	}{
+		{"local.dll", `c:/program files/app\local.dll`, nil},
+		{"kernel32.dll", `C:\Windows\System32\kernel32.dll`, nil},
+		{"version.dll", `C:\Windows\System32\version.dll`, []string{appDir}},
+		{"helper.dll", `C:\Tools\helper.dll`, []string{appDir, `C:\Windows\System32`, `C:\Windows\System`, `C:\Windows`}},
+		{"api-ms-win-core-file-l1-2-0.dll", `C:\Windows\System32\kernelbase.dll`, nil},
+		{"api-ms-win-core-unknown-l1-1-0.dll", "", nil},
+		{"missing.dll", "", []string{appDir, `C:\Windows\System32`, `C:\Windows\System`, `C:\Windows`, `C:\Tools`}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dll, func(t *testing.T) {
+			resolved, plantable := searchOrder.resolve(loadContext{appDir: appDir}, test.dll)
+			if resolved != test.resolved {
+				t.Errorf("Resolved to %q, expected %q", resolved, test.resolved)
+			}
+			if !slices.Equal(plantable, test.plantable) {
+				t.Errorf("Plantable in %v, expected %v", plantable, test.plantable)
+			}
+		})
+	}
+}
+
+func TestWOW64SearchOrder(t *testing.T) {
+	mount := useTestVolume(t)
+
+	b := hivetest.New()
+	known := b.Key("KnownDLLs", nil, []uint32{
+		b.Value("kernel32", hive.SZ, hivetest.SZ("kernel32.dll")),
+		b.Value("ole32", hive.SZ, hivetest.SZ("ole32.dll")),
+	})
+	known32 := b.Key("KnownDLLs32", nil, []uint32{
+		b.Value("kernel32", hive.SZ, hivetest.SZ("kernel32.dll")),
+		b.Value("DllDirectory32", hive.EXPAND_SZ, hivetest.SZ(`%SystemRoot%\SysWOW64`)),
+	})
+	manager := b.Key("Session Manager", []uint32{known, known32}, nil)
+	control := b.Key("Control", []uint32{manager}, nil)
+	controlSet := b.Key("ControlSet001", []uint32{control}, nil)
+	err := b.WriteFile(filepath.Join(mount, "Windows", "System32", "config", "SYSTEM"), b.Key("ROOT", []uint32{controlSet}, nil))
+	if err != nil {
+		t.Fatalf("Failed to write test hive: %v", err)
+	}
+
+	for _, file := range []string{
+		"Windows/System32/kernel32.dll",
+		"Windows/System32/ole32.dll",
+		"Windows/System32/native.dll",
+		"Windows/SysWOW64/kernel32.dll",
+		"Windows/SysWOW64/ole32.dll",
+	} {
+		path := filepath.Join(mount, filepath.FromSlash(file))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", file, err)
+		}
+	}
+	LoadSearchOrder()
+
+	appDir := "c:/wow64/app"
+	tests := []struct {
+		machine   string
+		dll       string
+		resolved  string
+		plantable []string
+	}{
+		{"x64", "kernel32.dll", `C:\Windows\System32\kernel32.dll`, nil},
+		{"x86", "kernel32.dll", `C:\Windows\SysWOW64\kernel32.dll`, nil},
+		{"x64", "ole32.dll", `C:\Windows\System32\ole32.dll`, nil},
+		{"x86", "ole32.dll", `C:\Windows\SysWOW64\ole32.dll`, []string{appDir}},
+		{"x64", "native.dll", `C:\Windows\System32\native.dll`, []string{appDir}},
+		{"x86", "native.dll", "", []string{appDir, `C:\Windows\SysWOW64`, `C:\Windows\System`, `C:\Windows`}},
+	}
+	for _, test := range tests {
+		t.Run(test.machine+" "+test.dll, func(t *testing.T) {
+			exe := &INode{Parent: appDir, Header: &PEHeader{Machine: test.machine}}
+			resolved, plantable := searchOrder.resolve(searchOrder.loadContext(exe), test.dll)
+			if resolved != test.resolved {
+				t.Errorf("Resolved to %q, expected %q", resolved, test.resolved)
+			}
+			if !slices.Equal(plantable, test.plantable) {
+				t.Errorf("Plantable in %v, expected %v", plantable, test.plantable)
+			}
+		})
+	}
+}
+
+func TestWriteResolutionDirectories(t *testing.T) {
+	mount := useTestVolume(t)
+
+	b := hivetest.New()
+	env := b.Key("Environment", nil, []uint32{
+		b.Value("Path", hive.EXPAND_SZ, hivetest.SZ(`C:\PlantTools;C:\PlantMissing`)),
+	})
+	manager := b.Key("Session Manager", []uint32{env}, nil)
+	control := b.Key("Control", []uint32{manager}, nil)
+	controlSet := b.Key("ControlSet001", []uint32{control}, nil)
+	err := b.WriteFile(filepath.Join(mount, "Windows", "System32", "config", "SYSTEM"), b.Key("ROOT", []uint32{controlSet}, nil))
+	if err != nil {
+		t.Fatalf("Failed to write test hive: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(mount, "PlantTools"), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	LoadSearchOrder()
+
+	exe := &INode{Path: "c:/plantapp/app.exe", Parent: "c:/plantapp"}
+	writeResolutions(exe.ID(), exe, []string{"plantme.dll"})
+
+	var written []string
+	for _, row := range collectedRows(t, DirFile) {
+		fields := strings.Split(row, ",")
+		if len(fields) > 2 && strings.HasPrefix(fields[2], "c:/plant") {
+			written = append(written, fields[2])
+		}
+	}
+	slices.Sort(written)
+	expected := []string{"c:/plantapp", "c:/plantmissing", "c:/planttools"}
+	if !slices.Equal(written, expected) {
+		t.Errorf("Expected directories %v written, got %v", expected, written)
+	}
+}
+
+func TestWriteForwards(t *testing.T) {
+	mount := useTestVolume(t)
+
+	for _, file := range []string{
+		"Windows/System32/fwdtarget.dll",
+		"Program Files/Fwd/fwd.dll",
+	} {
+		path := filepath.Join(mount, filepath.FromSlash(file))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", file, err)
+		}
+	}
+	LoadSearchOrder()
+
+	report := &INode{
+		Name:   "fwd.dll",
+		Path:   "c:/program files/fwd/fwd.dll",
+		Parent: "c:/program files/fwd",
+		Exports: []Export{
+			{Name: "Alpha", Ordinal: 1},
+			{Name: "Beta", Ordinal: 2, Forwarder: "FwdTarget.Beta"},
+			{Ordinal: 3, Forwarder: "fwdmissing.#12"},
+		},
+	}
+	dllID := report.ID()
+	writeForwards(dllID, report)
+
+	rows := collectedRows(t, ForwardFile)
+	target := Dep{Name: "fwdtarget.dll"}
+	missing := Dep{Name: "fwdmissing.dll"}
+	expected := []string{
+		fmt.Sprintf("%s,FORWARDS_TO,%s,%s,\"Beta\",\"Beta\"", dllID, target.ID(), hashFor(`C:\Windows\System32\fwdtarget.dll`)),
+		fmt.Sprintf("%s,FORWARDS_TO,%s,,\"#3\",\"#12\"", dllID, missing.ID()),
+	}
+	if !slices.Equal(rows, expected) {
+		t.Errorf("Expected forwards %q, got %q", expected, rows)
+	}
+}
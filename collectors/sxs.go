@@ -0,0 +1,221 @@
+package collectors
+
+import (
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/audibleblink/logerr"
+	"github.com/audibleblink/lpegopher/util"
+)
+
+const (
+	DotLocalFile = "file"      // an app.exe.local file, which only affects LoadLibrary by path
+	DotLocalDir  = "directory" // an app.exe.local directory, searched before anything else
+)
+
+// imageFileExecutionOptions holds the DevOverrideEnable switch that lets
+// DotLocal redirection apply to Exes with a manifest
+const imageFileExecutionOptions = `Microsoft\Windows NT\CurrentVersion\Image File Execution Options`
+
+// sxsArches are the assembly architectures images of each machine load
+var sxsArches = map[string][]string{
+	"x64":   {"amd64", "msil"},
+	"x86":   {"x86", "wow64", "msil"},
+	"ARM64": {"arm64", "msil"},
+}
+
+// sxsAssembly is an assembly installed in WinSxS, known by the name of its
+// directory: arch_name_publickeytoken_version_language_hash
+type sxsAssembly struct {
+	dir      string
+	arch     string
+	name     string
+	token    string
+	version  string
+	language string
+}
+
+// parseAssemblyDir reads the identity of the assembly in the WinSxS
+// directory called name
+func parseAssemblyDir(name string) (sxsAssembly, bool) {
+	parts := strings.Split(util.Lower(name), "_")
+	if len(parts) < 6 {
+		return sxsAssembly{}, false
+	}
+
+	// names may have underscores of their own, so count from both ends
+	n := len(parts)
+	return sxsAssembly{
+		dir:      name,
+		arch:     parts[0],
+		name:     strings.Join(parts[1:n-4], "_"),
+		token:    parts[n-4],
+		version:  parts[n-3],
+		language: parts[n-2],
+	}, true
+}
+
+// loadAssemblies lists the assemblies installed in the WinSxS directory at
+// the Windows path root on the collected host
+func loadAssemblies(root string) []sxsAssembly {
+	var assemblies []sxsAssembly
+	for _, entry := range readHostDir(root) {
+		if !entry.IsDir() {
+			continue
+		}
+		assembly, ok := parseAssemblyDir(entry.Name())
+		if ok {
+			assembly.dir = root + `\` + entry.Name()
+			assemblies = append(assemblies, assembly)
+		}
+	}
+	return assemblies
+}
+
+// matches reports whether the installed assembly a satisfies the dependency
+// id of an image for machine. Publisher policies, which redirect a
+// dependency to newer builds, aren't read, so any version with the same
+// major and minor version matches.
+func (a sxsAssembly) matches(id AssemblyIdentity, machine string) bool {
+	if a.name != util.Lower(id.Name) {
+		return false
+	}
+
+	token := util.Lower(id.PublicKeyToken)
+	if token == "" {
+		token = "none"
+	}
+	if a.token != token {
+		return false
+	}
+
+	switch arch := util.Lower(id.Arch); arch {
+	case "*", "":
+		if arches, ok := sxsArches[machine]; ok && !slices.Contains(arches, a.arch) {
+			return false
+		}
+	default:
+		if a.arch != arch {
+			return false
+		}
+	}
+
+	switch language := util.Lower(id.Language); language {
+	case "*":
+	case "", "neutral":
+		if a.language != "none" {
+			return false
+		}
+	default:
+		if a.language != language {
+			return false
+		}
+	}
+
+	want, have := versionParts(id.Version), versionParts(a.version)
+	return len(want) >= 2 && len(have) >= 2 && want[0] == have[0] && want[1] == have[1]
+}
+
+// versionParts splits a dotted version into its numbers
+func versionParts(version string) []int {
+	var parts []int
+	for _, part := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// assemblyDir returns the WinSxS directory of the newest installed assembly
+// satisfying the dependency id of an image for machine, if any
+func (o *dllSearchOrder) assemblyDir(id AssemblyIdentity, machine string) string {
+	var best *sxsAssembly
+	for i, assembly := range o.assemblies {
+		if !assembly.matches(id, machine) {
+			continue
+		}
+		if best == nil || slices.Compare(versionParts(assembly.version), versionParts(best.version)) > 0 {
+			best = &o.assemblies[i]
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.dir
+}
+
+// loadContext is what, beyond the search order, decides where the imports
+// of an Exe load from
+type loadContext struct {
+	appDir     string
+	dotLocal   string   // DotLocal redirection directory, when the loader honors it
+	assemblies []string // directories of the side-by-side assemblies it depends on
+	wow64      bool     // a 32-bit Exe on a 64-bit host, which finds SysWOW64 as System32
+}
+
+// loadContext returns the load context of exe. Without DevOverrideEnable,
+// the loader ignores DotLocal redirection for Exes with a manifest. An
+// assembly missing from WinSxS is probed for as a private assembly, in a
+// directory of its name beside the Exe.
+func (o *dllSearchOrder) loadContext(exe *INode) loadContext {
+	ctx := loadContext{appDir: exe.Parent, wow64: o.isWOW64(exe)}
+	if exe.DotLocal == DotLocalDir && (exe.Manifest == nil || o.devOverride) {
+		ctx.dotLocal = exe.Path + ".local"
+	}
+
+	if exe.Manifest == nil {
+		return ctx
+	}
+	machine := ""
+	if exe.Header != nil {
+		machine = exe.Header.Machine
+	}
+	for _, id := range exe.Manifest.Dependencies {
+		dir := o.assemblyDir(id, machine)
+		if dir == "" {
+			dir = exe.Parent + `\` + util.Lower(id.Name)
+		}
+		ctx.assemblies = append(ctx.assemblies, dir)
+	}
+	return ctx
+}
+
+// dotLocal returns whether the Exe at path on the collecting host has a
+// DotLocal file or directory beside it
+func dotLocal(path string) string {
+	info, err := os.Stat(path + ".local")
+	switch {
+	case err != nil:
+		return ""
+	case info.IsDir():
+		return DotLocalDir
+	default:
+		return DotLocalFile
+	}
+}
+
+// offlineDevOverrideEnabled reports whether the SOFTWARE hive of the offline
+// volume sets DevOverrideEnable
+func offlineDevOverrideEnabled() bool {
+	log := logerr.Add("offline dev override")
+
+	software, err := openOfflineHive(softwareHive)
+	if err != nil {
+		log.Debugf("image file execution options unavailable: %s", err)
+		return false
+	}
+	defer software.Close()
+
+	key, err := software.OpenKey(imageFileExecutionOptions)
+	if err != nil {
+		log.Debugf("image file execution options unavailable: %s", err)
+		return false
+	}
+	enabled, _, err := key.GetIntegerValue("DevOverrideEnable")
+	return err == nil && enabled != 0
+}
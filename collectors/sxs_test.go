@@ -0,0 +1,193 @@
+package collectors
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/audibleblink/lpegopher/hive"
+	"github.com/audibleblink/lpegopher/hive/hivetest"
+)
+
+func TestParseAssemblyDir(t *testing.T) {
+	tests := []struct {
+		dir      string
+		expected sxsAssembly
+		ok       bool
+	}{
+		{
+			dir: "amd64_microsoft.windows.common-controls_6595b64144ccf1df_6.0.19041.1110_none_60b5254171f9507e",
+			expected: sxsAssembly{
+				arch:     "amd64",
+				name:     "microsoft.windows.common-controls",
+				token:    "6595b64144ccf1df",
+				version:  "6.0.19041.1110",
+				language: "none",
+			},
+			ok: true,
+		},
+		{
+			dir: "x86_Vendor_Tools_none_1.2.0.0_en-us_0123456789abcdef",
+			expected: sxsAssembly{
+				arch:     "x86",
+				name:     "vendor_tools",
+				token:    "none",
+				version:  "1.2.0.0",
+				language: "en-us",
+			},
+			ok: true,
+		},
+		{dir: "Manifests"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dir, func(t *testing.T) {
+			assembly, ok := parseAssemblyDir(test.dir)
+			if ok != test.ok {
+				t.Fatalf("Expected ok %v, got %v", test.ok, ok)
+			}
+			if !ok {
+				return
+			}
+			test.expected.dir = test.dir
+			if assembly != test.expected {
+				t.Errorf("Expected %+v, got %+v", test.expected, assembly)
+			}
+		})
+	}
+}
+
+func TestSideBySideResolution(t *testing.T) {
+	mount := useTestVolume(t)
+
+	for _, file := range []string{
+		"Windows/System32/comctl32.dll",
+		"Windows/System32/kernel32.dll",
+		"Windows/System32/version.dll",
+		"Windows/WinSxS/amd64_microsoft.windows.common-controls_6595b64144ccf1df_6.0.17763.1_none_aaaa/comctl32.dll",
+		"Windows/WinSxS/amd64_microsoft.windows.common-controls_6595b64144ccf1df_6.0.19041.1110_none_bbbb/comctl32.dll",
+		"Windows/WinSxS/x86_microsoft.windows.common-controls_6595b64144ccf1df_6.0.19041.1110_none_cccc/comctl32.dll",
+		"Windows/WinSxS/amd64_microsoft.windows.common-controls_6595b64144ccf1df_5.82.19041.1110_none_dddd/comctl32.dll",
+		"Program Files/App/app.exe",
+		"Program Files/App/app.exe.local/version.dll",
+		"Program Files/App/vendor.plugins/plugin.dll",
+	} {
+		path := filepath.Join(mount, filepath.FromSlash(file))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", file, err)
+		}
+	}
+
+	LoadSearchOrder()
+	searchOrder.knownDLLs["kernel32.dll"] = true
+
+	appDir := "c:/program files/app"
+	sxs := `C:\Windows\WinSxS\amd64_microsoft.windows.common-controls_6595b64144ccf1df_6.0.19041.1110_none_bbbb`
+	local := appDir + "/app.exe.local"
+	manifest := &Manifest{Dependencies: []AssemblyIdentity{
+		{Name: "Microsoft.Windows.Common-Controls", Version: "6.0.0.0", Arch: "*", PublicKeyToken: "6595b64144ccf1df", Language: "*"},
+		{Name: "Vendor.Plugins", Version: "1.0.0.0"},
+	}}
+
+	exe := &INode{
+		Path:     appDir + "/app.exe",
+		Parent:   appDir,
+		Type:     "Exe",
+		Header:   &PEHeader{Machine: "x64"},
+		DotLocal: dotLocal(filepath.Join(mount, "Program Files", "App", "app.exe")),
+	}
+	if exe.DotLocal != DotLocalDir {
+		t.Fatalf("Expected a DotLocal directory, got %q", exe.DotLocal)
+	}
+
+	tests := []struct {
+		name        string
+		manifest    *Manifest
+		devOverride bool
+		dll         string
+		resolved    string
+		plantable   []string
+	}{
+		{
+			name:     "DotLocal redirects Exes without a manifest",
+			dll:      "version.dll",
+			resolved: local + `\version.dll`,
+		},
+		{
+			name:      "DotLocal is searched before the application directory",
+			dll:       "comctl32.dll",
+			resolved:  `C:\Windows\System32\comctl32.dll`,
+			plantable: []string{local, appDir},
+		},
+		{
+			name:     "DotLocal can't redirect KnownDLLs",
+			dll:      "kernel32.dll",
+			resolved: `C:\Windows\System32\kernel32.dll`,
+		},
+		{
+			name:     "Manifests load the newest matching assembly",
+			manifest: manifest,
+			dll:      "comctl32.dll",
+			resolved: sxs + `\comctl32.dll`,
+		},
+		{
+			name:      "Manifests turn DotLocal off",
+			manifest:  manifest,
+			dll:       "version.dll",
+			resolved:  `C:\Windows\System32\version.dll`,
+			plantable: []string{appDir},
+		},
+		{
+			name:        "DevOverrideEnable keeps DotLocal on",
+			manifest:    manifest,
+			devOverride: true,
+			dll:         "version.dll",
+			resolved:    local + `\version.dll`,
+		},
+		{
+			name:     "Private assemblies load from beside the Exe",
+			manifest: manifest,
+			dll:      "plugin.dll",
+			resolved: appDir + `\vendor.plugins\plugin.dll`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exe.Manifest = test.manifest
+			searchOrder.devOverride = test.devOverride
+
+			resolved, plantable := searchOrder.resolve(searchOrder.loadContext(exe), test.dll)
+			if resolved != test.resolved {
+				t.Errorf("Resolved to %q, expected %q", resolved, test.resolved)
+			}
+			if !slices.Equal(plantable, test.plantable) {
+				t.Errorf("Plantable in %v, expected %v", plantable, test.plantable)
+			}
+		})
+	}
+}
+
+func TestDevOverrideEnabled(t *testing.T) {
+	mount := useTestVolume(t)
+	if devOverrideEnabled() {
+		t.Error("Expected DevOverrideEnable to be off without a SOFTWARE hive")
+	}
+
+	b := hivetest.New()
+	ifeo := b.Key("Image File Execution Options", nil, []uint32{
+		b.Value("DevOverrideEnable", hive.DWORD, hivetest.DWORD(1)),
+	})
+	current := b.Key("CurrentVersion", []uint32{ifeo}, nil)
+	nt := b.Key("Windows NT", []uint32{current}, nil)
+	microsoft := b.Key("Microsoft", []uint32{nt}, nil)
+	err := b.WriteFile(filepath.Join(mount, "Windows", "System32", "config", "SOFTWARE"), b.Key("ROOT", []uint32{microsoft}, nil))
+	if err != nil {
+		t.Fatalf("Failed to write test hive: %v", err)
+	}
+	if !devOverrideEnabled() {
+		t.Error("Expected DevOverrideEnable to be on")
+	}
+}
@@ -0,0 +1,288 @@
+package collectors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/audibleblink/go-winacl"
+
+	"github.com/audibleblink/logerr"
+	"github.com/audibleblink/lpegopher/util"
+)
+
+// tasksDir is where Task Scheduler keeps task definitions on a Windows
+// system volume
+const tasksDir = `Windows\System32\Tasks`
+
+// taskHost is the executable that hosts a task's in-process COM handlers
+const taskHost = `%SystemRoot%\System32\taskhostw.exe`
+
+// taskRunLevels translates the run levels of task XML to the names the Task
+// Scheduler API uses
+var taskRunLevels = map[string]string{
+	"LeastPrivilege":   "Least",
+	"HighestAvailable": "Highest",
+}
+
+// taskDefinition is the part of a task's XML definition that describes who
+// runs it and what it runs
+type taskDefinition struct {
+	Settings struct {
+		Enabled *bool `xml:"Enabled"`
+	} `xml:"Settings"`
+	Principals []taskPrincipal `xml:"Principals>Principal"`
+	Actions    struct {
+		Context string       `xml:"Context,attr"`
+		List    []taskAction `xml:",any"`
+	} `xml:"Actions"`
+}
+
+type taskPrincipal struct {
+	ID        string `xml:"id,attr"`
+	UserID    string `xml:"UserId"`
+	GroupID   string `xml:"GroupId"`
+	LogonType string `xml:"LogonType"`
+	RunLevel  string `xml:"RunLevel"`
+}
+
+// taskAction is any action element; which fields are set depends on its
+// kind, Exec or ComHandler
+type taskAction struct {
+	XMLName   xml.Name
+	Command   string `xml:"Command"`
+	Arguments string `xml:"Arguments"`
+	ClassID   string `xml:"ClassId"`
+	Data      string `xml:"Data"`
+}
+
+// comServerKeys are the subkeys of a CLSID that name the binary serving the
+// class, in the order COM prefers them
+var comServerKeys = []string{"InprocServer32", "LocalServer32"}
+
+// TasksFromXML collects task runners from the task definitions stored below
+// dir on the collecting host
+func TasksFromXML(dir string) {
+	log := logerr.Add("task xml")
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Debugf("%v", err)
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Debugf("unable to read task: %s", err)
+			return nil
+		}
+
+		def, err := parseTaskXML(data)
+		if err != nil {
+			log.Debugf("unable to parse task %s: %s", path, err)
+			return nil
+		}
+
+		// tasks are named by their folder too, like Task Scheduler does, so
+		// those of the same name in different folders stay apart
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			rel = d.Name()
+		}
+		name := `\` + strings.ReplaceAll(filepath.ToSlash(rel), "/", `\`)
+
+		for _, runner := range def.runners(name) {
+			writeRunner(runner)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Warnf("unable to walk %s: %s", dir, err)
+	}
+}
+
+// OfflineTasks collects task runners from the task definitions on the
+// offline volume
+func OfflineTasks() {
+	log := logerr.Add("offline tasks")
+
+	dir, err := volume.LocalPath(tasksDir)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	TasksFromXML(dir)
+}
+
+// parseTaskXML parses a task definition. Definitions written by Task
+// Scheduler are UTF-16 encoded.
+func parseTaskXML(data []byte) (*taskDefinition, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		data = decodeUTF16Bytes(data[2:], binary.LittleEndian)
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		data = decodeUTF16Bytes(data[2:], binary.BigEndian)
+	case bytes.HasPrefix(data, []byte{0xef, 0xbb, 0xbf}):
+		data = data[3:]
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		// already converted to UTF-8 above
+		return input, nil
+	}
+
+	def := &taskDefinition{}
+	err := decoder.Decode(def)
+	if err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+func decodeUTF16Bytes(data []byte, order binary.ByteOrder) []byte {
+	u16 := make([]uint16, len(data)/2)
+	for i := range u16 {
+		u16[i] = order.Uint16(data[i*2:])
+	}
+	return []byte(string(utf16.Decode(u16)))
+}
+
+// enabled reports whether the task is enabled, which it is unless its
+// settings say otherwise
+func (def *taskDefinition) enabled() bool {
+	return def.Settings.Enabled == nil || *def.Settings.Enabled
+}
+
+// principal returns the principal the task's actions run as
+func (def *taskDefinition) principal() taskPrincipal {
+	for _, p := range def.Principals {
+		if p.ID == def.Actions.Context {
+			return p
+		}
+	}
+	if len(def.Principals) > 0 {
+		return def.Principals[0]
+	}
+	return taskPrincipal{}
+}
+
+// runners builds the runners of an enabled task called name
+func (def *taskDefinition) runners(name string) []PERunner {
+	if !def.enabled() {
+		return nil
+	}
+	return taskRunners(name, def.principal(), def.Actions.List)
+}
+
+// taskRunners builds a runner for each action of a task called name that
+// launches a binary. Exec actions launch their command and ComHandler
+// actions load the server registered for their CLSID.
+func taskRunners(name string, principal taskPrincipal, actions []taskAction) []PERunner {
+	log := logerr.Add("task runners")
+
+	context := &Principal{Name: taskAccountName(principal)}
+	runLevel := taskRunLevels[principal.RunLevel]
+	if runLevel == "" {
+		runLevel = taskRunLevels["LeastPrivilege"]
+	}
+
+	type launch struct{ path, args, payload string }
+	launches := make([]launch, 0, len(actions))
+	for _, action := range actions {
+		switch action.XMLName.Local {
+		case "Exec":
+			if action.Command == "" {
+				continue
+			}
+			path := strings.Trim(action.Command, `" `)
+			launches = append(launches, launch{path: expandRunnerPath(path), args: action.Arguments})
+		case "ComHandler":
+			server := comServer(action.ClassID)
+			if server == "" {
+				log.Debugf("no server registered for %s of task %s", action.ClassID, name)
+				continue
+			}
+			if strings.HasSuffix(util.Lower(server), ".exe") {
+				launches = append(launches, launch{path: server, args: action.Data})
+				continue
+			}
+			// in-process handlers are loaded by the task host
+			launches = append(launches, launch{
+				path:    expandRunnerPath(taskHost),
+				args:    action.Data,
+				payload: server,
+			})
+		}
+	}
+
+	runners := make([]PERunner, 0, len(launches))
+	for i, l := range launches {
+		runnerName := name
+		if len(launches) > 1 {
+			runnerName = fmt.Sprintf("%s #%d", name, i+1)
+		}
+		runner := newTaskRunner(runnerName, l.path, l.args, context, runLevel)
+		if l.payload != "" {
+			runner.Payload = runnerExe(l.payload)
+		}
+		runners = append(runners, runner)
+	}
+	return runners
+}
+
+// comServerPath returns the binary registered for a COM class, where read
+// returns the default value of a subkey of the class's CLSID key
+func comServerPath(read func(subKey string) (string, error)) string {
+	for _, subKey := range comServerKeys {
+		server, err := read(subKey)
+		if err != nil || server == "" {
+			continue
+		}
+		if subKey == "LocalServer32" {
+			// local servers are registered as command lines
+			return parseRunnerCommandLine(server).Binary
+		}
+		return expandRunnerPath(strings.Trim(server, `" `))
+	}
+	return ""
+}
+
+// taskAccountName names the account a task principal runs as. Group tasks
+// run as whichever member is logged on, so they're attributed to the group.
+func taskAccountName(p taskPrincipal) string {
+	account := p.UserID
+	if account == "" || p.LogonType == "Group" {
+		account = p.GroupID
+	}
+	if account == "" {
+		return "unknown"
+	}
+
+	if strings.HasPrefix(strings.ToUpper(account), "S-1-") {
+		sid, err := winacl.NewSIDFromString(account)
+		if err == nil {
+			return sidResolve(sid)
+		}
+	}
+	return account
+}
+
+// expandRunnerPath expands the environment variables in a runner's path the
+// way the host it was collected from would
+func expandRunnerPath(path string) string {
+	if Offline() {
+		return expandOfflineEnv(path, "")
+	}
+	return util.EvaluatePath(path)
+}
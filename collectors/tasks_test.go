@@ -0,0 +1,172 @@
+package collectors
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/audibleblink/lpegopher/hive"
+	"github.com/audibleblink/lpegopher/hive/hivetest"
+)
+
+// utf16Task encodes a task definition the way Task Scheduler stores it
+func utf16Task(xml string) []byte {
+	data := []byte{0xff, 0xfe}
+	for _, u := range utf16.Encode([]rune(xml)) {
+		data = binary.LittleEndian.AppendUint16(data, u)
+	}
+	return data
+}
+
+const updaterTask = `<?xml version="1.0" encoding="UTF-16"?>
+<Task version="1.2" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">
+  <Principals>
+    <Principal id="Users">
+      <GroupId>S-1-5-32-545</GroupId>
+      <LogonType>Group</LogonType>
+    </Principal>
+    <Principal id="System">
+      <UserId>S-1-5-18</UserId>
+      <RunLevel>HighestAvailable</RunLevel>
+    </Principal>
+  </Principals>
+  <Settings>
+    <Enabled>true</Enabled>
+  </Settings>
+  <Actions Context="System">
+    <Exec>
+      <Command>"%ProgramFiles%\Vendor\update.exe"</Command>
+      <Arguments>/check</Arguments>
+    </Exec>
+    <ComHandler>
+      <ClassId>{00000000-0000-0000-0000-000000000000}</ClassId>
+    </ComHandler>
+    <Exec>
+      <Command>%windir%\system32\cleanup.exe</Command>
+    </Exec>
+  </Actions>
+</Task>`
+
+func TestParseTaskXML(t *testing.T) {
+	useTestVolume(t)
+
+	t.Run("UTF-16 definitions are decoded", func(t *testing.T) {
+		def, err := parseTaskXML(utf16Task(updaterTask))
+		if err != nil {
+			t.Fatalf("parseTaskXML returned error: %v", err)
+		}
+		if len(def.Principals) != 2 || len(def.Actions.List) != 3 {
+			t.Errorf("Unexpected definition %+v", def)
+		}
+	})
+
+	t.Run("Exec actions run as the action context", func(t *testing.T) {
+		def, _ := parseTaskXML(utf16Task(updaterTask))
+		runners := def.runners("Updater")
+		if len(runners) != 2 {
+			t.Fatalf("Expected 2 runners, got %d", len(runners))
+		}
+
+		expected := []struct{ name, path, args string }{
+			{"Updater #1", `C:\Program Files\Vendor\update.exe`, "/check"},
+			{"Updater #2", `C:\Windows\system32\cleanup.exe`, ""},
+		}
+		for i, runner := range runners {
+			if runner.Name != expected[i].name || runner.Exe.Path != expected[i].path || runner.Args != expected[i].args {
+				t.Errorf("Runner %d = %s %s %s, expected %+v", i, runner.Name, runner.Exe.Path, runner.Args, expected[i])
+			}
+			if runner.Context.Name != "Local System" || runner.RunLevel != "Highest" {
+				t.Errorf("Runner %d runs as %s at %s", i, runner.Context.Name, runner.RunLevel)
+			}
+		}
+	})
+
+	t.Run("Group tasks run as the group", func(t *testing.T) {
+		def, _ := parseTaskXML([]byte(strings.Replace(updaterTask, `Context="System"`, `Context="Users"`, 1)))
+		runners := def.runners("Updater")
+		if len(runners) == 0 || runners[0].Context.Name != "BUILTIN Users" || runners[0].RunLevel != "Least" {
+			t.Errorf("Unexpected runners %+v", runners)
+		}
+	})
+
+	t.Run("Disabled tasks have no runners", func(t *testing.T) {
+		def, _ := parseTaskXML([]byte(strings.Replace(updaterTask, "<Enabled>true", "<Enabled>false", 1)))
+		if runners := def.runners("Updater"); len(runners) != 0 {
+			t.Errorf("Expected no runners, got %d", len(runners))
+		}
+	})
+}
+
+func TestOfflineTasks(t *testing.T) {
+	mount := useTestVolume(t)
+
+	dir := filepath.Join(mount, "Windows", "System32", "Tasks", "Vendor")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("Failed to create tasks directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Updater"), utf16Task(updaterTask), 0o644); err != nil {
+		t.Fatalf("Failed to write task: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Broken"), []byte("not xml"), 0o644); err != nil {
+		t.Fatalf("Failed to write task: %v", err)
+	}
+	// a task of the same name in another folder is another task
+	other := filepath.Join(mount, "Windows", "System32", "Tasks", "Other")
+	if err := os.MkdirAll(other, 0o755); err != nil {
+		t.Fatalf("Failed to create tasks directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(other, "Updater"), utf16Task(updaterTask), 0o644); err != nil {
+		t.Fatalf("Failed to write task: %v", err)
+	}
+
+	// SOFTWARE registers the server of the ComHandler action
+	b := hivetest.New()
+	server := b.Key("InprocServer32", nil, []uint32{
+		b.Value("", hive.EXPAND_SZ, hivetest.SZ(`%SystemRoot%\System32\Maint.DLL`)),
+	})
+	class := b.Key("{00000000-0000-0000-0000-000000000000}", []uint32{server}, nil)
+	clsid := b.Key("CLSID", []uint32{class}, nil)
+	classes := b.Key("Classes", []uint32{clsid}, nil)
+	err := b.WriteFile(filepath.Join(mount, "Windows", "System32", "config", "SOFTWARE"), b.Key("ROOT", []uint32{classes}, nil))
+	if err != nil {
+		t.Fatalf("Failed to write test hive: %v", err)
+	}
+
+	OfflineTasks()
+	var rows, others []string
+	for _, row := range collectedRows(t, RunnersFile) {
+		if strings.Contains(row, ",/other/updater #") {
+			others = append(others, row)
+		} else {
+			rows = append(rows, row)
+		}
+	}
+	if len(others) != 3 {
+		t.Errorf("Expected the same-named task in another folder to have its own runners, got %v", others)
+	}
+
+	expected := [][]string{
+		{"/vendor/updater #1", "task", "c:/program files/vendor/update.exe", "update.exe", "c:/program files/vendor", "local system", "Highest"},
+		{"/vendor/updater #2", "task", "c:/windows/system32/taskhostw.exe", "taskhostw.exe", "c:/windows/system32", "local system", "Highest"},
+		{"/vendor/updater #3", "task", "c:/windows/system32/cleanup.exe", "cleanup.exe", "c:/windows/system32", "local system", "Highest"},
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("Expected %d task runners, got %d: %v", len(expected), len(rows), rows)
+	}
+	for i, row := range rows {
+		fields := strings.Split(row, ",")
+		for j, want := range expected[i] {
+			if fields[j+1] != want {
+				t.Errorf("Runner %d field %d = %q, expected %q", i, j+1, fields[j+1], want)
+			}
+		}
+	}
+
+	// the in-process handler is the payload of the task host
+	if payload := strings.Split(rows[1], ",")[10]; payload != "c:/windows/system32/maint.dll" {
+		t.Errorf("Expected the COM server as payload, got %q", payload)
+	}
+}
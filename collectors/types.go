@@ -3,6 +3,7 @@ package collectors
 import (
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 
 	"github.com/audibleblink/lpegopher/util"
@@ -69,22 +70,45 @@ const (
 	ExecutedBy = "EXECUTED_BY"  // Execution relationship
 	RunsAs     = "RUNS_AS"      // Execution context relationship
 
+	ResolvesTo  = "RESOLVES_TO"  // Import loads from a Dll
+	PlantableIn = "PLANTABLE_IN" // Import would load from a copy planted in a directory
+
 	Imports    = "IMPORTS"     // Import relationship
-	Forwards   = "FORWARDS"    // Forwarding relationship
+	ForwardsTo = "FORWARDS_TO" // Export forwarded to a function of another DLL
 	ImportedBy = "IMPORTED_BY" // Reverse import relationship
 
+	StaticImport = "static" // Import resolved when the PE loads
+	DelayImport  = "delay"  // Import loaded on first call, a PE starts without it
+	BoundImport  = "bound"  // Static import with addresses bound ahead of time
+
 	Null = "NULL" // Null or empty value
 )
 
 // INode contains the parsed import and exports of a node
 type INode struct {
-	Name     string `json:"Name"`
-	Path     string `json:"Path"`
-	Parent   string `json:"Dir"`
-	Type     string `json:"Type"`
-	Forwards []*Dep `json:"Forwards"`
-	Imports  []*Dep `json:"Imports"`
-	DACL     DACL   `json:"DACL"`
+	Name           string        `json:"Name"`
+	Path           string        `json:"Path"`
+	Parent         string        `json:"Dir"`
+	Type           string        `json:"Type"`
+	Kind           string        `json:"Kind"` // KindExe, KindDriver, ...
+	Imports        []*Dep        `json:"Imports"`
+	DelayImports   []*Dep        `json:"DelayImports"`
+	BoundImports   []string      `json:"BoundImports"`   // DLLs the static imports are bound to
+	DynamicImports []string      `json:"DynamicImports"` // DLLs named in the strings of a PE loading libraries at run time
+	Exports        []Export      `json:"Exports"`
+	Header         *PEHeader     `json:"Header"`
+	Signature      *Signature    `json:"Signature"`
+	Manifest       *Manifest     `json:"Manifest"`
+	DotLocal       string        `json:"DotLocal"` // DotLocalFile or DotLocalDir beside an Exe
+	SHA256         string        `json:"SHA256"`
+	ImpHash        string        `json:"ImpHash"`
+	AssemblyRefs   []AssemblyRef `json:"AssemblyRefs"`  // managed assemblies a .NET PE references
+	PrivatePaths   []string      `json:"PrivatePaths"`  // probing directories from a .NET Exe's config
+	ParseError     string        `json:"ParseError"`    // why the PE couldn't be fully parsed
+	Tags           []string      `json:"Tags"`          // tags of the rules the PE matches
+	Capabilities   []string      `json:"Capabilities"`  // CapRPCServer, CapImpersonation, ...
+	ExportsParsed  bool          `json:"ExportsParsed"` // a Dll's export table was read, even if empty
+	DACL           DACL          `json:"DACL"`
 
 	id string
 }
@@ -119,17 +143,170 @@ func (i INode) ToCSV() string {
 		o = i.DACL.Owner.Name
 	}
 
-	fields := make([]string, 6)
+	fields := make([]string, 40)
 	fields[0] = i.ID()
 	fields[1] = util.PathFix(i.Name)
 	fields[2] = util.PathFix(i.Path)
 	fields[3] = util.PathFix(i.Parent)
 	fields[4] = hashFor(o)
 	fields[5] = hashFor(g)
+
+	// exports and their ordinals are parallel lists
+	if len(i.Exports) > 0 {
+		names := make([]string, len(i.Exports))
+		ordinals := make([]string, len(i.Exports))
+		for n, export := range i.Exports {
+			names[n] = export.Symbol()
+			ordinals[n] = strconv.FormatUint(uint64(export.Ordinal), 10)
+		}
+		fields[6] = util.QuoteCSV(strings.Join(names, ";"))
+		fields[7] = strings.Join(ordinals, ";")
+	}
+
+	if h := i.Header; h != nil {
+		fields[8] = h.Machine
+		fields[9] = h.Subsystem
+		fields[10] = strconv.FormatUint(uint64(h.Timestamp), 10)
+		fields[11] = strconv.FormatBool(h.ASLR)
+		fields[12] = strconv.FormatBool(h.DEP)
+		fields[13] = strconv.FormatBool(h.CFG)
+		fields[14] = strconv.FormatBool(h.HighEntropyVA)
+		fields[15] = strconv.FormatBool(h.DotNet)
+		for n, value := range []string{h.CompanyName, h.ProductName, h.FileVersion, h.OriginalFilename} {
+			if value != "" {
+				fields[16+n] = util.QuoteCSV(value)
+			}
+		}
+	}
+
+	if s := i.Signature; s != nil {
+		fields[20] = strconv.FormatBool(s.Signed)
+		if s.Signed {
+			if s.Subject != "" {
+				fields[21] = util.QuoteCSV(s.Subject)
+				fields[22] = util.QuoteCSV(s.Issuer)
+			}
+			fields[23] = s.Thumbprint
+			fields[24] = strconv.FormatBool(s.HashMatches)
+			fields[25] = strconv.FormatBool(s.Verified)
+			fields[26] = util.PathFix(s.Catalog)
+		}
+	}
+
+	if m := i.Manifest; m != nil {
+		fields[27] = strconv.FormatBool(m.AutoElevate)
+		if m.ExecutionLevel != "" {
+			fields[28] = util.QuoteCSV(m.ExecutionLevel)
+		}
+		fields[29] = strconv.FormatBool(m.UIAccess)
+		if len(m.Dependencies) > 0 {
+			assemblies := make([]string, len(m.Dependencies))
+			for n, assembly := range m.Dependencies {
+				assemblies[n] = assembly.String()
+			}
+			fields[30] = util.QuoteCSV(strings.Join(assemblies, ";"))
+		}
+	}
+	fields[31] = i.DotLocal
+	fields[32] = i.SHA256
+	fields[33] = i.ImpHash
+	fields[34] = i.Kind
+	if len(i.PrivatePaths) > 0 {
+		fields[35] = util.PathFix(strings.Join(i.PrivatePaths, ";"))
+	}
+	if i.ParseError != "" {
+		fields[36] = util.QuoteCSV(i.ParseError)
+	}
+	if len(i.Tags) > 0 {
+		fields[37] = util.QuoteCSV(strings.Join(i.Tags, ";"))
+	}
+	fields[38] = strings.Join(i.Capabilities, ";")
+	if i.ExportsParsed {
+		fields[39] = "true"
+	}
 	row := fmt.Sprintf("%s\n", strings.Join(fields, ","))
 	return row
 }
 
+// PEHeader is the metadata of a PE, from its headers and version resource
+type PEHeader struct {
+	Machine          string `json:"Machine"` // x86, x64, ARM64, ...
+	Subsystem        string `json:"Subsystem"`
+	Timestamp        uint32 `json:"Timestamp"` // link time, in seconds since the epoch
+	ASLR             bool   `json:"ASLR"`
+	DEP              bool   `json:"DEP"`
+	CFG              bool   `json:"CFG"`
+	HighEntropyVA    bool   `json:"HighEntropyVA"`
+	DotNet           bool   `json:"DotNet"`
+	CompanyName      string `json:"CompanyName"`
+	ProductName      string `json:"ProductName"`
+	FileVersion      string `json:"FileVersion"`
+	OriginalFilename string `json:"OriginalFilename"`
+}
+
+// Export is a function exported by a PE
+type Export struct {
+	Name      string `json:"Name"` // empty when exported by ordinal only
+	Ordinal   uint32 `json:"Ordinal"`
+	Forwarder string `json:"Forwarder"` // the DLL.Function it forwards to, if any
+}
+
+// Symbol returns the name importers use for the export: its name, or #N
+// when it's exported by ordinal only
+func (e Export) Symbol() string {
+	if e.Name == "" {
+		return fmt.Sprintf("#%d", e.Ordinal)
+	}
+	return e.Name
+}
+
+// forwardTarget returns the DLL and function a forwarded export is
+// forwarded to: #N for a function forwarded to by ordinal
+func (e Export) forwardTarget() (dll, fn string) {
+	dot := strings.LastIndex(e.Forwarder, ".")
+	if dot <= 0 {
+		return "", ""
+	}
+	return util.Lower(e.Forwarder[:dot]) + ".dll", e.Forwarder[dot+1:]
+}
+
+// Forward relates a Dll to the DLL one of its exports is forwarded to, and
+// to the Dll that DLL resolves to, if any
+type Forward struct {
+	Start    string // ID of the forwarding Dll
+	End      string // ID of the Dep forwarded to
+	Resolved string // ID of the Dll the Dep resolves to, if any
+	Fn       string // the forwarded export
+	Target   string // the function it's forwarded to
+
+	id string
+}
+
+// ID returns the unique identifier for a Forward
+func (f Forward) ID() string {
+	if f.id != "" {
+		return f.id
+	}
+	f.id = hashFor(f.ToCSV())
+	return f.id
+}
+
+// CacheKey returns the key to use for caching a Forward
+func (f Forward) CacheKey() string {
+	return f.ToCSV()
+}
+
+// ToCSV converts the Forward to a CSV formatted string
+func (f Forward) ToCSV() string {
+	return fmt.Sprintf("%s,%s,%s,%s,%s,%s\n",
+		f.Start, ForwardsTo, f.End, f.Resolved, util.QuoteCSV(f.Fn), util.QuoteCSV(f.Target))
+}
+
+// Write outputs the Forward data to the provided writer and returns its ID
+func (f Forward) Write(file io.Writer) string {
+	return GenericWriteOp(f, file, f.CacheKey())
+}
+
 // DACL represents a Discretionary Access Control List
 type DACL struct {
 	Owner *Principal    `json:"Owner"`
@@ -214,9 +391,47 @@ func (r Rel) Write(file io.Writer) string {
 	return GenericWriteOp(r, file, r.CacheKey())
 }
 
+// Import relates a PE to a DLL it imports, along with the functions it
+// imports from it by name or, as #N, by ordinal
+type Import struct {
+	Start string   // ID of the importing PE
+	End   string   // ID of the Dep
+	Fns   []string // imported functions, in import table order
+	Kind  string   // StaticImport, DelayImport, BoundImport, DynamicImport or ManagedImport
+
+	id string
+}
+
+// ID returns the unique identifier for an Import
+func (i Import) ID() string {
+	if i.id != "" {
+		return i.id
+	}
+	i.id = hashFor(i.ToCSV())
+	return i.id
+}
+
+// CacheKey returns the key to use for caching an Import
+func (i Import) CacheKey() string {
+	return i.ToCSV()
+}
+
+// ToCSV converts the Import to a CSV formatted string. The functions share
+// one field, separated by semicolons.
+func (i Import) ToCSV() string {
+	fns := util.QuoteCSV(strings.Join(i.Fns, ";"))
+	return fmt.Sprintf("%s,%s,%s,%s,%s\n", i.Start, Imports, i.End, fns, i.Kind)
+}
+
+// Write outputs the Import data to the provided writer and returns its ID
+func (i Import) Write(file io.Writer) string {
+	return GenericWriteOp(i, file, i.CacheKey())
+}
+
 // Dep represents a dependency with a name
 type Dep struct {
 	Name string `json:"Name"`
+	Host string `json:"Host"` // the DLL hosting an API set contract
 	id   string
 }
 
@@ -236,7 +451,7 @@ func (d Dep) CacheKey() string {
 
 // ToCSV converts the dependency to a CSV formatted string
 func (d Dep) ToCSV() string {
-	return fmt.Sprintf("%s,%s\n", d.ID(), d.Name)
+	return fmt.Sprintf("%s,%s,%s\n", d.ID(), d.Name, d.Host)
 }
 
 // Write outputs the dependency data to the provided writer and returns its ID
@@ -252,6 +467,12 @@ type PERunner struct {
 	Args     string     `json:"Args"`
 	Context  *Principal `json:"Context"` // Principal.Name
 	RunLevel string     `json:"RunLevel"`
+	Start    string     `json:"Start"`   // service start type
+	Payload  *INode     `json:"Payload"` // file a proxy-execution Exe runs
+
+	// Candidates are the paths CreateProcess tries before Exe when the
+	// runner's command line is unquoted
+	Candidates []string `json:"Candidates"`
 
 	id string
 }
@@ -261,7 +482,8 @@ func (r PERunner) ID() string {
 	if r.id != "" {
 		return r.id
 	}
-	r.id = hashFor(fmt.Sprintf("%s:%s", r.Type, r.Name))
+	// per-user runners, such as HKCU Run keys, share names across users
+	r.id = hashFor(fmt.Sprintf("%s:%s:%s", r.Type, r.Name, r.Context.Name))
 	return r.id
 }
 
@@ -272,7 +494,12 @@ func (r PERunner) CacheKey() string {
 
 // ToCSV converts the PERunner to a CSV formatted string
 func (r PERunner) ToCSV() string {
-	fields := make([]string, 8)
+	payload := ""
+	if r.Payload != nil {
+		payload = util.PathFix(r.Payload.Path)
+	}
+
+	fields := make([]string, 11)
 	fields[0] = r.ID()
 	fields[1] = util.PathFix(r.Name)       // runner name
 	fields[2] = r.Type                     // service or task or runkey
@@ -281,6 +508,9 @@ func (r PERunner) ToCSV() string {
 	fields[5] = util.PathFix(r.Exe.Parent) // exe parent dir
 	fields[6] = util.Lower(r.Context.Name) // executin Principal
 	fields[7] = r.RunLevel                 // runlevel
+	fields[8] = r.Start                    // service start type
+	fields[9] = util.QuoteCSV(r.Args)      // raw arguments
+	fields[10] = payload                   // proxied payload
 	row := fmt.Sprintf("%s\n", strings.Join(fields, ","))
 	return row
 }
@@ -289,3 +519,77 @@ func (r PERunner) ToCSV() string {
 func (r PERunner) Write(file io.Writer) string {
 	return GenericWriteOp(r, file, r.CacheKey())
 }
+
+// Candidate is a path Windows would run in place of a runner's executable,
+// were a file planted there
+type Candidate struct {
+	Runner string // ID of the runner
+	Path   string
+
+	id string
+}
+
+// ID returns the unique identifier for a Candidate
+func (c Candidate) ID() string {
+	if c.id != "" {
+		return c.id
+	}
+	c.id = hashFor(c.Runner + c.Path)
+	return c.id
+}
+
+// CacheKey returns the key to use for caching a Candidate
+func (c Candidate) CacheKey() string {
+	return c.Runner + c.Path
+}
+
+// ToCSV converts the Candidate to a CSV formatted string
+func (c Candidate) ToCSV() string {
+	fields := make([]string, 4)
+	fields[0] = c.Runner
+	fields[1] = util.PathFix(c.Path)
+	fields[2] = util.PathFix(util.WinBase(c.Path))
+	fields[3] = util.PathFix(util.WinDir(c.Path))
+	row := fmt.Sprintf("%s\n", strings.Join(fields, ","))
+	return row
+}
+
+// Write outputs the Candidate data to the provided writer and returns its ID
+func (c Candidate) Write(file io.Writer) string {
+	return GenericWriteOp(c, file, c.CacheKey())
+}
+
+// Resolution relates an Exe to the Dll one of its imports loads from, or to
+// a directory a planted copy of the import would load from
+type Resolution struct {
+	Exe string // ID of the importing Exe
+	Rel string // ResolvesTo or PlantableIn
+	End string // ID of the Dll or Directory
+	Dll string // name of the import
+
+	id string
+}
+
+// ID returns the unique identifier for a Resolution
+func (r Resolution) ID() string {
+	if r.id != "" {
+		return r.id
+	}
+	r.id = hashFor(r.ToCSV())
+	return r.id
+}
+
+// CacheKey returns the key to use for caching a Resolution
+func (r Resolution) CacheKey() string {
+	return r.ToCSV()
+}
+
+// ToCSV converts the Resolution to a CSV formatted string
+func (r Resolution) ToCSV() string {
+	return fmt.Sprintf("%s,%s,%s,%s\n", r.Exe, r.Rel, r.End, util.PathFix(r.Dll))
+}
+
+// Write outputs the Resolution data to the provided writer and returns its ID
+func (r Resolution) Write(file io.Writer) string {
+	return GenericWriteOp(r, file, r.CacheKey())
+}
@@ -50,10 +50,128 @@ func TestINodeMethods(t *testing.T) {
 			t.Error("CSV should contain the node name")
 		}
 
-		// Check CSV has expected format (ID,Name,Path,Parent,Owner,Group)
+		// Check CSV has expected format (ID,Name,Path,Parent,Owner,Group,
+		// Exports,Ordinals, the 12 header, 7 signature and 4 manifest fields, dot_local, sha256, imphash, pe_kind, private_paths, parse_error, tags, capabilities and exports_parsed)
 		fields := strings.Split(strings.TrimSpace(csv), ",")
-		if len(fields) != 6 {
-			t.Errorf("Expected 6 CSV fields, got %d", len(fields))
+		if len(fields) != 40 {
+			t.Errorf("Expected 40 CSV fields, got %d", len(fields))
+		}
+	})
+
+	t.Run("ToCSV includes header metadata", func(t *testing.T) {
+		exe := INode{
+			Path: "c:/tools/app.exe",
+			Header: &PEHeader{
+				Machine:     "x64",
+				Subsystem:   "gui",
+				Timestamp:   1700000000,
+				ASLR:        true,
+				CompanyName: "Vendor, Inc.",
+			},
+		}
+		csv := strings.TrimSpace(exe.ToCSV())
+		expected := `x64,gui,1700000000,true,false,false,false,false,"Vendor, Inc.",,,,,,,,,,,,,,,,,,,,,,,`
+		if !strings.HasSuffix(csv, expected) {
+			t.Errorf("Expected header fields %s, got %s", expected, csv)
+		}
+	})
+
+	t.Run("ToCSV includes the signature", func(t *testing.T) {
+		signed := INode{
+			Path: "c:/windows/system32/app.exe",
+			Signature: &Signature{
+				Signed:      true,
+				Subject:     "CN=Microsoft Windows,O=Microsoft Corporation",
+				Issuer:      "CN=Microsoft Windows Production PCA 2011",
+				Thumbprint:  "ab12",
+				HashMatches: true,
+				Catalog:     "c:/windows/system32/catroot/{f750e6c3}/nt.cat",
+			},
+		}
+		csv := strings.TrimSpace(signed.ToCSV())
+		expected := `,true,"CN=Microsoft Windows,O=Microsoft Corporation","CN=Microsoft Windows Production PCA 2011",` +
+			`ab12,true,false,c:/windows/system32/catroot/{f750e6c3}/nt.cat,,,,,,,,,,,,,`
+		if !strings.HasSuffix(csv, expected) {
+			t.Errorf("Expected signature fields %s, got %s", expected, csv)
+		}
+
+		unsigned := INode{Path: "c:/tools/app.exe", Signature: &Signature{}}
+		csv = strings.TrimSpace(unsigned.ToCSV())
+		if !strings.HasSuffix(csv, ",false,,,,,,,,,,,,,,,,,,,") {
+			t.Errorf("Expected only signed=false, got %s", csv)
+		}
+	})
+
+	t.Run("ToCSV includes the manifest and DotLocal redirection", func(t *testing.T) {
+		exe := INode{
+			Path:     "c:/windows/system32/fodhelper.exe",
+			DotLocal: DotLocalDir,
+			Manifest: &Manifest{
+				AutoElevate:    true,
+				ExecutionLevel: "requireAdministrator",
+				Dependencies: []AssemblyIdentity{
+					{Name: "Microsoft.Windows.Common-Controls", Version: "6.0.0.0"},
+					{Name: "Microsoft.VC90.CRT", Version: "9.0.21022.8"},
+				},
+			},
+		}
+		csv := strings.TrimSpace(exe.ToCSV())
+		expected := `,true,"requireAdministrator",false,"Microsoft.Windows.Common-Controls/6.0.0.0;Microsoft.VC90.CRT/9.0.21022.8",directory,,,,,,,,`
+		if !strings.HasSuffix(csv, expected) {
+			t.Errorf("Expected manifest fields %s, got %s", expected, csv)
+		}
+	})
+
+	t.Run("ToCSV ends with the content hashes, kind and probing paths", func(t *testing.T) {
+		dll := INode{
+			Path:    "c:/tools/hashed.dll",
+			SHA256:  "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+			ImpHash: "cddeda70f300a0240228676bc199280f",
+			Kind:    KindCOMServer,
+
+			PrivatePaths: []string{`bin`, `lib\x64`},
+		}
+		csv := strings.TrimSpace(dll.ToCSV())
+		expected := ",ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad,cddeda70f300a0240228676bc199280f,com,bin;lib/x64,,,,"
+		if !strings.HasSuffix(csv, expected) {
+			t.Errorf("Expected hash fields %s, got %s", expected, csv)
+		}
+	})
+
+	t.Run("ToCSV ends with the parse error, tags and capabilities", func(t *testing.T) {
+		dll := INode{
+			Path:         "c:/tools/broken.dll",
+			ParseError:   "exports: bad RVA, \"0x10\"",
+			Tags:         []string{"vendor-updater", "embeds-credentials"},
+			Capabilities: []string{CapRPCServer, CapImpersonation},
+		}
+		csv := strings.TrimSpace(dll.ToCSV())
+		expected := `,,"exports: bad RVA, ""0x10""","vendor-updater;embeds-credentials",rpc-server;impersonation,`
+		if !strings.HasSuffix(csv, expected) {
+			t.Errorf("Expected parse error, tag and capability fields %s, got %s", expected, csv)
+		}
+	})
+
+	t.Run("ToCSV marks parsed exports, even when there are none", func(t *testing.T) {
+		dll := INode{Path: "c:/tools/resources.dll", ExportsParsed: true}
+		fields := strings.Split(strings.TrimSpace(dll.ToCSV()), ",")
+		if fields[6] != "" || fields[7] != "" || fields[39] != "true" {
+			t.Errorf("Expected no exports, parsed, got %q", fields)
+		}
+	})
+
+	t.Run("ToCSV lists exports and their ordinals", func(t *testing.T) {
+		dll := INode{
+			Path: "c:/tools/helper.dll",
+			Exports: []Export{
+				{Name: "Run", Ordinal: 1},
+				{Ordinal: 7},
+				{Name: "Old", Ordinal: 9, Forwarder: "new.Run"},
+			},
+		}
+		fields := strings.Split(strings.TrimSpace(dll.ToCSV()), ",")
+		if fields[6] != `"Run;#7;Old"` || fields[7] != "1;7;9" {
+			t.Errorf("Expected exports \"Run;#7;Old\" and ordinals 1;7;9, got %s and %s", fields[6], fields[7])
 		}
 	})
 
@@ -228,6 +346,45 @@ func TestRelMethods(t *testing.T) {
 	})
 }
 
+func TestForwardMethods(t *testing.T) {
+	fwd := Forward{Start: "dll123", End: "dep456", Resolved: "dll789", Fn: "Old", Target: "Run"}
+
+	t.Run("ToCSV formats correctly", func(t *testing.T) {
+		expected := "dll123,FORWARDS_TO,dep456,dll789,\"Old\",\"Run\"\n"
+		if csv := fwd.ToCSV(); csv != expected {
+			t.Errorf("Expected CSV %q, got %q", expected, csv)
+		}
+	})
+
+	t.Run("Write outputs data and returns ID", func(t *testing.T) {
+		var buf bytes.Buffer
+		id := fwd.Write(&buf)
+		if id != fwd.ID() {
+			t.Errorf("Write should return the forward ID: expected %s, got %s", fwd.ID(), id)
+		}
+		if buf.String() != fwd.ToCSV() {
+			t.Errorf("Expected %q written, got %q", fwd.ToCSV(), buf.String())
+		}
+	})
+
+	t.Run("forwardTarget splits the forwarder", func(t *testing.T) {
+		tests := []struct {
+			export  Export
+			dll, fn string
+		}{
+			{Export{Name: "Old", Forwarder: "NEW.Run"}, "new.dll", "Run"},
+			{Export{Ordinal: 4, Forwarder: "api-ms-win-core-file-l1-1-0.#7"}, "api-ms-win-core-file-l1-1-0.dll", "#7"},
+			{Export{Name: "Plain"}, "", ""},
+		}
+		for _, test := range tests {
+			dll, fn := test.export.forwardTarget()
+			if dll != test.dll || fn != test.fn {
+				t.Errorf("Expected %q forwarded to %s!%s, got %s!%s", test.export.Forwarder, test.dll, test.fn, dll, fn)
+			}
+		}
+	})
+}
+
 func TestDepMethods(t *testing.T) {
 	// Set up test dependency
 	dep := Dep{
@@ -265,10 +422,10 @@ func TestDepMethods(t *testing.T) {
 			t.Error("CSV should contain the dependency name")
 		}
 
-		// Check CSV has expected format (ID,Name)
+		// Check CSV has expected format (ID,Name,Host)
 		fields := strings.Split(strings.TrimSpace(csv), ",")
-		if len(fields) != 2 {
-			t.Errorf("Expected 2 CSV fields, got %d", len(fields))
+		if len(fields) != 3 {
+			t.Errorf("Expected 3 CSV fields, got %d", len(fields))
 		}
 	})
 
@@ -342,10 +499,14 @@ func TestPERunnerMethods(t *testing.T) {
 			t.Error("CSV should contain the runner type")
 		}
 
-		// Check CSV has expected format with 8 fields
+		// Check CSV has expected format with 11 fields
 		fields := strings.Split(strings.TrimSpace(csv), ",")
-		if len(fields) != 8 {
-			t.Errorf("Expected 8 CSV fields, got %d", len(fields))
+		if len(fields) != 11 {
+			t.Errorf("Expected 11 CSV fields, got %d", len(fields))
+		}
+
+		if fields[9] != `"-k test"` {
+			t.Errorf("Expected quoted raw args, got %s", fields[9])
 		}
 	})
 
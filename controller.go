@@ -2,11 +2,15 @@ package main
 
 import (
 	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
 
 	"github.com/alexflint/go-arg"
 
 	"github.com/audibleblink/logerr"
 	"github.com/audibleblink/lpegopher/args"
+	"github.com/audibleblink/lpegopher/collectors"
 	"github.com/audibleblink/lpegopher/processor"
 )
 
@@ -56,6 +60,30 @@ func doProcessCmd(args args.ArgType, cli *arg.Parser) (err error) {
 		return
 	}
 
+	log.Info("creating dll search order relationships")
+	err = processor.RelateSearchOrder(args.Process.HTTP)
+	if err != nil {
+		return
+	}
+
+	log.Info("creating export forwarder relationships")
+	err = processor.RelateForwards(args.Process.HTTP)
+	if err != nil {
+		return
+	}
+
+	log.Info("creating auto-elevation relationships")
+	err = processor.RelateAutoElevation()
+	if err != nil {
+		return
+	}
+
+	log.Info("flagging imports missing from their dlls")
+	err = processor.FlagMissingExports()
+	if err != nil {
+		return
+	}
+
 	log.Info("creating ACL relationships")
 	err = processor.RelateACLs(args.Process.HTTP)
 	if err != nil {
@@ -90,3 +118,46 @@ func serveFiles(server string) *http.Server {
 	// returning reference so caller can call Shutdown()
 	return srv
 }
+
+// forkPECollection starts a PE collector for each directory directly below
+// root
+func forkPECollection(root string, wg *sync.WaitGroup) error {
+	log := logerr.Add("forkPECollection")
+
+	files, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if f.IsDir() {
+			path := filepath.Join(root, f.Name())
+			log.Debugf("forking collection of %s", path)
+			wg.Add(1)
+			startPath := path // Copy loop variable to avoid capture issues in Go 1.22+
+			go func() {
+				defer wg.Done()
+				collectors.PEs(startPath)
+			}()
+		}
+	}
+	return nil
+}
+
+// finishCollection flushes all collector output and reminds the user of the
+// next step
+func finishCollection() {
+	log := logerr.Add("finishCollection")
+	log.Info("flushing buffers and closing files")
+	collectors.FlushAndClose()
+	log.Info("collection complete")
+	log.Warn(
+		"=============================================================================================",
+	)
+	log.Warn(
+		"don't forget to upload/move *.csv to neo4j's `import` directory before running postprocessing",
+	)
+	log.Warn(
+		"=============================================================================================",
+	)
+}
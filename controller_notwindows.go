@@ -12,8 +12,10 @@ import (
 )
 
 func doCollectCmd(a args.ArgType, cli *arg.Parser) error {
-	_, _ = a, cli
-	return fmt.Errorf("collect functionality is only available on Windows")
+	if a.Collect.Offline == "" {
+		return fmt.Errorf("live collection is only available on Windows, use --offline")
+	}
+	return doOfflineCollectCmd(a, cli)
 }
 
 func getSystem() error {
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/alexflint/go-arg"
+
+	"github.com/audibleblink/logerr"
+	"github.com/audibleblink/lpegopher/args"
+	"github.com/audibleblink/lpegopher/collectors"
+)
+
+// doOfflineCollectCmd collects from a Windows system volume that is mounted
+// on this host rather than from the running system
+func doOfflineCollectCmd(args args.ArgType, cli *arg.Parser) (err error) {
+	_ = cli
+	log := logerr.Add("doOfflineCollectCmd")
+
+	volume, err := collectors.UseOfflineVolume(args.Collect.Offline, args.Collect.Drive)
+	if err != nil {
+		return log.Wrap(err)
+	}
+
+	root := volume.Mount
+	if args.Collect.Root != "" {
+		root, err = volume.LocalPath(args.Collect.Root)
+		if err != nil {
+			return log.Wrap(err)
+		}
+	}
+
+	log.Infof("offline collection of %s started", root)
+	collectors.InitOutputFiles()
+
+	log.Info("collecting offline accounts")
+	err = collectors.LoadOfflineAccounts()
+	if err != nil {
+		log.Warnf("account names unavailable: %s", err)
+	}
+
+	log.Info("loading dll search order")
+	collectors.LoadSearchOrder()
+
+	log.Info("loading root certificates")
+	collectors.LoadRootStore(args.Collect.Roots)
+	if args.Collect.Catalogs {
+		log.Info("indexing catalog files")
+		collectors.LoadCatalogs()
+	}
+	collectors.ConfigurePEDetection(args.Collect.Sniff, args.Collect.Extensions)
+	collectors.ConfigurePELimits(args.Collect.MaxSize<<20, args.Collect.Timeout)
+	if args.Collect.Rules != "" {
+		log.Info("loading tagging rules")
+		err = collectors.LoadRules(args.Collect.Rules)
+		if err != nil {
+			return log.Wrap(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	err = forkPECollection(root, &wg)
+	if err != nil {
+		return log.Wrap(err)
+	}
+
+	wg.Add(1)
+	log.Info("collecting services")
+	go func() {
+		defer wg.Done()
+		collectors.OfflineServices()
+	}()
+
+	wg.Add(1)
+	log.Info("collecting autoruns")
+	go func() {
+		defer wg.Done()
+		collectors.OfflineAutoruns()
+	}()
+
+	wg.Add(1)
+	log.Info("collecting tasks")
+	go func() {
+		defer wg.Done()
+		collectors.OfflineTasks()
+	}()
+
+	wg.Wait()
+	finishCollection()
+	return
+}
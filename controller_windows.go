@@ -1,8 +1,7 @@
 package main
 
 import (
-	"os"
-	"path/filepath"
+	"fmt"
 	"sync"
 
 	"github.com/alexflint/go-arg"
@@ -15,7 +14,14 @@ import (
 )
 
 func doCollectCmd(args args.ArgType, cli *arg.Parser) (err error) {
+	if args.Collect.Offline != "" {
+		return doOfflineCollectCmd(args, cli)
+	}
+
 	log := logerr.Add("doCollectCmd")
+	if args.Collect.Root == "" {
+		return log.Wrap(fmt.Errorf("a root directory is required unless collecting --offline"))
+	}
 	log.Info("collection started")
 
 	collectors.InitOutputFiles()
@@ -23,25 +29,30 @@ func doCollectCmd(args args.ArgType, cli *arg.Parser) (err error) {
 	log.Info("collecting system principals")
 	collectors.CreateGroupPrincipals()
 
-	var wg sync.WaitGroup
+	log.Info("loading dll search order")
+	collectors.LoadSearchOrder()
 
-	files, err := os.ReadDir(args.Collect.Root)
-	if err != nil {
-		log.Fatal(err.Error())
+	log.Info("loading root certificates")
+	collectors.LoadRootStore(args.Collect.Roots)
+	if args.Collect.Catalogs {
+		log.Info("indexing catalog files")
+		collectors.LoadCatalogs()
+	}
+	collectors.ConfigurePEDetection(args.Collect.Sniff, args.Collect.Extensions)
+	collectors.ConfigurePELimits(args.Collect.MaxSize<<20, args.Collect.Timeout)
+	if args.Collect.Rules != "" {
+		log.Info("loading tagging rules")
+		err = collectors.LoadRules(args.Collect.Rules)
+		if err != nil {
+			return log.Wrap(err)
+		}
 	}
 
-	for _, f := range files {
-		if f.IsDir() {
-			path := filepath.Join(args.Collect.Root, f.Name())
-			log.Debugf("forking collection of %s", path)
-			wg.Add(1)
-			startPath := path // Copy loop variable to avoid capture issues in Go 1.22+
-			go func() {
-				defer wg.Done()
-				collectors.PEs(startPath)
-			}()
+	var wg sync.WaitGroup
 
-		}
+	err = forkPECollection(args.Collect.Root, &wg)
+	if err != nil {
+		log.Fatal(err.Error())
 	}
 
 	wg.Add(1)
@@ -73,18 +84,7 @@ func doCollectCmd(args args.ArgType, cli *arg.Parser) (err error) {
 	}()
 
 	wg.Wait()
-	log.Info("flushing buffers and closing files")
-	collectors.FlushAndClose()
-	log.Info("collection complete")
-	log.Warn(
-		"=============================================================================================",
-	)
-	log.Warn(
-		"don't forget to upload/move *.csv to neo4j's `import` directory before running postprocessing",
-	)
-	log.Warn(
-		"=============================================================================================",
-	)
+	finishCollection()
 	return
 }
 
@@ -6,6 +6,7 @@ toolchain go1.23.6
 
 require (
 	github.com/Microsoft/go-winio v0.6.2
+	github.com/Velocidex/pkcs7 v0.0.0-20230220112103-d4ed02e1862a
 	github.com/alexflint/go-arg v1.5.1
 	github.com/audibleblink/concurrent-writer v0.1.0
 	github.com/audibleblink/getsystem v0.2.0
@@ -17,13 +18,13 @@ require (
 	github.com/minio/highwayhash v1.0.3
 	github.com/neo4j/neo4j-go-driver/v4 v4.4.8
 	golang.org/x/sys v0.31.0
+	gopkg.in/yaml.v3 v3.0.1
 	www.velocidex.com/golang/binparsergen v0.1.0
 	www.velocidex.com/golang/go-pe v0.1.1-0.20210915141920-02eb5d611e80
 )
 
 require (
 	github.com/Velocidex/ordereddict v0.0.0-20230909174157-2aa49cc5d11d // indirect
-	github.com/Velocidex/pkcs7 v0.0.0-20230220112103-d4ed02e1862a // indirect
 	github.com/alexflint/go-scalar v1.2.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/fatih/color v1.18.0 // indirect
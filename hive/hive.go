@@ -0,0 +1,530 @@
+// Package hive reads offline Windows registry hive (regf) files, such as
+// SYSTEM, SOFTWARE or NTUSER.DAT, without the Windows registry API. Its Key
+// methods mirror golang.org/x/sys/windows/registry so collectors read the
+// same way from live and offline sources.
+package hive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// Registry value types
+const (
+	NONE                       = 0
+	SZ                         = 1
+	EXPAND_SZ                  = 2
+	BINARY                     = 3
+	DWORD                      = 4
+	DWORD_BIG_ENDIAN           = 5
+	LINK                       = 6
+	MULTI_SZ                   = 7
+	RESOURCE_LIST              = 8
+	FULL_RESOURCE_DESCRIPTOR   = 9
+	RESOURCE_REQUIREMENTS_LIST = 10
+	QWORD                      = 11
+)
+
+const (
+	baseBlockSize = 0x1000     // size of the regf header preceding the first hbin
+	maxCellSize   = 1 << 24    // sanity cap on a single cell
+	maxListLength = 1 << 16    // sanity cap on subkey and value lists
+	bigDataLimit  = 16344      // largest value stored outside a "db" record
+	inlineData    = 0x80000000 // data size flag for values stored in the offset field
+
+	keyCompName   = 0x0020 // nk flag: key name is stored as latin-1
+	valueCompName = 0x0001 // vk flag: value name is stored as latin-1
+)
+
+var (
+	// ErrNotExist is returned when a key or value is missing from the hive
+	ErrNotExist = errors.New("hive: key or value does not exist")
+
+	// ErrUnexpectedType is returned when a value's type doesn't match the
+	// requested Get method
+	ErrUnexpectedType = errors.New("hive: unexpected value type")
+)
+
+// Hive is an open registry hive file
+type Hive struct {
+	r     io.ReaderAt
+	c     io.Closer
+	minor uint32
+	root  uint32
+}
+
+// Open opens the hive file at path
+func Open(path string) (*Hive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := New(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	h.c = f
+	return h, nil
+}
+
+// New reads a hive from r
+func New(r io.ReaderAt) (*Hive, error) {
+	header := make([]byte, 0x30)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("reading base block: %w", err)
+	}
+
+	if !bytes.Equal(header[:4], []byte("regf")) {
+		return nil, fmt.Errorf("not a registry hive")
+	}
+
+	return &Hive{
+		r:     r,
+		minor: binary.LittleEndian.Uint32(header[0x18:]),
+		root:  binary.LittleEndian.Uint32(header[0x24:]),
+	}, nil
+}
+
+// Close releases the underlying file, if the hive was opened from one
+func (h *Hive) Close() error {
+	if h.c == nil {
+		return nil
+	}
+	return h.c.Close()
+}
+
+// Root returns the hive's root key
+func (h *Hive) Root() (*Key, error) {
+	return h.key(h.root)
+}
+
+// OpenKey opens the backslash-separated path below the hive's root key
+func (h *Hive) OpenKey(path string) (*Key, error) {
+	root, err := h.Root()
+	if err != nil {
+		return nil, err
+	}
+	return root.OpenKey(path)
+}
+
+// cell returns the data of the cell at offset, relative to the first hbin
+func (h *Hive) cell(offset uint32) ([]byte, error) {
+	if offset == 0 || offset == 0xffffffff {
+		return nil, fmt.Errorf("invalid cell offset %#x", offset)
+	}
+
+	pos := int64(baseBlockSize) + int64(offset)
+	sizeBuf := make([]byte, 4)
+	if _, err := h.r.ReadAt(sizeBuf, pos); err != nil {
+		return nil, fmt.Errorf("reading cell at %#x: %w", offset, err)
+	}
+
+	// allocated cells carry a negative size, which includes the size field
+	size := -int32(binary.LittleEndian.Uint32(sizeBuf))
+	if size < 4 || size > maxCellSize {
+		return nil, fmt.Errorf("invalid cell size at %#x", offset)
+	}
+
+	data := make([]byte, size-4)
+	if _, err := h.r.ReadAt(data, pos+4); err != nil {
+		return nil, fmt.Errorf("reading cell at %#x: %w", offset, err)
+	}
+	return data, nil
+}
+
+func (h *Hive) key(offset uint32) (*Key, error) {
+	nk, err := h.cell(offset)
+	if err != nil {
+		return nil, err
+	}
+	if len(nk) < 0x4c || !bytes.Equal(nk[:2], []byte("nk")) {
+		return nil, fmt.Errorf("cell at %#x is not a key", offset)
+	}
+
+	flags := binary.LittleEndian.Uint16(nk[0x02:])
+	nameLen := int(binary.LittleEndian.Uint16(nk[0x48:]))
+	if 0x4c+nameLen > len(nk) {
+		return nil, fmt.Errorf("key name at %#x is truncated", offset)
+	}
+
+	return &Key{
+		h:       h,
+		Name:    decodeName(nk[0x4c:0x4c+nameLen], flags&keyCompName != 0),
+		subkeys: binary.LittleEndian.Uint32(nk[0x1c:]),
+		nSub:    binary.LittleEndian.Uint32(nk[0x14:]),
+		values:  binary.LittleEndian.Uint32(nk[0x28:]),
+		nValues: binary.LittleEndian.Uint32(nk[0x24:]),
+	}, nil
+}
+
+// subkeyOffsets flattens an lf, lh, li or ri list into key offsets
+func (h *Hive) subkeyOffsets(offset uint32, depth int) ([]uint32, error) {
+	if depth > 2 {
+		return nil, fmt.Errorf("subkey index at %#x is nested too deeply", offset)
+	}
+
+	list, err := h.cell(offset)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) < 4 {
+		return nil, fmt.Errorf("subkey list at %#x is truncated", offset)
+	}
+
+	count := int(binary.LittleEndian.Uint16(list[2:]))
+	if count > maxListLength {
+		return nil, fmt.Errorf("subkey list at %#x is too long", offset)
+	}
+
+	stride := 4
+	switch string(list[:2]) {
+	case "lf", "lh":
+		stride = 8 // offset followed by a name hint or hash
+	case "li", "ri":
+	default:
+		return nil, fmt.Errorf("cell at %#x is not a subkey list", offset)
+	}
+
+	if 4+count*stride > len(list) {
+		return nil, fmt.Errorf("subkey list at %#x is truncated", offset)
+	}
+
+	offsets := make([]uint32, 0, count)
+	for i := range count {
+		off := binary.LittleEndian.Uint32(list[4+i*stride:])
+		if string(list[:2]) != "ri" {
+			offsets = append(offsets, off)
+			continue
+		}
+
+		nested, err := h.subkeyOffsets(off, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, nested...)
+	}
+	return offsets, nil
+}
+
+// Key is a registry key read from a Hive
+type Key struct {
+	Name string
+
+	h       *Hive
+	subkeys uint32
+	nSub    uint32
+	values  uint32
+	nValues uint32
+}
+
+// Subkeys returns the key's immediate subkeys
+func (k *Key) Subkeys() ([]*Key, error) {
+	if k.nSub == 0 {
+		return nil, nil
+	}
+
+	offsets, err := k.h.subkeyOffsets(k.subkeys, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*Key, 0, len(offsets))
+	for _, off := range offsets {
+		sub, err := k.h.key(off)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, sub)
+	}
+	return keys, nil
+}
+
+// ReadSubKeyNames returns the names of the key's immediate subkeys
+func (k *Key) ReadSubKeyNames() ([]string, error) {
+	keys, err := k.Subkeys()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(keys))
+	for i, sub := range keys {
+		names[i] = sub.Name
+	}
+	return names, nil
+}
+
+// OpenKey opens the backslash-separated path below k. Names are matched
+// case-insensitively, as Windows does.
+func (k *Key) OpenKey(path string) (*Key, error) {
+	key := k
+	for _, part := range strings.Split(path, `\`) {
+		if part == "" {
+			continue
+		}
+
+		subkeys, err := key.Subkeys()
+		if err != nil {
+			return nil, err
+		}
+
+		var next *Key
+		for _, sub := range subkeys {
+			if strings.EqualFold(sub.Name, part) {
+				next = sub
+				break
+			}
+		}
+		if next == nil {
+			return nil, fmt.Errorf("%s: %w", path, ErrNotExist)
+		}
+		key = next
+	}
+	return key, nil
+}
+
+// Value is a named, typed registry value
+type Value struct {
+	Name string
+	Type uint32
+	Data []byte
+}
+
+// Values returns every value stored in the key
+func (k *Key) Values() ([]*Value, error) {
+	if k.nValues == 0 {
+		return nil, nil
+	}
+	if k.nValues > maxListLength {
+		return nil, fmt.Errorf("value list of %s is too long", k.Name)
+	}
+
+	list, err := k.h.cell(k.values)
+	if err != nil {
+		return nil, err
+	}
+	if int(k.nValues)*4 > len(list) {
+		return nil, fmt.Errorf("value list of %s is truncated", k.Name)
+	}
+
+	values := make([]*Value, 0, k.nValues)
+	for i := range int(k.nValues) {
+		val, err := k.h.value(binary.LittleEndian.Uint32(list[i*4:]))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, val)
+	}
+	return values, nil
+}
+
+// ReadValueNames returns the names of the key's values
+func (k *Key) ReadValueNames() ([]string, error) {
+	values, err := k.Values()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(values))
+	for i, val := range values {
+		names[i] = val.Name
+	}
+	return names, nil
+}
+
+// Value returns the value called name, matched case-insensitively. The
+// empty name is the key's default value.
+func (k *Key) Value(name string) (*Value, error) {
+	values, err := k.Values()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, val := range values {
+		if strings.EqualFold(val.Name, name) {
+			return val, nil
+		}
+	}
+	return nil, fmt.Errorf("%s\\%s: %w", k.Name, name, ErrNotExist)
+}
+
+// GetStringValue returns the string value called name along with its type.
+// Like the registry package, it doesn't expand environment variables.
+func (k *Key) GetStringValue(name string) (string, uint32, error) {
+	val, err := k.Value(name)
+	if err != nil {
+		return "", 0, err
+	}
+
+	switch val.Type {
+	case SZ, EXPAND_SZ, LINK:
+		return decodeUTF16(val.Data), val.Type, nil
+	default:
+		return "", val.Type, ErrUnexpectedType
+	}
+}
+
+// GetStringsValue returns the MULTI_SZ value called name along with its type
+func (k *Key) GetStringsValue(name string) ([]string, uint32, error) {
+	val, err := k.Value(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	if val.Type != MULTI_SZ {
+		return nil, val.Type, ErrUnexpectedType
+	}
+
+	strs := make([]string, 0)
+	for _, s := range strings.Split(decodeUTF16(val.Data), "\x00") {
+		if s != "" {
+			strs = append(strs, s)
+		}
+	}
+	return strs, val.Type, nil
+}
+
+// GetIntegerValue returns the DWORD or QWORD value called name along with
+// its type
+func (k *Key) GetIntegerValue(name string) (uint64, uint32, error) {
+	val, err := k.Value(name)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	switch {
+	case val.Type == DWORD && len(val.Data) >= 4:
+		return uint64(binary.LittleEndian.Uint32(val.Data)), val.Type, nil
+	case val.Type == DWORD_BIG_ENDIAN && len(val.Data) >= 4:
+		return uint64(binary.BigEndian.Uint32(val.Data)), val.Type, nil
+	case val.Type == QWORD && len(val.Data) >= 8:
+		return binary.LittleEndian.Uint64(val.Data), val.Type, nil
+	default:
+		return 0, val.Type, ErrUnexpectedType
+	}
+}
+
+// GetBinaryValue returns the raw bytes of the value called name along with
+// its type
+func (k *Key) GetBinaryValue(name string) ([]byte, uint32, error) {
+	val, err := k.Value(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	return val.Data, val.Type, nil
+}
+
+func (h *Hive) value(offset uint32) (*Value, error) {
+	vk, err := h.cell(offset)
+	if err != nil {
+		return nil, err
+	}
+	if len(vk) < 0x14 || !bytes.Equal(vk[:2], []byte("vk")) {
+		return nil, fmt.Errorf("cell at %#x is not a value", offset)
+	}
+
+	nameLen := int(binary.LittleEndian.Uint16(vk[0x02:]))
+	size := binary.LittleEndian.Uint32(vk[0x04:])
+	dataOffset := binary.LittleEndian.Uint32(vk[0x08:])
+	flags := binary.LittleEndian.Uint16(vk[0x10:])
+	if 0x14+nameLen > len(vk) {
+		return nil, fmt.Errorf("value name at %#x is truncated", offset)
+	}
+
+	val := &Value{
+		Name: decodeName(vk[0x14:0x14+nameLen], flags&valueCompName != 0),
+		Type: binary.LittleEndian.Uint32(vk[0x0c:]),
+	}
+
+	switch {
+	case size&inlineData != 0:
+		size &^= inlineData
+		if size > 4 {
+			return nil, fmt.Errorf("inline data at %#x is too large", offset)
+		}
+		val.Data = vk[0x08 : 0x08+size]
+
+	case size == 0:
+		val.Data = []byte{}
+
+	case size > bigDataLimit && h.minor >= 4:
+		val.Data, err = h.bigData(dataOffset, size)
+
+	default:
+		var data []byte
+		data, err = h.cell(dataOffset)
+		if err == nil && int(size) > len(data) {
+			err = fmt.Errorf("value data at %#x is truncated", dataOffset)
+		}
+		if err == nil {
+			val.Data = data[:size]
+		}
+	}
+	return val, err
+}
+
+// bigData reassembles a value split across the segments of a "db" record
+func (h *Hive) bigData(offset, size uint32) ([]byte, error) {
+	db, err := h.cell(offset)
+	if err != nil {
+		return nil, err
+	}
+	if len(db) < 8 || !bytes.Equal(db[:2], []byte("db")) {
+		return nil, fmt.Errorf("cell at %#x is not a big data record", offset)
+	}
+
+	count := int(binary.LittleEndian.Uint16(db[2:]))
+	list, err := h.cell(binary.LittleEndian.Uint32(db[4:]))
+	if err != nil {
+		return nil, err
+	}
+	if count*4 > len(list) {
+		return nil, fmt.Errorf("big data segment list at %#x is truncated", offset)
+	}
+	// the length comes from the vk record, so check it against what the
+	// segments can hold before trusting it
+	if size > uint32(count)*bigDataLimit {
+		return nil, fmt.Errorf("big data at %#x is larger than its %d segments", offset, count)
+	}
+
+	var data []byte
+	for i := range count {
+		segment, err := h.cell(binary.LittleEndian.Uint32(list[i*4:]))
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, segment[:min(len(segment), bigDataLimit)]...)
+	}
+
+	if uint32(len(data)) < size {
+		return nil, fmt.Errorf("big data at %#x is truncated", offset)
+	}
+	return data[:size], nil
+}
+
+func decodeName(raw []byte, compressed bool) string {
+	if !compressed {
+		return decodeUTF16(raw)
+	}
+
+	// latin-1 maps directly onto the first 256 code points
+	runes := make([]rune, len(raw))
+	for i, b := range raw {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+func decodeUTF16(raw []byte) string {
+	u16 := make([]uint16, len(raw)/2)
+	for i := range u16 {
+		u16[i] = binary.LittleEndian.Uint16(raw[i*2:])
+	}
+	return strings.TrimRight(string(utf16.Decode(u16)), "\x00")
+}
@@ -0,0 +1,166 @@
+package hive_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/audibleblink/lpegopher/hive"
+	"github.com/audibleblink/lpegopher/hive/hivetest"
+)
+
+func buildTestHive() []byte {
+	b := hivetest.New()
+
+	svc := b.Key("Spooler", nil, []uint32{
+		b.Value("ImagePath", hive.EXPAND_SZ, hivetest.SZ(`%SystemRoot%\System32\spoolsv.exe`)),
+		b.Value("ObjectName", hive.SZ, hivetest.SZ("LocalSystem")),
+		b.Value("Start", hive.DWORD, hivetest.DWORD(2)),
+		b.Value("DependOnService", hive.MULTI_SZ, hivetest.SZ("RPCSS", "http")),
+	})
+	services := b.Key("Services", []uint32{svc}, nil)
+	controlSet := b.Key("ControlSet001", []uint32{services}, nil)
+	sel := b.Key("Select", nil, []uint32{b.Value("Current", hive.DWORD, hivetest.DWORD(1))})
+	root := b.Key("ROOT", []uint32{controlSet, sel}, nil)
+
+	return b.Bytes(root)
+}
+
+func TestNewRejectsNonHives(t *testing.T) {
+	_, err := hive.New(bytes.NewReader(make([]byte, 0x1000)))
+	if err == nil {
+		t.Error("Expected an error for data without a regf signature")
+	}
+}
+
+func TestOpenKey(t *testing.T) {
+	h, err := hive.New(bytes.NewReader(buildTestHive()))
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	t.Run("Paths are matched case-insensitively", func(t *testing.T) {
+		key, err := h.OpenKey(`controlset001\SERVICES\spooler`)
+		if err != nil {
+			t.Fatalf("OpenKey returned error: %v", err)
+		}
+		if key.Name != "Spooler" {
+			t.Errorf("Expected key name Spooler, got %s", key.Name)
+		}
+	})
+
+	t.Run("Missing keys return ErrNotExist", func(t *testing.T) {
+		_, err := h.OpenKey(`ControlSet002\Services`)
+		if !errors.Is(err, hive.ErrNotExist) {
+			t.Errorf("Expected ErrNotExist, got %v", err)
+		}
+	})
+
+	t.Run("Subkey names are listed", func(t *testing.T) {
+		root, _ := h.Root()
+		names, err := root.ReadSubKeyNames()
+		if err != nil {
+			t.Fatalf("ReadSubKeyNames returned error: %v", err)
+		}
+		if len(names) != 2 || names[0] != "ControlSet001" || names[1] != "Select" {
+			t.Errorf("Unexpected subkey names %v", names)
+		}
+	})
+}
+
+func TestGetValues(t *testing.T) {
+	h, _ := hive.New(bytes.NewReader(buildTestHive()))
+	key, err := h.OpenKey(`ControlSet001\Services\Spooler`)
+	if err != nil {
+		t.Fatalf("OpenKey returned error: %v", err)
+	}
+
+	t.Run("String values", func(t *testing.T) {
+		val, typ, err := key.GetStringValue("imagepath")
+		if err != nil {
+			t.Fatalf("GetStringValue returned error: %v", err)
+		}
+		if val != `%SystemRoot%\System32\spoolsv.exe` || typ != hive.EXPAND_SZ {
+			t.Errorf("Unexpected value %q of type %d", val, typ)
+		}
+	})
+
+	t.Run("Integer values stored inline", func(t *testing.T) {
+		val, typ, err := key.GetIntegerValue("Start")
+		if err != nil {
+			t.Fatalf("GetIntegerValue returned error: %v", err)
+		}
+		if val != 2 || typ != hive.DWORD {
+			t.Errorf("Unexpected value %d of type %d", val, typ)
+		}
+	})
+
+	t.Run("Multi-string values", func(t *testing.T) {
+		vals, _, err := key.GetStringsValue("DependOnService")
+		if err != nil {
+			t.Fatalf("GetStringsValue returned error: %v", err)
+		}
+		if len(vals) != 2 || vals[0] != "RPCSS" || vals[1] != "http" {
+			t.Errorf("Unexpected values %v", vals)
+		}
+	})
+
+	t.Run("Type mismatches are reported", func(t *testing.T) {
+		_, _, err := key.GetIntegerValue("ObjectName")
+		if !errors.Is(err, hive.ErrUnexpectedType) {
+			t.Errorf("Expected ErrUnexpectedType, got %v", err)
+		}
+	})
+
+	t.Run("Value names are listed", func(t *testing.T) {
+		names, err := key.ReadValueNames()
+		if err != nil {
+			t.Fatalf("ReadValueNames returned error: %v", err)
+		}
+		if len(names) != 4 {
+			t.Errorf("Expected 4 value names, got %v", names)
+		}
+	})
+}
+
+func TestBigData(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 2048)
+
+	build := func(size uint32) *hive.Key {
+		t.Helper()
+		b := hivetest.New()
+		val := b.BigValue("Blob", hive.BINARY, data)
+		root := b.Key("ROOT", nil, []uint32{val})
+		image := b.Bytes(root)
+		// the vk length sits after the hbin-relative cell size and signature
+		binary.LittleEndian.PutUint32(image[0x1000+val+4+4:], size)
+
+		h, err := hive.New(bytes.NewReader(image))
+		if err != nil {
+			t.Fatalf("New returned error: %v", err)
+		}
+		key, err := h.Root()
+		if err != nil {
+			t.Fatalf("Root returned error: %v", err)
+		}
+		return key
+	}
+
+	t.Run("Segments are reassembled", func(t *testing.T) {
+		val, typ, err := build(uint32(len(data))).GetBinaryValue("Blob")
+		if err != nil {
+			t.Fatalf("GetBinaryValue returned error: %v", err)
+		}
+		if !bytes.Equal(val, data) || typ != hive.BINARY {
+			t.Errorf("Expected %d bytes of data, got %d of type %d", len(data), len(val), typ)
+		}
+	})
+
+	t.Run("Lengths beyond the segments are rejected", func(t *testing.T) {
+		_, _, err := build(0x7fffffff).GetBinaryValue("Blob")
+		if err == nil {
+			t.Error("Expected an error for a length the segments can't hold")
+		}
+	})
+}
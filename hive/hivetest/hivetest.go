@@ -0,0 +1,151 @@
+// Package hivetest assembles small registry hives in memory for tests of
+// code that reads offline hives.
+package hivetest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"unicode/utf16"
+)
+
+// Builder appends key and value cells to a single hbin. Cells are
+// addressed by their offset from the start of the hbin, as in a real hive.
+type Builder struct {
+	bin []byte
+}
+
+// New returns an empty Builder
+func New() *Builder {
+	bin := make([]byte, 0x20)
+	copy(bin, "hbin")
+	return &Builder{bin: bin}
+}
+
+func (b *Builder) cell(data []byte) uint32 {
+	offset := uint32(len(b.bin))
+	size := (len(data) + 4 + 7) &^ 7
+	cell := make([]byte, size)
+	binary.LittleEndian.PutUint32(cell, uint32(-int32(size)))
+	copy(cell[4:], data)
+	b.bin = append(b.bin, cell...)
+	return offset
+}
+
+// Key adds a key with the given subkeys and values and returns its offset
+func (b *Builder) Key(name string, subkeys []uint32, values []uint32) uint32 {
+	nk := make([]byte, 0x4c+len(name))
+	copy(nk, "nk")
+	binary.LittleEndian.PutUint16(nk[0x02:], 0x0020)
+	binary.LittleEndian.PutUint32(nk[0x1c:], 0xffffffff)
+	binary.LittleEndian.PutUint32(nk[0x28:], 0xffffffff)
+
+	if len(subkeys) > 0 {
+		lf := make([]byte, 4+8*len(subkeys))
+		copy(lf, "lf")
+		binary.LittleEndian.PutUint16(lf[2:], uint16(len(subkeys)))
+		for i, off := range subkeys {
+			binary.LittleEndian.PutUint32(lf[4+i*8:], off)
+		}
+		binary.LittleEndian.PutUint32(nk[0x14:], uint32(len(subkeys)))
+		binary.LittleEndian.PutUint32(nk[0x1c:], b.cell(lf))
+	}
+
+	if len(values) > 0 {
+		list := make([]byte, 4*len(values))
+		for i, off := range values {
+			binary.LittleEndian.PutUint32(list[i*4:], off)
+		}
+		binary.LittleEndian.PutUint32(nk[0x24:], uint32(len(values)))
+		binary.LittleEndian.PutUint32(nk[0x28:], b.cell(list))
+	}
+
+	binary.LittleEndian.PutUint16(nk[0x48:], uint16(len(name)))
+	copy(nk[0x4c:], name)
+	return b.cell(nk)
+}
+
+// Value adds a value of type typ holding data and returns its offset
+func (b *Builder) Value(name string, typ uint32, data []byte) uint32 {
+	vk := make([]byte, 0x14+len(name))
+	copy(vk, "vk")
+	binary.LittleEndian.PutUint16(vk[0x02:], uint16(len(name)))
+	binary.LittleEndian.PutUint32(vk[0x0c:], typ)
+	binary.LittleEndian.PutUint16(vk[0x10:], 0x0001)
+	copy(vk[0x14:], name)
+
+	if len(data) <= 4 {
+		binary.LittleEndian.PutUint32(vk[0x04:], uint32(len(data))|0x80000000)
+		copy(vk[0x08:], data)
+	} else {
+		binary.LittleEndian.PutUint32(vk[0x04:], uint32(len(data)))
+		binary.LittleEndian.PutUint32(vk[0x08:], b.cell(data))
+	}
+	return b.cell(vk)
+}
+
+// BigValue adds a value whose data is split across the segments of a "db"
+// record, the layout newer hives use for data over 16344 bytes
+func (b *Builder) BigValue(name string, typ uint32, data []byte) uint32 {
+	const segmentSize = 16344
+
+	var list []byte
+	for start := 0; start < len(data); start += segmentSize {
+		segment := data[start:min(start+segmentSize, len(data))]
+		list = binary.LittleEndian.AppendUint32(list, b.cell(segment))
+	}
+	db := make([]byte, 8)
+	copy(db, "db")
+	binary.LittleEndian.PutUint16(db[2:], uint16(len(list)/4))
+	binary.LittleEndian.PutUint32(db[4:], b.cell(list))
+
+	vk := make([]byte, 0x14+len(name))
+	copy(vk, "vk")
+	binary.LittleEndian.PutUint16(vk[0x02:], uint16(len(name)))
+	binary.LittleEndian.PutUint32(vk[0x04:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(vk[0x08:], b.cell(db))
+	binary.LittleEndian.PutUint32(vk[0x0c:], typ)
+	binary.LittleEndian.PutUint16(vk[0x10:], 0x0001)
+	copy(vk[0x14:], name)
+	return b.cell(vk)
+}
+
+// Bytes returns the hive image with root as its root key
+func (b *Builder) Bytes(root uint32) []byte {
+	base := make([]byte, 0x1000)
+	copy(base, "regf")
+	binary.LittleEndian.PutUint32(base[0x14:], 1)
+	binary.LittleEndian.PutUint32(base[0x18:], 5)
+	binary.LittleEndian.PutUint32(base[0x24:], root)
+	binary.LittleEndian.PutUint32(b.bin[8:], uint32(len(b.bin)))
+	return append(base, b.bin...)
+}
+
+// WriteFile writes the hive image to path, creating parent directories
+func (b *Builder) WriteFile(path string, root uint32) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b.Bytes(root), 0644)
+}
+
+// SZ encodes strs as consecutive NUL-terminated UTF-16 strings, the layout
+// of SZ, EXPAND_SZ and MULTI_SZ data
+func SZ(strs ...string) []byte {
+	var buf bytes.Buffer
+	for _, s := range strs {
+		for _, u := range utf16.Encode([]rune(s)) {
+			binary.Write(&buf, binary.LittleEndian, u)
+		}
+		buf.Write([]byte{0, 0})
+	}
+	return buf.Bytes()
+}
+
+// DWORD encodes n as DWORD data
+func DWORD(n uint32) []byte {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, n)
+	return data
+}
@@ -35,6 +35,8 @@ const (
 	Principal = "Principal" // Security principal
 	Dep       = "Dep"       // Dependency
 	INode     = "INode"     // Base node type for files and directories
+	Candidate = "Candidate" // Path run in place of an unquoted runner's exe
+	Script    = "Script"    // Script a runner's interpreter runs
 )
 
 // Relationship type constants
@@ -46,22 +48,65 @@ const (
 	RunsAs      = "RUNS_AS"       // Runner runs as a principal
 	ExecutedBy  = "EXECUTED_BY"   // Executable is executed by a runner
 	ImportedBy  = "IMPORTED_BY"   // Dependency is imported by a node
+	ResolvesTo  = "RESOLVES_TO"   // Exe's import loads from a Dll
+	PlantableIn = "PLANTABLE_IN"  // Exe's import would load from a copy planted in a directory
+	ElevatedBy  = "ELEVATED_BY"   // DLL planted in a directory loads in an autoElevate Exe, skipping UAC
+	ForwardsTo  = "FORWARDS_TO"   // Dll export is forwarded to a function of another DLL
 )
 
 // Basic property name constants for nodes
 var Prop = struct {
-	Name     string
-	Dir      string
-	Parent   string
-	Path     string
-	Type     string
-	Args     string
-	Exe      string
-	Context  string
-	Nid      string
-	Owner    string
-	Group    string
-	RunLevel string
+	Name           string
+	Dir            string
+	Parent         string
+	Path           string
+	Type           string
+	Args           string
+	Exe            string
+	Context        string
+	Nid            string
+	Owner          string
+	Group          string
+	RunLevel       string
+	Start          string
+	Payload        string
+	Host           string
+	Exports        string
+	Ordinals       string
+	Missing        string
+	Kind           string
+	Machine        string
+	Subsystem      string
+	Timestamp      string
+	ASLR           string
+	DEP            string
+	CFG            string
+	HEVA           string
+	DotNet         string
+	Company        string
+	Product        string
+	Version        string
+	OriginalName   string
+	Signed         string
+	Signer         string
+	Issuer         string
+	Thumbprint     string
+	HashMatches    string
+	Verified       string
+	Catalog        string
+	AutoElevate    string
+	ExecutionLevel string
+	UIAccess       string
+	Assemblies     string
+	DotLocal       string
+	SHA256         string
+	ImpHash        string
+	PEKind         string
+	PrivatePaths   string
+	ParseError     string
+	Tags           string
+	Capabilities   string
+	ExportsParsed  string
 }{
 	"name",
 	"dir",
@@ -75,6 +120,45 @@ var Prop = struct {
 	"owner",
 	"group",
 	"runlevel",
+	"start",
+	"payload",
+	"host",
+	"exports",
+	"ordinals",
+	"missing",
+	"kind",
+	"machine",
+	"subsystem",
+	"timestamp",
+	"aslr",
+	"dep",
+	"cfg",
+	"heva",
+	"dotnet",
+	"company",
+	"product",
+	"version",
+	"original_name",
+	"signed",
+	"signer",
+	"issuer",
+	"thumbprint",
+	"hash_matches",
+	"verified",
+	"catalog",
+	"auto_elevate",
+	"execution_level",
+	"ui_access",
+	"assemblies",
+	"dot_local",
+	"sha256",
+	"imphash",
+	"pe_kind",
+	"private_paths",
+	"parse_error",
+	"tags",
+	"capabilities",
+	"exports_parsed",
 }
 
 // Node schema index and constraint definitions
@@ -96,6 +180,8 @@ var Schema = struct {
 		Exe:       Prop.Path,
 		Dll:       Prop.Path,
 		Dir:       Prop.Path,
+		Candidate: Prop.Path,
+		Script:    Prop.Path,
 	},
 	BTREEIndices: map[string][]string{
 		INode: {
@@ -105,9 +191,15 @@ var Schema = struct {
 		},
 		Exe: {
 			Prop.Parent,
+			Prop.SHA256,
+			Prop.ImpHash,
+			Prop.PEKind,
 		},
 		Dll: {
 			Prop.Parent,
+			Prop.SHA256,
+			Prop.ImpHash,
+			Prop.PEKind,
 		},
 		Dir: {
 			Prop.Parent,
@@ -116,10 +208,17 @@ var Schema = struct {
 			Prop.Parent,
 			Prop.Exe,
 			Prop.Context,
+			Prop.Payload,
 		},
 		Principal: {
 			Prop.Name,
 		},
+		Candidate: {
+			Prop.Parent,
+		},
+		Script: {
+			Prop.Parent,
+		},
 	},
 	UniqueConstraintTemplate: "CREATE CONSTRAINT ON (a:%s) ASSERT a.%s IS UNIQUE;",
 	BTREEIndexTemplate:       "CREATE BTREE INDEX FOR (n:%s) ON (n.%s)",
@@ -131,6 +230,7 @@ var PropMaps = struct {
 	Principal []string
 	Runner    []string
 	Dep       []string
+	Candidate []string
 }{
 	INode: []string{
 		Prop.Nid,
@@ -154,10 +254,19 @@ var PropMaps = struct {
 		Prop.Parent,
 		Prop.Context,
 		Prop.RunLevel,
+		Prop.Start,
+		Prop.Args,
+		Prop.Payload,
 	},
 	Dep: []string{
 		Prop.Nid,
 		Prop.Name,
+		Prop.Host,
+	},
+	Candidate: []string{
+		Prop.Path,
+		Prop.Name,
+		Prop.Parent,
 	},
 }
 
@@ -170,6 +279,8 @@ var CypherTemplates = struct {
 	CreateDep       string
 	CreatePrincipal string
 	CreateRunner    string
+	CreateCandidate string
+	CreateScript    string
 	// Relationship creation templates
 	RelateFileTree        string
 	RelateOwnership       string
@@ -177,7 +288,13 @@ var CypherTemplates = struct {
 	RelateRunnerDir       string
 	RelateRunnerPrincipal string
 	RelateRunnerExe       string
+	RelateRunnerPayload   string
 	RelateDependency      string
+	RelateSearchOrder     string
+	RelateAutoElevation   string
+	RelateForwards        string
+	// Post-processing templates
+	FlagMissingExports string
 }{
 	CreateExe: `LOAD CSV FROM '%s/exes.csv' AS line
 		WITH line
@@ -187,7 +304,38 @@ var CypherTemplates = struct {
 			path: line[2],
 			parent: line[3],
 			owner: line[4],
-			group: line[5] })`,
+			group: line[5],
+			machine: line[8],
+			subsystem: line[9],
+			timestamp: toInteger(line[10]),
+			aslr: toBoolean(line[11]),
+			dep: toBoolean(line[12]),
+			cfg: toBoolean(line[13]),
+			heva: toBoolean(line[14]),
+			dotnet: toBoolean(line[15]),
+			company: line[16],
+			product: line[17],
+			version: line[18],
+			original_name: line[19],
+			signed: toBoolean(line[20]),
+			signer: line[21],
+			issuer: line[22],
+			thumbprint: line[23],
+			hash_matches: toBoolean(line[24]),
+			verified: toBoolean(line[25]),
+			catalog: line[26],
+			auto_elevate: toBoolean(line[27]),
+			execution_level: line[28],
+			ui_access: toBoolean(line[29]),
+			assemblies: split(line[30], ';'),
+			dot_local: line[31],
+			sha256: line[32],
+			imphash: line[33],
+			pe_kind: line[34],
+			private_paths: split(line[35], ';'),
+			parse_error: line[36],
+			tags: split(line[37], ';'),
+			capabilities: split(line[38], ';') })`,
 
 	CreateDll: `LOAD CSV FROM '%s/dlls.csv' AS line
 		WITH line
@@ -197,7 +345,35 @@ var CypherTemplates = struct {
 			path: line[2],
 			parent: line[3],
 			owner: line[4],
-			group: line[5] })`,
+			group: line[5],
+			exports: split(line[6], ';'),
+			ordinals: [o IN split(line[7], ';') | toInteger(o)],
+			machine: line[8],
+			subsystem: line[9],
+			timestamp: toInteger(line[10]),
+			aslr: toBoolean(line[11]),
+			dep: toBoolean(line[12]),
+			cfg: toBoolean(line[13]),
+			heva: toBoolean(line[14]),
+			dotnet: toBoolean(line[15]),
+			company: line[16],
+			product: line[17],
+			version: line[18],
+			original_name: line[19],
+			signed: toBoolean(line[20]),
+			signer: line[21],
+			issuer: line[22],
+			thumbprint: line[23],
+			hash_matches: toBoolean(line[24]),
+			verified: toBoolean(line[25]),
+			catalog: line[26],
+			sha256: line[32],
+			imphash: line[33],
+			pe_kind: line[34],
+			parse_error: line[36],
+			tags: split(line[37], ';'),
+			capabilities: split(line[38], ';'),
+			exports_parsed: toBoolean(line[39]) })`,
 
 	CreateDir: `LOAD CSV FROM '%s/dirs.csv' AS line
 		WITH line
@@ -209,8 +385,18 @@ var CypherTemplates = struct {
 			owner: line[4],
 			group: line[5] })`,
 
+	CreateScript: `LOAD CSV FROM '%s/scripts.csv' AS line
+		WITH line
+		CREATE (:Script:INode {
+			nid: line[0], 
+			name: line[1],
+			path: line[2],
+			parent: line[3],
+			owner: line[4],
+			group: line[5] })`,
+
 	CreateDep: `LOAD CSV FROM '%s/deps.csv' AS line
-		WITH line CREATE (:Dep {nid: line[0], name: line[1]})`,
+		WITH line CREATE (:Dep {nid: line[0], name: line[1], host: line[2]})`,
 
 	CreatePrincipal: `LOAD CSV FROM '%s/principals.csv' AS line
 		WITH line CREATE (:Principal {nid: line[0], name: line[1], group: line[2]})`,
@@ -225,7 +411,18 @@ var CypherTemplates = struct {
 			exe: line[4],
 			parent: line[5],
 			context: line[6],
-			runlevel: line[7]})`,
+			runlevel: line[7],
+			start: line[8],
+			args: line[9],
+			payload: line[10]})`,
+
+	CreateCandidate: `LOAD CSV FROM '%s/candidates.csv' AS line
+		WITH line
+		MERGE (c:Candidate {path: line[1]})
+			ON CREATE SET c.name = line[2], c.parent = line[3]
+		WITH c, line
+		MATCH (r:Runner {nid: line[0]})
+		MERGE (c)-[:EXECUTED_BY]->(r)`,
 
 	RelateFileTree: `
 		CALL apoc.periodic.iterate(
@@ -275,13 +472,59 @@ var CypherTemplates = struct {
 			{batchSize:100})
 		`,
 
+	RelateRunnerPayload: `
+		CALL apoc.periodic.iterate(
+			"MATCH (r:Runner),(payload:%s) WHERE r.payload = payload.path RETURN r,payload",
+			"MERGE (payload)-[:EXECUTED_BY]->(r)",
+			{batchSize:100})
+		`,
+
 	RelateDependency: `CALL apoc.periodic.iterate("
 			LOAD CSV FROM '%s/imports.csv' AS line RETURN line
 		","
 			MATCH (a:INode {nid: line[0]}), (b:Dep {nid: line[2]})
-			MERGE (b)-[:IMPORTED_BY]->(a)
+			MERGE (b)-[i:IMPORTED_BY {kind: line[4]}]->(a)
+			SET i.fn = split(line[3], ';')
+		", {batchSize: 20000});
+		`,
+
+	RelateSearchOrder: `CALL apoc.periodic.iterate("
+			LOAD CSV FROM '%s/resolutions.csv' AS line RETURN line
+		","
+			MATCH (a:INode {nid: line[0]}), (b:INode {nid: line[2]})
+			CALL apoc.create.relationship(a, line[1], {dll: line[3]}, b) YIELD rel RETURN rel
+		", {batchSize: 20000});
+		`,
+
+	RelateAutoElevation: `
+		CALL apoc.periodic.iterate(
+			"MATCH (exe:Exe {auto_elevate: true})-[p:PLANTABLE_IN]->(dir:Directory) RETURN exe, p, dir",
+			"MERGE (dir)-[:ELEVATED_BY {dll: p.dll}]->(exe)",
+			{batchSize:1000})
+		`,
+
+	RelateForwards: `CALL apoc.periodic.iterate("
+			LOAD CSV FROM '%s/forwards.csv' AS line RETURN line
+		","
+			MATCH (a:Dll {nid: line[0]}), (b:Dep {nid: line[2]})
+			MERGE (a)-[:FORWARDS_TO {fn: line[4], target: line[5]}]->(b)
+			WITH a, line WHERE line[3] IS NOT NULL
+			MATCH (c:Dll {nid: line[3]})
+			MERGE (a)-[:FORWARDS_TO {fn: line[4], target: line[5]}]->(c)
 		", {batchSize: 20000});
 		`,
+
+	FlagMissingExports: `
+		CALL apoc.periodic.iterate(
+			"MATCH (d:Dep)-[i:IMPORTED_BY]->(exe:Exe)-[r:RESOLVES_TO]->(dll:Dll)
+			WHERE r.dll = d.name AND dll.exports_parsed
+			RETURN r, dll, apoc.coll.toSet(apoc.coll.flatten(collect(coalesce(i.fn, [])))) AS fns",
+			"WITH r, [fn IN fns WHERE NOT fn IN coalesce(dll.exports, []) AND
+				NOT (fn STARTS WITH '#' AND toInteger(substring(fn, 1)) IN coalesce(dll.ordinals, []))] AS missing
+			WHERE size(missing) > 0
+			SET r.missing = missing",
+			{batchSize:1000})
+		`,
 }
 
 // NodeSchema represents a Neo4j graph schema for nodes
@@ -372,6 +615,10 @@ func GetTemplateForNodeType(nodeType string) (string, error) {
 		return CypherTemplates.CreatePrincipal, nil
 	case Runner:
 		return CypherTemplates.CreateRunner, nil
+	case Candidate:
+		return CypherTemplates.CreateCandidate, nil
+	case Script:
+		return CypherTemplates.CreateScript, nil
 	default:
 		return "", fmt.Errorf("no template available for node type: %s", nodeType)
 	}
@@ -394,6 +641,12 @@ func GetRelationshipTemplate(relType string) (string, error) {
 		return CypherTemplates.RelateRunnerExe, nil
 	case ImportedBy:
 		return CypherTemplates.RelateDependency, nil
+	case ResolvesTo, PlantableIn:
+		return CypherTemplates.RelateSearchOrder, nil
+	case ElevatedBy:
+		return CypherTemplates.RelateAutoElevation, nil
+	case ForwardsTo:
+		return CypherTemplates.RelateForwards, nil
 	default:
 		return "", fmt.Errorf("no template available for relationship type: %s", relType)
 	}
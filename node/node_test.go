@@ -18,6 +18,8 @@ func TestNodeConstants(t *testing.T) {
 		"Principal": Principal,
 		"Dep":       Dep,
 		"INode":     INode,
+		"Candidate": Candidate,
+		"Script":    Script,
 	}
 
 	for expected, actual := range nodeTypes {
@@ -37,6 +39,10 @@ func TestRelationshipConstants(t *testing.T) {
 		"RUNS_AS":       RunsAs,
 		"EXECUTED_BY":   ExecutedBy,
 		"IMPORTED_BY":   ImportedBy,
+		"RESOLVES_TO":   ResolvesTo,
+		"PLANTABLE_IN":  PlantableIn,
+		"ELEVATED_BY":   ElevatedBy,
+		"FORWARDS_TO":   ForwardsTo,
 	}
 
 	for expected, actual := range relTypes {
@@ -54,18 +60,57 @@ func TestRelationshipConstants(t *testing.T) {
 func TestPropStructValues(t *testing.T) {
 	// Test property name constants
 	propTests := map[string]string{
-		"name":     Prop.Name,
-		"dir":      Prop.Dir,
-		"parent":   Prop.Parent,
-		"path":     Prop.Path,
-		"type":     Prop.Type,
-		"args":     Prop.Args,
-		"exe":      Prop.Exe,
-		"context":  Prop.Context,
-		"nid":      Prop.Nid,
-		"owner":    Prop.Owner,
-		"group":    Prop.Group,
-		"runlevel": Prop.RunLevel,
+		"name":            Prop.Name,
+		"dir":             Prop.Dir,
+		"parent":          Prop.Parent,
+		"path":            Prop.Path,
+		"type":            Prop.Type,
+		"args":            Prop.Args,
+		"exe":             Prop.Exe,
+		"context":         Prop.Context,
+		"nid":             Prop.Nid,
+		"owner":           Prop.Owner,
+		"group":           Prop.Group,
+		"runlevel":        Prop.RunLevel,
+		"start":           Prop.Start,
+		"payload":         Prop.Payload,
+		"host":            Prop.Host,
+		"exports":         Prop.Exports,
+		"ordinals":        Prop.Ordinals,
+		"missing":         Prop.Missing,
+		"kind":            Prop.Kind,
+		"machine":         Prop.Machine,
+		"subsystem":       Prop.Subsystem,
+		"timestamp":       Prop.Timestamp,
+		"aslr":            Prop.ASLR,
+		"dep":             Prop.DEP,
+		"cfg":             Prop.CFG,
+		"heva":            Prop.HEVA,
+		"dotnet":          Prop.DotNet,
+		"company":         Prop.Company,
+		"product":         Prop.Product,
+		"version":         Prop.Version,
+		"original_name":   Prop.OriginalName,
+		"signed":          Prop.Signed,
+		"signer":          Prop.Signer,
+		"issuer":          Prop.Issuer,
+		"thumbprint":      Prop.Thumbprint,
+		"hash_matches":    Prop.HashMatches,
+		"verified":        Prop.Verified,
+		"catalog":         Prop.Catalog,
+		"auto_elevate":    Prop.AutoElevate,
+		"execution_level": Prop.ExecutionLevel,
+		"ui_access":       Prop.UIAccess,
+		"assemblies":      Prop.Assemblies,
+		"dot_local":       Prop.DotLocal,
+		"sha256":          Prop.SHA256,
+		"imphash":         Prop.ImpHash,
+		"pe_kind":         Prop.PEKind,
+		"private_paths":   Prop.PrivatePaths,
+		"parse_error":     Prop.ParseError,
+		"tags":            Prop.Tags,
+		"capabilities":    Prop.Capabilities,
+		"exports_parsed":  Prop.ExportsParsed,
 	}
 
 	for expected, actual := range propTests {
@@ -122,6 +167,8 @@ func TestSchemaDefinition(t *testing.T) {
 		Exe:       Prop.Path,
 		Dll:       Prop.Path,
 		Dir:       Prop.Path,
+		Candidate: Prop.Path,
+		Script:    Prop.Path,
 	}
 
 	for nodeType, prop := range expectedUniqueConstraints {
@@ -143,11 +190,13 @@ func TestSchemaDefinition(t *testing.T) {
 	// Test BTREE indices
 	expectedBTreeIndices := map[string][]string{
 		INode:     {Prop.Owner, Prop.Group, Prop.Name},
-		Exe:       {Prop.Parent},
-		Dll:       {Prop.Parent},
+		Exe:       {Prop.Parent, Prop.SHA256, Prop.ImpHash, Prop.PEKind},
+		Dll:       {Prop.Parent, Prop.SHA256, Prop.ImpHash, Prop.PEKind},
 		Dir:       {Prop.Parent},
-		Runner:    {Prop.Parent, Prop.Exe, Prop.Context},
+		Runner:    {Prop.Parent, Prop.Exe, Prop.Context, Prop.Payload},
 		Principal: {Prop.Name},
+		Candidate: {Prop.Parent},
+		Script:    {Prop.Parent},
 	}
 
 	for nodeType, expectedProps := range expectedBTreeIndices {
@@ -193,8 +242,12 @@ func TestPropMaps(t *testing.T) {
 			Prop.Parent,
 			Prop.Context,
 			Prop.RunLevel,
+			Prop.Start,
+			Prop.Args,
+			Prop.Payload,
 		},
-		"Dep": {Prop.Nid, Prop.Name},
+		"Dep":       {Prop.Nid, Prop.Name, Prop.Host},
+		"Candidate": {Prop.Path, Prop.Name, Prop.Parent},
 	}
 
 	// Test INode properties
@@ -208,6 +261,9 @@ func TestPropMaps(t *testing.T) {
 
 	// Test Dep properties
 	testPropertyList(t, "Dep", PropMaps.Dep, expectedProps["Dep"])
+
+	// Test Candidate properties
+	testPropertyList(t, "Candidate", PropMaps.Candidate, expectedProps["Candidate"])
 }
 
 func testPropertyList(t *testing.T, nodeType string, actual, expected []string) {
@@ -243,6 +299,26 @@ func TestCypherTemplates(t *testing.T) {
 				"parent",
 				"owner",
 				"group",
+				"machine",
+				"aslr",
+				"dotnet",
+				"company",
+				"original_name",
+				"signed",
+				"thumbprint",
+				"verified",
+				"auto_elevate",
+				"execution_level",
+				"ui_access",
+				"assemblies",
+				"dot_local",
+				"sha256",
+				"imphash",
+				"pe_kind",
+				"private_paths",
+				"parse_error",
+				"tags",
+				"capabilities",
 			},
 		},
 		{
@@ -259,6 +335,23 @@ func TestCypherTemplates(t *testing.T) {
 				"parent",
 				"owner",
 				"group",
+				"exports",
+				"ordinals",
+				"machine",
+				"aslr",
+				"dotnet",
+				"company",
+				"original_name",
+				"signed",
+				"thumbprint",
+				"verified",
+				"sha256",
+				"imphash",
+				"pe_kind",
+				"parse_error",
+				"tags",
+				"capabilities",
+				"exports_parsed",
 			},
 		},
 		{
@@ -280,7 +373,7 @@ func TestCypherTemplates(t *testing.T) {
 		{
 			"CreateDep",
 			CypherTemplates.CreateDep,
-			[]string{"deps.csv", "CREATE", "Dep", "nid", "name"},
+			[]string{"deps.csv", "CREATE", "Dep", "nid", "name", "host"},
 		},
 		{
 			"CreatePrincipal",
@@ -302,8 +395,21 @@ func TestCypherTemplates(t *testing.T) {
 				"parent",
 				"context",
 				"runlevel",
+				"start",
+				"args",
+				"payload",
 			},
 		},
+		{
+			"CreateCandidate",
+			CypherTemplates.CreateCandidate,
+			[]string{"candidates.csv", "MERGE", "Candidate", "path", "Runner", "nid", "EXECUTED_BY"},
+		},
+		{
+			"CreateScript",
+			CypherTemplates.CreateScript,
+			[]string{"scripts.csv", "CREATE", "Script", "INode", "nid", "path", "parent", "owner"},
+		},
 		{
 			"RelateFileTree",
 			CypherTemplates.RelateFileTree,
@@ -334,10 +440,35 @@ func TestCypherTemplates(t *testing.T) {
 			CypherTemplates.RelateRunnerExe,
 			[]string{"MATCH", "Runner", "Exe", "parent", "exe", "path", "MERGE", "EXECUTED_BY"},
 		},
+		{
+			"RelateRunnerPayload",
+			CypherTemplates.RelateRunnerPayload,
+			[]string{"MATCH", "Runner", "payload", "path", "MERGE", "EXECUTED_BY"},
+		},
 		{
 			"RelateDependency",
 			CypherTemplates.RelateDependency,
-			[]string{"imports.csv", "MATCH", "INode", "Dep", "nid", "MERGE", "IMPORTED_BY"},
+			[]string{"imports.csv", "MATCH", "INode", "Dep", "nid", "MERGE", "IMPORTED_BY", "kind", "i.fn", "split"},
+		},
+		{
+			"RelateSearchOrder",
+			CypherTemplates.RelateSearchOrder,
+			[]string{"resolutions.csv", "MATCH", "INode", "nid", "apoc.create.relationship", "dll"},
+		},
+		{
+			"FlagMissingExports",
+			CypherTemplates.FlagMissingExports,
+			[]string{"IMPORTED_BY", "RESOLVES_TO", "exports_parsed", "collect(coalesce(i.fn, []))", "exports", "ordinals", "SET r.missing"},
+		},
+		{
+			"RelateAutoElevation",
+			CypherTemplates.RelateAutoElevation,
+			[]string{"auto_elevate: true", "PLANTABLE_IN", "MERGE (dir)-[:ELEVATED_BY {dll: p.dll}]->(exe)"},
+		},
+		{
+			"RelateForwards",
+			CypherTemplates.RelateForwards,
+			[]string{"forwards.csv", "Dll", "Dep", "FORWARDS_TO", "fn: line[4]", "target: line[5]", "line[3] IS NOT NULL"},
 		},
 	}
 
@@ -377,6 +508,8 @@ func TestGetTemplateForNodeType(t *testing.T) {
 		{Dep, false},
 		{Principal, false},
 		{Runner, false},
+		{Candidate, false},
+		{Script, false},
 		{"UnknownType", true},
 	}
 
@@ -414,6 +547,10 @@ func TestGetRelationshipTemplate(t *testing.T) {
 		{RunsAs, false},
 		{ExecutedBy, false},
 		{ImportedBy, false},
+		{ResolvesTo, false},
+		{PlantableIn, false},
+		{ElevatedBy, false},
+		{ForwardsTo, false},
 		{"UnknownRelationship", true},
 	}
 
@@ -60,7 +60,7 @@ func BulkRelateFileTree() (err error) {
 	log := logerr.Add("filetree relationships")
 	template, _ := node.GetRelationshipTemplate(node.Contains)
 
-	for _, typ := range []string{node.Dir, node.Exe, node.Dll} {
+	for _, typ := range []string{node.Dir, node.Exe, node.Dll, node.Candidate, node.Script} {
 		log.Debugf("relating all (:Dir)-[:%s]-(:%s)", node.Contains, typ)
 		err = execString(fmt.Sprintf(template, typ))
 		if err != nil {
@@ -128,3 +128,58 @@ func RelateDependecies(stageURL string) (err error) {
 	}
 	return nil
 }
+
+// RelateSearchOrder relates Exes to the Dlls their imports resolve to and
+// the directories a planted copy would load from
+func RelateSearchOrder(stageURL string) (err error) {
+	log := logerr.Add("search order relationships")
+	log.Debugf("relating (:Exe)-[:%s|%s]->(:INode)", node.ResolvesTo, node.PlantableIn)
+
+	template, _ := node.GetRelationshipTemplate(node.ResolvesTo)
+	err = execString(fmt.Sprintf(template, dataPrefix(stageURL)))
+	if err != nil {
+		return log.Wrap(err)
+	}
+	return nil
+}
+
+// RelateForwards relates Dlls to the DLLs their exports are forwarded to,
+// and to the Dlls those resolve to
+func RelateForwards(stageURL string) (err error) {
+	log := logerr.Add("forwarder relationships")
+	log.Debugf("relating (:Dll)-[:%s]->(:Dep|Dll)", node.ForwardsTo)
+
+	template, _ := node.GetRelationshipTemplate(node.ForwardsTo)
+	err = execString(fmt.Sprintf(template, dataPrefix(stageURL)))
+	if err != nil {
+		return log.Wrap(err)
+	}
+	return nil
+}
+
+// RelateAutoElevation relates the directories a DLL could be planted in to
+// the autoElevate Exes that would load it elevated without a UAC prompt
+func RelateAutoElevation() (err error) {
+	log := logerr.Add("auto-elevation relationships")
+	log.Debugf("relating (:Directory)-[:%s]->(:Exe)", node.ElevatedBy)
+
+	template, _ := node.GetRelationshipTemplate(node.ElevatedBy)
+	err = execString(template)
+	if err != nil {
+		return log.Wrap(err)
+	}
+	return nil
+}
+
+// FlagMissingExports records, on each RESOLVES_TO relationship, the imported
+// functions the resolved Dll doesn't export
+func FlagMissingExports() (err error) {
+	log := logerr.Add("missing exports")
+	log.Debugf("flagging (:Exe)-[:%s]->(:Dll) missing imported exports", node.ResolvesTo)
+
+	err = execString(node.CypherTemplates.FlagMissingExports)
+	if err != nil {
+		return log.Wrap(err)
+	}
+	return nil
+}
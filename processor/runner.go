@@ -26,6 +26,22 @@ func InsertAllRunners(stageURL string) (err error) {
 	if err != nil {
 		return log.Wrap(err)
 	}
+
+	// paths that would run instead of unquoted runner exes
+	log.Debug("processing candidates")
+	template, _ = node.GetTemplateForNodeType(node.Candidate)
+	err = execString(fmt.Sprintf(template, dataPrefix(stageURL)))
+	if err != nil {
+		return log.Wrap(err)
+	}
+
+	// scripts run by interpreter runners
+	log.Debug("processing scripts")
+	template, _ = node.GetTemplateForNodeType(node.Script)
+	err = execString(fmt.Sprintf(template, dataPrefix(stageURL)))
+	if err != nil {
+		return log.Wrap(err)
+	}
 	return nil
 }
 
@@ -57,6 +73,15 @@ func BulkRelateRunners() (err error) {
 		return log.Wrap(err)
 	}
 
+	// relate the payloads proxy-execution runners hand their args to
+	for _, typ := range []string{node.Exe, node.Dll, node.Script} {
+		log.Debugf("relating all payload (:%s)-[:%s]->(:Runner)", typ, node.ExecutedBy)
+		err = execString(fmt.Sprintf(node.CypherTemplates.RelateRunnerPayload, typ))
+		if err != nil {
+			return log.Wrap(err)
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,260 @@
+package util
+
+import (
+	"path"
+	"slices"
+	"strings"
+)
+
+// execExtensions are the extensions of files CreateProcess will run, used
+// to pick the binary of an unquoted command line when the filesystem can't
+// be consulted
+var execExtensions = map[string]bool{
+	".exe": true,
+	".com": true,
+	".scr": true,
+	".bat": true,
+	".cmd": true,
+}
+
+// PathExt is the default PATHEXT, the extensions cmd appends, in order, to
+// find a program named without one
+var PathExt = []string{".com", ".exe", ".bat", ".cmd", ".vbs", ".vbe", ".js", ".jse", ".wsf", ".wsh", ".msc"}
+
+// CommandLine is a Windows command line split the way CreateProcess and
+// CommandLineToArgvW split it
+type CommandLine struct {
+	Binary     string   // the file CreateProcess runs
+	Args       []string // the arguments the binary receives, after argv[0]
+	RawArgs    string   // the unparsed text following the binary
+	Candidates []string // the paths CreateProcess tries in order, ending with Binary
+	Quoted     bool     // whether the binary was quoted
+}
+
+// ParseCommandLine splits cmdline into the binary Windows runs and its
+// arguments. An unquoted binary containing spaces is ambiguous, so
+// CreateProcess tries each space-delimited prefix in turn, appending .exe to
+// those without an extension, and runs the first that exists. A binary
+// without a directory is looked for in each of dirs, which CreateProcessDirs
+// lists. exists reports whether a path names a file; when it's nil, or no
+// candidate exists, the first candidate with an executable extension is
+// assumed to be the one.
+func ParseCommandLine(cmdline string, dirs []string, exists func(string) bool) CommandLine {
+	cmdline = strings.TrimLeft(cmdline, " \t")
+
+	if strings.HasPrefix(cmdline, `"`) {
+		bin, rest, _ := strings.Cut(cmdline[1:], `"`)
+		bin = withExeExtension(bin)
+		if found := SearchPath(bin, dirs, nil, exists); found != "" {
+			bin = found
+		}
+		rawArgs := strings.TrimLeft(rest, " \t")
+		return CommandLine{
+			Binary:     bin,
+			Args:       SplitArgs(rawArgs),
+			RawArgs:    rawArgs,
+			Candidates: []string{bin},
+			Quoted:     true,
+		}
+	}
+
+	// every whitespace may end the binary
+	type candidate struct {
+		path string
+		end  int
+		ext  string // the extension the prefix was given, if any
+	}
+	var candidates []candidate
+	for i := 0; i <= len(cmdline); i++ {
+		if i < len(cmdline) && cmdline[i] != ' ' && cmdline[i] != '\t' {
+			continue
+		}
+		if i > 0 && cmdline[i-1] != ' ' && cmdline[i-1] != '\t' {
+			prefix := cmdline[:i]
+			candidates = append(candidates, candidate{
+				path: withExeExtension(prefix),
+				end:  i,
+				ext:  Lower(path.Ext(winSlash(prefix))),
+			})
+		}
+	}
+	if len(candidates) == 0 {
+		return CommandLine{}
+	}
+
+	chosen := -1
+	if exists != nil {
+		for i, c := range candidates {
+			if found := SearchPath(c.path, dirs, nil, exists); found != "" {
+				candidates[i].path = found
+				chosen = i
+				break
+			}
+		}
+	}
+	if chosen == -1 {
+		for i, c := range candidates {
+			if execExtensions[c.ext] {
+				chosen = i
+				break
+			}
+		}
+	}
+	if chosen == -1 {
+		// Windows would run the first token, like it does extensionless
+		// binaries
+		chosen = 0
+	}
+
+	cmd := CommandLine{
+		Binary:  candidates[chosen].path,
+		RawArgs: strings.TrimLeft(cmdline[candidates[chosen].end:], " \t"),
+	}
+	cmd.Args = SplitArgs(cmd.RawArgs)
+	for _, c := range candidates[:chosen+1] {
+		cmd.Candidates = append(cmd.Candidates, c.path)
+	}
+	return cmd
+}
+
+// CreateProcessDirs returns the directories CreateProcess looks for a binary
+// named without one in, in order: the directory of the application calling
+// it, the current directory, System32, System, the Windows directory and
+// those of PATH. Empty and repeated directories are left out.
+func CreateProcessDirs(appDir, currentDir, windows string, pathDirs []string) []string {
+	candidates := []string{appDir, currentDir}
+	if windows != "" {
+		candidates = append(candidates, windows+`\System32`, windows+`\System`, windows)
+	}
+
+	var dirs []string
+	for _, dir := range append(candidates, pathDirs...) {
+		dir = strings.TrimRight(dir, `\/`)
+		if dir == "" {
+			continue
+		}
+		if !slices.ContainsFunc(dirs, func(d string) bool {
+			return Lower(winSlash(d)) == Lower(winSlash(dir))
+		}) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// SearchPath returns the path of the file name names, or "" when exists
+// finds none. A name without a directory is looked for in each of dirs in
+// turn. Each of extensions, like those of PathExt, is appended in turn to a
+// name without one of them, after trying a name that has an extension as is.
+func SearchPath(name string, dirs, extensions []string, exists func(string) bool) string {
+	if exists == nil || name == "" {
+		return ""
+	}
+
+	var names []string
+	ext := Lower(path.Ext(winSlash(name)))
+	if ext != "" {
+		names = append(names, name)
+	}
+	if !slices.Contains(extensions, ext) {
+		for _, e := range extensions {
+			names = append(names, name+e)
+		}
+	}
+
+	if strings.ContainsAny(name, `\/:`) {
+		dirs = []string{""}
+	}
+	for _, dir := range dirs {
+		for _, n := range names {
+			p := n
+			if dir != "" {
+				p = dir + `\` + n
+			}
+			if exists(p) {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// SplitArgs splits the arguments of a command line, everything after
+// argv[0], following the rules of CommandLineToArgvW
+func SplitArgs(args string) []string {
+	var (
+		split  []string
+		arg    strings.Builder
+		inArg  bool
+		quotes int // 0 outside quotes, 1 inside them
+		slash  int // backslashes seen since the last other character
+	)
+
+	for i := 0; i < len(args); i++ {
+		c := args[i]
+		switch {
+		case (c == ' ' || c == '\t') && quotes == 0:
+			if inArg {
+				split = append(split, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+			slash = 0
+
+		case c == '\\':
+			arg.WriteByte(c)
+			inArg = true
+			slash++
+
+		case c == '"':
+			inArg = true
+			// backslashes before a quote are halved, and an odd one
+			// out escapes the quote
+			s := arg.String()
+			arg.Reset()
+			arg.WriteString(s[:len(s)-slash+slash/2])
+			if slash%2 == 1 {
+				arg.WriteByte('"')
+				slash = 0
+				continue
+			}
+			slash = 0
+			quotes++
+
+			// each third consecutive quote is a literal one
+			for i+1 < len(args) && args[i+1] == '"' {
+				i++
+				quotes++
+				if quotes == 3 {
+					arg.WriteByte('"')
+					quotes = 0
+				}
+			}
+			if quotes == 2 {
+				quotes = 0
+			}
+
+		default:
+			arg.WriteByte(c)
+			inArg = true
+			slash = 0
+		}
+	}
+	if inArg {
+		split = append(split, arg.String())
+	}
+	return split
+}
+
+// withExeExtension appends .exe to a path that has no extension, like
+// CreateProcess does
+func withExeExtension(bin string) string {
+	if path.Ext(winSlash(bin)) == "" {
+		return bin + ".exe"
+	}
+	return bin
+}
+
+func winSlash(winPath string) string {
+	return strings.ReplaceAll(winPath, `\`, "/")
+}
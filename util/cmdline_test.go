@@ -0,0 +1,213 @@
+package util
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	tests := []struct {
+		name       string
+		cmdline    string
+		dirs       []string
+		exists     []string
+		binary     string
+		args       []string
+		rawArgs    string
+		candidates []string
+	}{
+		{
+			name:       "Quoted binaries are taken as is",
+			cmdline:    `"C:\Program Files\App\app.exe" --config=test.json`,
+			binary:     `C:\Program Files\App\app.exe`,
+			args:       []string{"--config=test.json"},
+			rawArgs:    "--config=test.json",
+			candidates: []string{`C:\Program Files\App\app.exe`},
+		},
+		{
+			name:    "Unquoted paths with spaces try every prefix",
+			cmdline: `C:\Program Files\Vendor App\svc.exe -run`,
+			binary:  `C:\Program Files\Vendor App\svc.exe`,
+			args:    []string{"-run"},
+			rawArgs: "-run",
+			candidates: []string{
+				`C:\Program.exe`,
+				`C:\Program Files\Vendor.exe`,
+				`C:\Program Files\Vendor App\svc.exe`,
+			},
+		},
+		{
+			name:       "Uppercase and .com extensions end the binary",
+			cmdline:    `C:\TOOLS\RUN.COM /X`,
+			binary:     `C:\TOOLS\RUN.COM`,
+			args:       []string{"/X"},
+			rawArgs:    "/X",
+			candidates: []string{`C:\TOOLS\RUN.COM`},
+		},
+		{
+			name:       "Extensionless binaries get .exe",
+			cmdline:    `C:\Windows\system32\svchost -k netsvcs`,
+			binary:     `C:\Windows\system32\svchost.exe`,
+			args:       []string{"-k", "netsvcs"},
+			rawArgs:    "-k netsvcs",
+			candidates: []string{`C:\Windows\system32\svchost.exe`},
+		},
+		{
+			name:    "The first existing candidate wins",
+			cmdline: `C:\Program Files\Vendor App\svc.exe -run`,
+			exists:  []string{`C:\Program Files\Vendor.exe`},
+			binary:  `C:\Program Files\Vendor.exe`,
+			args:    []string{"App\\svc.exe", "-run"},
+			rawArgs: `App\svc.exe -run`,
+			candidates: []string{
+				`C:\Program.exe`,
+				`C:\Program Files\Vendor.exe`,
+			},
+		},
+		{
+			name:       "Screensavers are executables",
+			cmdline:    `C:\Windows\Bubbles.scr /s`,
+			binary:     `C:\Windows\Bubbles.scr`,
+			args:       []string{"/s"},
+			rawArgs:    "/s",
+			candidates: []string{`C:\Windows\Bubbles.scr`},
+		},
+		{
+			name:       "Binaries without a directory are searched for",
+			cmdline:    `svchost.exe -k netsvcs`,
+			dirs:       []string{`C:\Windows\System32\wbem`, `C:\Windows\System32`},
+			exists:     []string{`C:\Windows\System32\svchost.exe`},
+			binary:     `C:\Windows\System32\svchost.exe`,
+			args:       []string{"-k", "netsvcs"},
+			rawArgs:    "-k netsvcs",
+			candidates: []string{`C:\Windows\System32\svchost.exe`},
+		},
+		{
+			name:       "Searched binaries get .exe",
+			cmdline:    `"notepad" C:\notes.txt`,
+			dirs:       []string{`C:\Windows\System32`, `C:\Windows`},
+			exists:     []string{`C:\Windows\notepad.exe`},
+			binary:     `C:\Windows\notepad.exe`,
+			args:       []string{`C:\notes.txt`},
+			rawArgs:    `C:\notes.txt`,
+			candidates: []string{`C:\Windows\notepad.exe`},
+		},
+		{
+			name:       "Binaries found nowhere keep their name",
+			cmdline:    `notepad`,
+			dirs:       []string{`C:\Windows\System32`},
+			exists:     []string{`C:\Windows\System32\calc.exe`},
+			binary:     `notepad.exe`,
+			candidates: []string{`notepad.exe`},
+		},
+		{
+			name:    "Empty command lines have no binary",
+			cmdline: "  ",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var exists func(string) bool
+			if test.exists != nil {
+				exists = func(p string) bool { return slices.Contains(test.exists, p) }
+			}
+
+			cmd := ParseCommandLine(test.cmdline, test.dirs, exists)
+			if cmd.Binary != test.binary {
+				t.Errorf("Binary = %q, expected %q", cmd.Binary, test.binary)
+			}
+			if !slices.Equal(cmd.Args, test.args) {
+				t.Errorf("Args = %q, expected %q", cmd.Args, test.args)
+			}
+			if cmd.RawArgs != test.rawArgs {
+				t.Errorf("RawArgs = %q, expected %q", cmd.RawArgs, test.rawArgs)
+			}
+			if !slices.Equal(cmd.Candidates, test.candidates) {
+				t.Errorf("Candidates = %q, expected %q", cmd.Candidates, test.candidates)
+			}
+		})
+	}
+}
+
+func TestCreateProcessDirs(t *testing.T) {
+	dirs := CreateProcessDirs(
+		`C:\Program Files\App\`,
+		`C:\Windows\system32`,
+		`C:\Windows`,
+		[]string{`C:\Windows\System32`, "", `C:\Tools`},
+	)
+	expected := []string{
+		`C:\Program Files\App`,
+		`C:\Windows\system32`,
+		`C:\Windows\System`,
+		`C:\Windows`,
+		`C:\Tools`,
+	}
+	if !slices.Equal(dirs, expected) {
+		t.Errorf("CreateProcessDirs = %q, expected %q", dirs, expected)
+	}
+
+	if dirs := CreateProcessDirs("", "", "", nil); len(dirs) != 0 {
+		t.Errorf("Expected no directories, got %q", dirs)
+	}
+}
+
+func TestSearchPath(t *testing.T) {
+	files := []string{
+		`C:\Windows\System32\cmd.exe`,
+		`C:\Tools\deploy.cmd`,
+		`C:\Tools\setup.bat`,
+		`C:\Tools\setup.bat.exe`,
+	}
+	exists := func(p string) bool { return slices.Contains(files, p) }
+	dirs := []string{`C:\Windows\System32`, `C:\Tools`}
+
+	tests := []struct {
+		name       string
+		extensions []string
+		expected   string
+	}{
+		{`cmd.exe`, nil, `C:\Windows\System32\cmd.exe`},
+		{`cmd`, PathExt, `C:\Windows\System32\cmd.exe`},
+		{`deploy`, PathExt, `C:\Tools\deploy.cmd`},
+		{`deploy`, nil, ""},
+		{`setup.bat`, PathExt, `C:\Tools\setup.bat`},
+		{`C:\Tools\deploy`, PathExt, `C:\Tools\deploy.cmd`},
+		{`C:\Tools\cmd.exe`, nil, ""},
+		{`missing.exe`, PathExt, ""},
+	}
+	for _, test := range tests {
+		if found := SearchPath(test.name, dirs, test.extensions, exists); found != test.expected {
+			t.Errorf("SearchPath(%q, %q) = %q, expected %q", test.name, test.extensions, found, test.expected)
+		}
+	}
+
+	if found := SearchPath(`cmd.exe`, dirs, nil, nil); found != "" {
+		t.Errorf("Expected nothing found without a filesystem, got %q", found)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`/s x.dll`, []string{"/s", "x.dll"}},
+		{`"C:\a b\x.dll",Entry  arg`, []string{`C:\a b\x.dll,Entry`, "arg"}},
+		{`-File ""`, []string{"-File", ""}},
+		{`a\\\"b`, []string{`a\"b`}},
+		{`"a\\" b`, []string{`a\`, "b"}},
+		{`C:\dir\ x`, []string{`C:\dir\`, "x"}},
+		{`"a""b"`, []string{`a"b`}},
+		{`a"b c"d`, []string{"ab cd"}},
+		{"\tx\t", []string{"x"}},
+		{"", nil},
+	}
+
+	for _, test := range tests {
+		if result := SplitArgs(test.input); !slices.Equal(result, test.expected) {
+			t.Errorf("SplitArgs(%q) = %q, expected %q", test.input, result, test.expected)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"math/rand"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 )
@@ -138,25 +139,26 @@ func Rand() string {
 	return sb.String()
 }
 
-// SmoothBrainPath splits a command line into executable and arguments
-func SmoothBrainPath(cmdline string) (bin, args string) {
-	if strings.HasPrefix(cmdline, `"`) {
-		quoteCharOffset := 1
-		secondQuoteIdx := strings.Index(cmdline[quoteCharOffset:], `"`)
-		endOfCmd := len(cmdline) - len(cmdline[secondQuoteIdx:]) + quoteCharOffset
-		bin = cmdline[quoteCharOffset:endOfCmd]
-		args = strings.TrimSpace(cmdline[endOfCmd+quoteCharOffset:])
-		return
-	}
-
-	splitCmd := strings.Split(cmdline, " ")
+// WinBase returns the last element of a Windows path, which may use either
+// separator, independent of the platform doing the parsing
+func WinBase(winPath string) string {
+	return path.Base(strings.ReplaceAll(winPath, `\`, "/"))
+}
 
-	for idx, part := range splitCmd {
-		if strings.HasSuffix(part, ".exe") || strings.HasSuffix(part, ".dll") {
-			bin = strings.Join(splitCmd[0:idx+1], " ")
-			args = strings.Join(splitCmd[idx+1:], " ")
-		}
+// WinDir returns all but the last element of a Windows path, which may use
+// either separator, independent of the platform doing the parsing
+func WinDir(winPath string) string {
+	dir := path.Dir(strings.ReplaceAll(winPath, `\`, "/"))
+	if len(dir) == 2 && dir[1] == ':' {
+		// keep drive roots rooted, like filepath.Dir does on Windows
+		dir += "/"
 	}
+	return dir
+}
 
-	return
+// QuoteCSV quotes a free-form value, such as a command line, so it survives
+// as a single CSV field
+func QuoteCSV(str string) string {
+	str = strings.NewReplacer("\r", " ", "\n", " ").Replace(str)
+	return `"` + strings.ReplaceAll(str, `"`, `""`) + `"`
 }
@@ -156,35 +156,42 @@ func TestRand(t *testing.T) {
 	}
 }
 
-func TestSmoothBrainPath(t *testing.T) {
+func TestWinBaseAndDir(t *testing.T) {
 	tests := []struct {
-		cmdline      string
-		expectedBin  string
-		expectedArgs string
+		input        string
+		expectedBase string
+		expectedDir  string
 	}{
-		{
-			`"C:\Program Files\App\app.exe" --config=test.json`,
-			"C:\\Program Files\\App\\app.exe",
-			"--config=test.json",
-		},
-		{
-			`C:\Windows\System32\cmd.exe /c echo hello`,
-			"C:\\Windows\\System32\\cmd.exe",
-			"/c echo hello",
-		},
-		{
-			`C:\Windows\rundll32.exe shell32.dll,Control_RunDLL`,
-			"C:\\Windows\\rundll32.exe",
-			"shell32.dll,Control_RunDLL",
-		},
-		{`program.exe arg1 arg2`, "program.exe", "arg1 arg2"},
+		{`C:\Windows\System32\svchost.exe`, "svchost.exe", "C:/Windows/System32"},
+		{`c:/program files/app/app.exe`, "app.exe", "c:/program files/app"},
+		{`C:\boot.exe`, "boot.exe", "C:/"},
+		{`svchost.exe`, "svchost.exe", "."},
 	}
 
 	for _, test := range tests {
-		bin, args := SmoothBrainPath(test.cmdline)
-		if bin != test.expectedBin || args != test.expectedArgs {
-			t.Errorf("SmoothBrainPath(%q) = (%q, %q), expected (%q, %q)",
-				test.cmdline, bin, args, test.expectedBin, test.expectedArgs)
+		if result := WinBase(test.input); result != test.expectedBase {
+			t.Errorf("WinBase(%q) = %q, expected %q", test.input, result, test.expectedBase)
+		}
+		if result := WinDir(test.input); result != test.expectedDir {
+			t.Errorf("WinDir(%q) = %q, expected %q", test.input, result, test.expectedDir)
+		}
+	}
+}
+
+func TestQuoteCSV(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`shell32.dll,Control_RunDLL`, `"shell32.dll,Control_RunDLL"`},
+		{`-File "C:\a b\x.ps1"`, `"-File ""C:\a b\x.ps1"""`},
+		{"line\r\nbreak", `"line  break"`},
+		{"", `""`},
+	}
+
+	for _, test := range tests {
+		if result := QuoteCSV(test.input); result != test.expected {
+			t.Errorf("QuoteCSV(%q) = %q, expected %q", test.input, result, test.expected)
 		}
 	}
 }